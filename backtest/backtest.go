@@ -0,0 +1,228 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// amountBuckets are the upper bounds of the flagged amount histogram.
+var amountBuckets = []float64{1_000, 5_000, 10_000, 20_000, 50_000, math.Inf(1)}
+
+// options holds the command-line options.
+type options struct {
+	Files   []string `short:"f" long:"file" description:"Input file or glob pattern, like sampledata/*.json; may be repeated" required:"true"`
+	Rules   string   `short:"r" long:"rules" description:"Rules file; the default rules are used if not set"`
+	Compare string   `short:"c" long:"compare" description:"Second rules file to compare against --rules"`
+	Sort    bool     `short:"s" long:"sort" description:"Replay transactions ordered by transaction_time instead of file order"`
+}
+
+// result holds what a rule set flagged during the backtest.
+type result struct {
+	name    string
+	ruleSet *rules.RuleSet
+	flagged []bool
+	byRule  map[string]int
+	amounts []float64
+}
+
+// newResult loads the rules file, or the default rules if path is empty.
+// Baselines are kept in memory, so no MongoDB is needed.
+func newResult(path string) (*result, error) {
+	r := &result{name: path, byRule: make(map[string]int)}
+	if path == "" {
+		r.name = "default rules"
+		r.ruleSet = rules.Default()
+		return r, nil
+	}
+	rs, err := rules.Load(path, rules.WithBaselineStore(rules.NewMemoryBaselineStore()))
+	if err != nil {
+		return nil, errors.Wrap(err, "loading rules")
+	}
+	r.ruleSet = rs
+	return r, nil
+}
+
+// assess runs the transaction through the rule set and records the outcome.
+func (r *result) assess(t *transaction.Transaction) {
+	v := r.ruleSet.Assess(t)
+	suspicious := v.Suspicious()
+	r.flagged = append(r.flagged, suspicious)
+	if !suspicious {
+		return
+	}
+	r.amounts = append(r.amounts, float64(t.TransactionAmount))
+	for _, f := range v.Findings {
+		r.byRule[f.Rule]++
+	}
+}
+
+// total returns the number of flagged transactions.
+func (r *result) total() int {
+	return len(r.amounts)
+}
+
+func run(args []string, out io.Writer) error {
+	var opts options
+	if _, err := flags.ParseArgs(&opts, args); err != nil {
+		return err
+	}
+	txs, invalid, err := transaction.ReadFiles(opts.Files)
+	if err != nil {
+		return err
+	}
+	if opts.Sort {
+		sort.SliceStable(txs, func(i, j int) bool {
+			return txs[i].TransactionTime.Before(txs[j].TransactionTime)
+		})
+	}
+	results := make([]*result, 0, 2)
+	baseline, err := newResult(opts.Rules)
+	if err != nil {
+		return err
+	}
+	results = append(results, baseline)
+	if opts.Compare != "" {
+		candidate, err := newResult(opts.Compare)
+		if err != nil {
+			return err
+		}
+		results = append(results, candidate)
+	}
+	for _, t := range txs {
+		for _, r := range results {
+			r.assess(&t.Transaction)
+		}
+	}
+	fmt.Fprintf(out, "Transactions: %d\n", len(txs))
+	fmt.Fprintf(out, "Invalid lines: %d\n", invalid)
+	for _, r := range results {
+		printResult(out, r, len(txs))
+	}
+	if len(results) == 2 {
+		printDiff(out, results[0], results[1])
+	}
+	return nil
+}
+
+// printResult prints the flagged counts per rule and the flagged amount distribution.
+func printResult(out io.Writer, r *result, total int) {
+	fmt.Fprintf(out, "\n== %s ==\n", r.name)
+	fmt.Fprintf(out, "Flagged: %d (%s)\n\n", r.total(), percent(r.total(), total))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tFINDINGS")
+	for _, name := range sortedKeys(r.byRule) {
+		fmt.Fprintf(w, "%s\t%d\n", name, r.byRule[name])
+	}
+	w.Flush()
+
+	if r.total() == 0 {
+		return
+	}
+	amounts := append([]float64(nil), r.amounts...)
+	sort.Float64s(amounts)
+	var sum float64
+	for _, a := range amounts {
+		sum += a
+	}
+	fmt.Fprintf(out, "\nFlagged amounts: min %.2f, mean %.2f, p50 %.2f, p90 %.2f, p99 %.2f, max %.2f\n",
+		amounts[0], sum/float64(len(amounts)), percentile(amounts, 50), percentile(amounts, 90),
+		percentile(amounts, 99), amounts[len(amounts)-1])
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AMOUNT\tFLAGGED")
+	lower, i := 0.0, 0
+	for _, upper := range amountBuckets {
+		var n int
+		for ; i < len(amounts) && amounts[i] < upper; i++ {
+			n++
+		}
+		label := fmt.Sprintf("%.0f - %.0f", lower, upper)
+		if math.IsInf(upper, 1) {
+			label = fmt.Sprintf(">= %.0f", lower)
+		}
+		fmt.Fprintf(w, "%s\t%d\n", label, n)
+		lower = upper
+	}
+	w.Flush()
+}
+
+// printDiff prints how the verdicts of two rule sets differ.
+func printDiff(out io.Writer, baseline, candidate *result) {
+	var onlyBaseline, onlyCandidate, both int
+	for i := range baseline.flagged {
+		switch {
+		case baseline.flagged[i] && candidate.flagged[i]:
+			both++
+		case baseline.flagged[i]:
+			onlyBaseline++
+		case candidate.flagged[i]:
+			onlyCandidate++
+		}
+	}
+	fmt.Fprintf(out, "\n== diff: %s -> %s ==\n", baseline.name, candidate.name)
+	fmt.Fprintf(out, "Flagged by both: %d\n", both)
+	fmt.Fprintf(out, "Only flagged by %s: %d\n", baseline.name, onlyBaseline)
+	fmt.Fprintf(out, "Only flagged by %s: %d\n\n", candidate.name, onlyCandidate)
+
+	names := make(map[string]int)
+	for name, n := range baseline.byRule {
+		names[name] += n
+	}
+	for name, n := range candidate.byRule {
+		names[name] += n
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tBEFORE\tAFTER\tDELTA")
+	fmt.Fprintf(w, "(flagged)\t%d\t%d\t%+d\n", baseline.total(), candidate.total(), candidate.total()-baseline.total())
+	for _, name := range sortedKeys(names) {
+		before, after := baseline.byRule[name], candidate.byRule[name]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%+d\n", name, before, after, after-before)
+	}
+	w.Flush()
+}
+
+// percentile returns the p-th percentile of sorted values, using the nearest rank.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// percent formats n as a percentage of total.
+func percent(n, total int) string {
+	if total == 0 {
+		return "0.00%"
+	}
+	return fmt.Sprintf("%.2f%%", 100*float64(n)/float64(total))
+}
+
+// sortedKeys returns the keys of the map in alphabetical order.
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const transactions = `{"transaction_id":1,"account_number":1,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}
+{"transaction_id":2,"account_number":2,"transaction_type":"withdrawal","transaction_amount":1308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}
+invalid line
+{"transaction_id":3,"account_number":3,"transaction_type":"withdrawal","transaction_amount":7000,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Austin, TX"}
+`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	write("a.json", transactions)
+	write("b.json", transactions)
+	current := write("current.json", `{"rules":[{"name":"over_10000","kind":"amount","params":{"greater_than":10000}}]}`)
+	candidate := write("candidate.json", `{"rules":[{"name":"over_5000","kind":"amount","params":{"greater_than":5000}}]}`)
+
+	var out bytes.Buffer
+	err := run([]string{"backtest", "-f", filepath.Join(dir, "?.json"), "-r", current, "-c", candidate}, &out)
+	require.NoError(t, err)
+	expected := `Transactions: 6
+Invalid lines: 2
+
+== ` + current + ` ==
+Flagged: 2 (33.33%)
+
+RULE        FINDINGS
+over_10000  2
+
+Flagged amounts: min 11308.58, mean 11308.58, p50 11308.58, p90 11308.58, p99 11308.58, max 11308.58
+AMOUNT         FLAGGED
+0 - 1000       0
+1000 - 5000    0
+5000 - 10000   0
+10000 - 20000  2
+20000 - 50000  0
+>= 50000       0
+
+== ` + candidate + ` ==
+Flagged: 4 (66.67%)
+
+RULE       FINDINGS
+over_5000  4
+
+Flagged amounts: min 7000.00, mean 9154.29, p50 7000.00, p90 11308.58, p99 11308.58, max 11308.58
+AMOUNT         FLAGGED
+0 - 1000       0
+1000 - 5000    0
+5000 - 10000   2
+10000 - 20000  2
+20000 - 50000  0
+>= 50000       0
+
+== diff: ` + current + ` -> ` + candidate + ` ==
+Flagged by both: 2
+Only flagged by ` + current + `: 0
+Only flagged by ` + candidate + `: 2
+
+RULE        BEFORE  AFTER  DELTA
+(flagged)   2       4      +2
+over_10000  2       0      -2
+over_5000   0       4      +4
+`
+	require.Equal(t, expected, out.String())
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	var out bytes.Buffer
+	err := run([]string{"backtest", "-f", filepath.Join(dir, "*.json")}, &out)
+	require.EqualError(t, err, "no files match "+filepath.Join(dir, "*.json"))
+
+	path := filepath.Join(dir, "a.json")
+	require.NoError(t, os.WriteFile(path, []byte(transactions), 0644))
+	err = run([]string{"backtest", "-f", path, "-r", filepath.Join(dir, "missing.json")}, &out)
+	require.ErrorContains(t, err, "loading rules: reading rules file")
+
+	out.Reset()
+	require.NoError(t, run([]string{"backtest", "-f", path}, &out))
+	require.Contains(t, out.String(), "== default rules ==\nFlagged: 1 (33.33%)")
+}
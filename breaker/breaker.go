@@ -0,0 +1,187 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package breaker
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// For ease of unit testing.
+var now = time.Now
+
+// State is the state of a Breaker.
+type State int
+
+// States of a Breaker.
+const (
+	// Closed lets every call through.
+	Closed State = iota
+	// Open rejects every call until OpenTimeout elapses.
+	Open
+	// HalfOpen lets a single probe call through; it closes the breaker
+	// if it succeeds and opens it again if it fails.
+	HalfOpen
+)
+
+// String returns the name of the state.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// waitInterval is how often Wait checks whether a call is allowed.
+const waitInterval = 100 * time.Millisecond
+
+// Breaker is a circuit breaker: after FailureThreshold consecutive
+// failures, it stops letting calls through for OpenTimeout, so a
+// dependency that is down is not hammered.
+type Breaker struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	onStateChange    func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+	// probes is the number of probes let through so far, the last of
+	// which is in flight if probing.
+	probes uint64
+}
+
+// Call is a call let through by a Breaker.
+type Call struct {
+	// probe is the number of the probe the call is, or zero if it is
+	// not one.
+	probe uint64
+}
+
+// New creates a new Breaker. onStateChange, if not nil, is called on
+// every state change, outside of the breaker lock.
+func New(failureThreshold int, openTimeout time.Duration, onStateChange func(from, to State)) *Breaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &Breaker{failureThreshold: failureThreshold, openTimeout: openTimeout, onStateChange: onStateChange}
+}
+
+// State returns the current state.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow tells whether a call can be made now. Every allowed call must
+// be followed by a call to Record with its outcome, or to Release.
+func (b *Breaker) Allow() (Call, bool) {
+	b.mu.Lock()
+	from := b.state
+	allowed := true
+	var c Call
+	switch b.state {
+	case Open:
+		if now().Sub(b.openedAt) < b.openTimeout {
+			allowed = false
+			break
+		}
+		b.state = HalfOpen
+		c = b.probe()
+	case HalfOpen:
+		if b.probing {
+			allowed = false
+			break
+		}
+		c = b.probe()
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+	return c, allowed
+}
+
+// probe lets a probe call through. It must be called with the lock held.
+func (b *Breaker) probe() Call {
+	b.probing = true
+	b.probes++
+	return Call{probe: b.probes}
+}
+
+// Wait blocks until a call is allowed or the context is done.
+func (b *Breaker) Wait(ctx context.Context) (Call, error) {
+	for {
+		c, ok := b.Allow()
+		if ok {
+			return c, nil
+		}
+		timer := time.NewTimer(waitInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return Call{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Record records the outcome of an allowed call. While the breaker is
+// half-open, only the outcome of the probe changes its state; the
+// calls let through before it say nothing about the recovery.
+func (b *Breaker) Record(c Call, err error) {
+	b.mu.Lock()
+	from := b.state
+	probe := b.isProbe(c)
+	switch {
+	case b.state == HalfOpen && !probe:
+		// Left for the probe to decide.
+	case err == nil:
+		b.failures = 0
+		b.state = Closed
+	default:
+		b.failures++
+		if b.state == HalfOpen || b.failures >= b.failureThreshold {
+			b.state = Open
+			b.openedAt = now()
+		}
+	}
+	if probe {
+		b.probing = false
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.changed(from, to)
+}
+
+// Release gives up an allowed call without an outcome, like one whose
+// context was canceled. If it was the probe, another one is let through.
+func (b *Breaker) Release(c Call) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.isProbe(c) {
+		b.probing = false
+	}
+}
+
+// isProbe tells whether c is the probe in flight. It must be called
+// with the lock held.
+func (b *Breaker) isProbe(c Call) bool {
+	return b.probing && c.probe != 0 && c.probe == b.probes
+}
+
+// changed calls onStateChange if the state changed.
+func (b *Breaker) changed(from, to State) {
+	if from != to && b.onStateChange != nil {
+		b.onStateChange(from, to)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	current := time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	var changes []string
+	b := New(3, 10*time.Second, func(from, to State) {
+		changes = append(changes, fmt.Sprintf("%v -> %v", from, to))
+	})
+	failure := errors.New("random error")
+	call := func(err error) {
+		c, ok := b.Allow()
+		require.True(t, ok)
+		b.Record(c, err)
+	}
+	allowed := func() bool {
+		_, ok := b.Allow()
+		return ok
+	}
+
+	// Failures below the threshold keep it closed.
+	for i := 0; i < 2; i++ {
+		call(failure)
+	}
+	call(nil)
+	require.Equal(t, Closed, b.State())
+
+	for i := 0; i < 3; i++ {
+		call(failure)
+	}
+	require.Equal(t, Open, b.State())
+	require.False(t, allowed())
+
+	// After the timeout, a single probe is let through.
+	current = current.Add(10 * time.Second)
+	probe, ok := b.Allow()
+	require.True(t, ok)
+	require.Equal(t, HalfOpen, b.State())
+	require.False(t, allowed())
+
+	// A failed probe opens it again.
+	b.Record(probe, failure)
+	require.Equal(t, Open, b.State())
+	require.False(t, allowed())
+
+	current = current.Add(10 * time.Second)
+	call(nil)
+	require.Equal(t, Closed, b.State())
+	require.True(t, allowed())
+
+	require.Equal(t, []string{
+		"closed -> open",
+		"open -> half-open",
+		"half-open -> open",
+		"open -> half-open",
+		"half-open -> closed",
+	}, changes)
+}
+
+func TestBreakerProbe(t *testing.T) {
+	current := time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	b := New(1, 10*time.Second, nil)
+	failure := errors.New("random error")
+
+	// A call let through before the breaker opened.
+	late, ok := b.Allow()
+	require.True(t, ok)
+	c, ok := b.Allow()
+	require.True(t, ok)
+	b.Record(c, failure)
+	require.Equal(t, Open, b.State())
+
+	current = current.Add(10 * time.Second)
+	probe, ok := b.Allow()
+	require.True(t, ok)
+
+	// Only the probe decides, and is let through alone, while half-open.
+	b.Record(late, nil)
+	require.Equal(t, HalfOpen, b.State())
+	_, ok = b.Allow()
+	require.False(t, ok)
+
+	// A released probe lets another one through.
+	b.Release(probe)
+	require.Equal(t, HalfOpen, b.State())
+	probe, ok = b.Allow()
+	require.True(t, ok)
+	b.Record(probe, nil)
+	require.Equal(t, Closed, b.State())
+}
+
+func TestWait(t *testing.T) {
+	now = time.Now
+	b := New(1, time.Hour, nil)
+	c, err := b.Wait(context.TODO())
+	require.NoError(t, err)
+	b.Record(c, errors.New("random error"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = b.Wait(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package checkpoint
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Suffixes appended to the name of a file to get the name of its
+// checkpoint, and of the checkpoint being written.
+const (
+	suffix    = ".checkpoint"
+	tmpSuffix = suffix + ".tmp"
+)
+
+// For ease of unit testing.
+var (
+	writeFile = os.WriteFile
+	rename    = os.Rename
+)
+
+// Position is a position in a file: the number of the last line read,
+// starting from 1, and the byte offset of the end of that line.
+type Position struct {
+	Line   int   `json:"line"`
+	Offset int64 `json:"offset"`
+}
+
+// Path returns the path of the checkpoint of the file, a sidecar file
+// next to it.
+func Path(file string) string {
+	return file + suffix
+}
+
+// IsCheckpoint tells whether the file is a checkpoint, or a checkpoint
+// being written.
+func IsCheckpoint(file string) bool {
+	return strings.HasSuffix(file, suffix) || strings.HasSuffix(file, tmpSuffix)
+}
+
+// Read reads the checkpoint of the file. Without checkpoint, the
+// position is the start of the file.
+func Read(file string) (Position, error) {
+	var p Position
+	b, err := os.ReadFile(Path(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return p, errors.Wrapf(err, "reading checkpoint of %s", file)
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, errors.Wrapf(err, "parsing checkpoint of %s", file)
+	}
+	return p, nil
+}
+
+// Write writes the checkpoint of the file. The checkpoint is replaced
+// at once, so a crash never leaves it half written.
+func Write(file string, p Position) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return errors.Wrapf(err, "marshalling checkpoint of %s", file)
+	}
+	tmp := file + tmpSuffix
+	if err := writeFile(tmp, b, 0644); err != nil {
+		return errors.Wrapf(err, "writing checkpoint of %s", file)
+	}
+	if err := rename(tmp, Path(file)); err != nil {
+		return errors.Wrapf(err, "writing checkpoint of %s", file)
+	}
+	return nil
+}
+
+// Tracker tracks the lines of a file whose processing is done, which
+// may finish out of order. Its position is the one of the last line
+// such that it and all the lines before it are done. A line that
+// failed holds the position back for good, so the file is resumed
+// from it.
+type Tracker struct {
+	file    string
+	mu      sync.Mutex
+	pos     Position
+	pending map[int]int64
+	failed  bool
+	saved   bool
+}
+
+// NewTracker creates a new Tracker of the file, whose lines up to
+// the position are done.
+func NewTracker(file string, from Position) *Tracker {
+	return &Tracker{
+		file:    file,
+		pos:     from,
+		pending: make(map[int]int64),
+		saved:   true,
+	}
+}
+
+// Done marks the line as done. offset is the byte offset of its end.
+func (t *Tracker) Done(line int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failed {
+		return
+	}
+	t.pending[line] = offset
+	for {
+		next := t.pos.Line + 1
+		offset, ok := t.pending[next]
+		if !ok {
+			return
+		}
+		delete(t.pending, next)
+		t.pos = Position{Line: next, Offset: offset}
+		t.saved = false
+	}
+}
+
+// Failed marks the line as failed.
+func (t *Tracker) Failed(line int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failed = true
+	t.pending = nil
+}
+
+// Position returns the position of the last line such that it and all
+// the lines before it are done.
+func (t *Tracker) Position() Position {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.pos
+}
+
+// Save writes the checkpoint of the file, if the position changed
+// since it was last saved.
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	pos, saved := t.pos, t.saved
+	t.mu.Unlock()
+	if saved {
+		return nil
+	}
+	if err := Write(t.file, pos); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	// It is saved unless it moved on meanwhile.
+	t.saved = t.pos == pos
+	t.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package checkpoint
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWrite(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transactions.txt")
+	p, err := Read(file)
+	require.NoError(t, err)
+	require.Equal(t, Position{}, p)
+	require.NoError(t, Write(file, Position{Line: 3, Offset: 120}))
+	p, err = Read(file)
+	require.NoError(t, err)
+	require.Equal(t, Position{Line: 3, Offset: 120}, p)
+	b, err := os.ReadFile(file + ".checkpoint")
+	require.NoError(t, err)
+	require.Equal(t, `{"line":3,"offset":120}`, string(b))
+}
+
+func TestIsCheckpoint(t *testing.T) {
+	require.True(t, IsCheckpoint(Path("transactions.txt")))
+	require.True(t, IsCheckpoint(Path("transactions.txt")+".tmp"))
+	require.False(t, IsCheckpoint("transactions.txt"))
+}
+
+func TestRead(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transactions.txt")
+	testCases := []struct {
+		name             string
+		content          string
+		expectedPosition Position
+		expectedError    error
+	}{
+		{
+			name:             "happy path",
+			content:          `{"line":3,"offset":120}`,
+			expectedPosition: Position{Line: 3, Offset: 120},
+		},
+		{
+			name:          "invalid checkpoint",
+			content:       `{"line":`,
+			expectedError: errors.New("parsing checkpoint of " + file + ": unexpected end of JSON input"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, os.WriteFile(file+".checkpoint", []byte(tc.content), 0644))
+			p, err := Read(file)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedPosition, p)
+			}
+		})
+	}
+}
+
+func TestWrite(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mockWriteFile func(name string, data []byte, perm fs.FileMode) error
+		mockRename    func(oldpath, newpath string) error
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			mockWriteFile: func(name string, data []byte, perm fs.FileMode) error {
+				return nil
+			},
+			mockRename: func(oldpath, newpath string) error {
+				return nil
+			},
+		},
+		{
+			name: "error writing",
+			mockWriteFile: func(name string, data []byte, perm fs.FileMode) error {
+				return errors.New("random error")
+			},
+			expectedError: errors.New("writing checkpoint of transactions.txt: random error"),
+		},
+		{
+			name: "error renaming",
+			mockWriteFile: func(name string, data []byte, perm fs.FileMode) error {
+				return nil
+			},
+			mockRename: func(oldpath, newpath string) error {
+				return errors.New("random error")
+			},
+			expectedError: errors.New("writing checkpoint of transactions.txt: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			writeFile = tc.mockWriteFile
+			rename = tc.mockRename
+			err := Write("transactions.txt", Position{Line: 1, Offset: 10})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+			}
+		})
+	}
+	writeFile = os.WriteFile
+	rename = os.Rename
+}
+
+func TestTracker(t *testing.T) {
+	type mark struct {
+		line   int
+		offset int64
+		failed bool
+	}
+	testCases := []struct {
+		name             string
+		from             Position
+		marks            []mark
+		expectedPosition Position
+	}{
+		{
+			name:             "in order",
+			marks:            []mark{{line: 1, offset: 10}, {line: 2, offset: 20}},
+			expectedPosition: Position{Line: 2, Offset: 20},
+		},
+		{
+			name:             "out of order",
+			marks:            []mark{{line: 2, offset: 20}, {line: 3, offset: 30}, {line: 1, offset: 10}},
+			expectedPosition: Position{Line: 3, Offset: 30},
+		},
+		{
+			name:             "gap",
+			marks:            []mark{{line: 1, offset: 10}, {line: 3, offset: 30}},
+			expectedPosition: Position{Line: 1, Offset: 10},
+		},
+		{
+			name:             "resumed",
+			from:             Position{Line: 5, Offset: 50},
+			marks:            []mark{{line: 7, offset: 70}, {line: 6, offset: 60}},
+			expectedPosition: Position{Line: 7, Offset: 70},
+		},
+		{
+			name:             "failed line holds the position back",
+			marks:            []mark{{line: 1, offset: 10}, {line: 3, offset: 30}, {line: 2, failed: true}, {line: 4, offset: 40}},
+			expectedPosition: Position{Line: 1, Offset: 10},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := NewTracker("transactions.txt", tc.from)
+			for _, m := range tc.marks {
+				if m.failed {
+					tr.Failed(m.line)
+					continue
+				}
+				tr.Done(m.line, m.offset)
+			}
+			require.Equal(t, tc.expectedPosition, tr.Position())
+		})
+	}
+}
+
+func TestTrackerSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "transactions.txt")
+	var writes int
+	writeFile = func(name string, data []byte, perm fs.FileMode) error {
+		writes++
+		return os.WriteFile(name, data, perm)
+	}
+	defer func() {
+		writeFile = os.WriteFile
+	}()
+	tr := NewTracker(file, Position{})
+	require.NoError(t, tr.Save())
+	require.Zero(t, writes)
+	tr.Done(1, 10)
+	require.NoError(t, tr.Save())
+	require.NoError(t, tr.Save())
+	require.Equal(t, 1, writes)
+	p, err := Read(file)
+	require.NoError(t, err)
+	require.Equal(t, Position{Line: 1, Offset: 10}, p)
+}
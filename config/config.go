@@ -4,6 +4,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
@@ -11,12 +13,32 @@ import (
 
 // Config holds all configuration needed by this app.
 type Config struct {
-	KafkaBrokerHost string `envconfig:"KAFKA_BROKER_HOST" required:"true"`
-	KafkaTopic      string `envconfig:"KAFKA_TOPIC" required:"true"`
-	KafkaGroupId    string `envconfig:"KAFKA_GROUP_ID" required:"true"`
-	MongodbDatabase string `envconfig:"MONGODB_DATABASE" required:"true"`
-	MongodbHostName string `envconfig:"MONGODB_HOST_NAME" required:"true"`
-	MongodbPort     int    `envconfig:"MONGODB_PORT" required:"true"`
+	KafkaBrokerHost                string        `envconfig:"KAFKA_BROKER_HOST" required:"true"`
+	KafkaTopic                     string        `envconfig:"KAFKA_TOPIC" required:"true"`
+	KafkaGroupId                   string        `envconfig:"KAFKA_GROUP_ID" required:"true"`
+	KafkaCommitInterval            time.Duration `envconfig:"KAFKA_COMMIT_INTERVAL" default:"1s"`
+	KafkaDlqTopic                  string        `envconfig:"KAFKA_DLQ_TOPIC"`
+	KafkaProducerQueueDepth        int           `envconfig:"KAFKA_PRODUCER_QUEUE_DEPTH" default:"10000"`
+	MongodbDatabase                string        `envconfig:"MONGODB_DATABASE" required:"true"`
+	MongodbHostName                string        `envconfig:"MONGODB_HOST_NAME" required:"true"`
+	MongodbPort                    int           `envconfig:"MONGODB_PORT" required:"true"`
+	MongodbInsertMaxAttempts       int           `envconfig:"MONGODB_INSERT_MAX_ATTEMPTS" default:"5"`
+	MongodbInsertInitialBackoff    time.Duration `envconfig:"MONGODB_INSERT_INITIAL_BACKOFF" default:"100ms"`
+	MongodbInsertMaxBackoff        time.Duration `envconfig:"MONGODB_INSERT_MAX_BACKOFF" default:"5s"`
+	MongodbBreakerFailureThreshold int           `envconfig:"MONGODB_BREAKER_FAILURE_THRESHOLD" default:"5"`
+	MongodbBreakerOpenTimeout      time.Duration `envconfig:"MONGODB_BREAKER_OPEN_TIMEOUT" default:"10s"`
+	MongodbBatchSize               int           `envconfig:"MONGODB_BATCH_SIZE" default:"500"`
+	MongodbBatchInterval           time.Duration `envconfig:"MONGODB_BATCH_INTERVAL" default:"200ms"`
+	RulesFile                      string        `envconfig:"RULES_FILE"`
+	RulesReloadInterval            time.Duration `envconfig:"RULES_RELOAD_INTERVAL" default:"5s"`
+	ShutdownTimeout                time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	WorkerJobTimeout               time.Duration `envconfig:"WORKER_JOB_TIMEOUT"`
+	WorkerDispatchKey              string        `envconfig:"WORKER_DISPATCH_KEY" default:"account"`
+	WorkerPoolSize                 int           `envconfig:"WORKER_POOL_SIZE"`
+	WorkerPoolMinSize              int           `envconfig:"WORKER_POOL_MIN_SIZE" default:"1"`
+	WorkerPoolMaxSize              int           `envconfig:"WORKER_POOL_MAX_SIZE"`
+	WorkerAutoscaleInterval        time.Duration `envconfig:"WORKER_AUTOSCALE_INTERVAL" default:"10s"`
+	WorkerAutoscaleMaxLag          int64         `envconfig:"WORKER_AUTOSCALE_MAX_LAG" default:"1000"`
 }
 
 // For ease of unit testing.
@@ -10,13 +10,21 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/breaker"
 	"github.com/tiagomelo/realtime-data-kafka/config"
+	"github.com/tiagomelo/realtime-data-kafka/deadletter"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/accountbaseline"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction"
+	"github.com/tiagomelo/realtime-data-kafka/offset"
+	"github.com/tiagomelo/realtime-data-kafka/retry"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
 	"github.com/tiagomelo/realtime-data-kafka/screen"
 	"github.com/tiagomelo/realtime-data-kafka/stats"
 	"github.com/tiagomelo/realtime-data-kafka/task"
@@ -30,6 +38,10 @@ const (
 	autoOffsetResetKey    = "auto.offset.reset"
 	autoOffsetReset       = "earliest"
 	enablePartitionEofKey = "enable.partition.eof"
+	enableAutoCommitKey   = "enable.auto.commit"
+	pollTimeoutMs         = 100
+	// laneBuffer is how many messages can wait for a busy worker lane.
+	laneBuffer = 100
 )
 
 func run(log *log.Logger) error {
@@ -42,18 +54,69 @@ func run(log *log.Logger) error {
 	if err != nil {
 		return errors.Wrap(err, "reading config")
 	}
+	// The pool grows while it cannot keep up with the topic, and
+	// shrinks back when idle. Its bounds are checked before anything
+	// starts; the rest is set once the pool exists.
+	var autoscaler *task.Autoscaler
+	if cfg.WorkerPoolMaxSize > 0 {
+		autoscaler = &task.Autoscaler{
+			Min:      cfg.WorkerPoolMinSize,
+			Max:      cfg.WorkerPoolMaxSize,
+			MaxLag:   cfg.WorkerAutoscaleMaxLag,
+			Interval: cfg.WorkerAutoscaleInterval,
+		}
+		if err := autoscaler.Validate(); err != nil {
+			return errors.Wrap(err, "invalid worker pool autoscaling settings")
+		}
+	}
 
 	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
 		bootstrapServersKey:   cfg.KafkaBrokerHost,
 		groupIdKey:            cfg.KafkaGroupId,
 		autoOffsetResetKey:    autoOffsetReset,
 		enablePartitionEofKey: false,
+		// Offsets are committed once the messages are processed.
+		enableAutoCommitKey: false,
 	})
 	if err != nil {
 		return errors.Wrapf(err, "connecting to broker %s", cfg.KafkaBrokerHost)
 	}
 
-	if err := consumer.SubscribeTopics([]string{cfg.KafkaTopic}, nil); err != nil {
+	offsets := offset.NewTracker()
+	// stuck holds the partitions paused because one of their messages
+	// failed and could not be dead-lettered.
+	var (
+		stuckMu sync.Mutex
+		stuck   = make(map[partitionKey]bool)
+	)
+	rebalance := func(c *kafka.Consumer, ev kafka.Event) error {
+		if e, ok := ev.(kafka.RevokedPartitions); ok {
+			// Commit what was processed before the partitions are handed over.
+			if err := offsets.Commit(c.CommitOffsets, e.Partitions...); err != nil {
+				log.Println(err)
+			}
+			offsets.Forget(e.Partitions)
+			stuckMu.Lock()
+			for _, tp := range e.Partitions {
+				delete(stuck, keyOf(tp))
+			}
+			stuckMu.Unlock()
+		}
+		return nil
+	}
+	// withoutStuck returns the partitions that are not stuck.
+	withoutStuck := func(partitions []kafka.TopicPartition) []kafka.TopicPartition {
+		stuckMu.Lock()
+		defer stuckMu.Unlock()
+		var resumable []kafka.TopicPartition
+		for _, tp := range partitions {
+			if !stuck[keyOf(tp)] {
+				resumable = append(resumable, tp)
+			}
+		}
+		return resumable
+	}
+	if err := consumer.SubscribeTopics([]string{cfg.KafkaTopic}, rebalance); err != nil {
 		return errors.Wrapf(err, "subscribing to topic %s", cfg.KafkaTopic)
 	}
 
@@ -61,6 +124,31 @@ func run(log *log.Logger) error {
 	if err != nil {
 		return errors.Wrapf(err, "connecting to mongodb")
 	}
+	if err := suspicioustransaction.EnsureIndexes(ctx, db); err != nil {
+		return errors.Wrap(err, "bootstrapping mongodb")
+	}
+	if err := accountbaseline.EnsureIndexes(ctx, db); err != nil {
+		return errors.Wrap(err, "bootstrapping mongodb")
+	}
+
+	var deadLetter *deadletter.Publisher
+	if cfg.KafkaDlqTopic != "" {
+		producer, err := kafka.NewProducer(&kafka.ConfigMap{
+			bootstrapServersKey: cfg.KafkaBrokerHost,
+		})
+		if err != nil {
+			return errors.Wrap(err, "creating dead-letter producer")
+		}
+		defer producer.Close()
+		go func() {
+			for e := range producer.Events() {
+				if err, ok := e.(kafka.Error); ok {
+					log.Println(errors.Wrap(err, "dead-letter producer"))
+				}
+			}
+		}()
+		deadLetter = &deadletter.Publisher{Producer: producer, Topic: cfg.KafkaDlqTopic}
+	}
 
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
@@ -71,61 +159,369 @@ func run(log *log.Logger) error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
-	maxGoRoutines := runtime.GOMAXPROCS(0)
-	pool := task.New(ctx, maxGoRoutines)
-
 	stats := &stats.KafkaConsumerStats{}
 	screen, err := screen.NewKafkaConsumerScreen(stats)
 	if err != nil {
 		return errors.New("starting screen")
 	}
 
+	dispatchKey, err := kafkaWorker.DispatchKeyFunc(cfg.WorkerDispatchKey)
+	if err != nil {
+		return errors.Wrap(err, "reading WORKER_DISPATCH_KEY")
+	}
+	// Workers stop retrying once workCtx is canceled, with ErrShutdown,
+	// which only happens if the shutdown deadline is exceeded.
+	workCtx, cancelWork := context.WithCancelCause(ctx)
+	defer cancelWork(nil)
+	poolSize := cfg.WorkerPoolSize
+	if poolSize <= 0 {
+		poolSize = runtime.GOMAXPROCS(0)
+	}
+	pool := task.New(workCtx, poolSize,
+		task.WithJobTimeout(cfg.WorkerJobTimeout),
+		task.WithLaneBuffer(laneBuffer),
+		task.WithPanicHandler(func(w task.Worker, err error) {
+			stats.IncrTotalWorkerPanics()
+			log.Println(err)
+			if kw, ok := w.(*kafkaWorker.Worker); ok {
+				kw.Fail(err)
+			}
+		}),
+	)
+
+	// closing guards the consumer against being used by the breaker
+	// while, or after, it is closed.
+	var (
+		closing sync.RWMutex
+		closed  bool
+	)
+	closeConsumer := func() error {
+		closing.Lock()
+		defer closing.Unlock()
+		if closed {
+			return nil
+		}
+		closed = true
+		return consumer.Close()
+	}
+
+	stats.UpdateDbBreakerState(breaker.Closed.String())
+	// While MongoDB is down, stop fetching messages instead of burning
+	// through them; the breaker lets a probe through after a while.
+	dbBreaker := breaker.New(cfg.MongodbBreakerFailureThreshold, cfg.MongodbBreakerOpenTimeout, func(from, to breaker.State) {
+		stats.UpdateDbBreakerState(to.String())
+		log.Printf("mongodb circuit breaker: %v -> %v", from, to)
+		if to != breaker.Open && from != breaker.Open {
+			return
+		}
+		closing.RLock()
+		defer closing.RUnlock()
+		if closed {
+			return
+		}
+		assignment, err := consumer.Assignment()
+		if err != nil {
+			log.Println(errors.Wrap(err, "getting assigned partitions"))
+			return
+		}
+		if to == breaker.Open {
+			err = consumer.Pause(assignment)
+		} else {
+			err = consumer.Resume(withoutStuck(assignment))
+		}
+		if err != nil {
+			log.Println(errors.Wrap(err, "pausing or resuming partitions"))
+		}
+	})
+	insertRetry := retry.Policy{
+		MaxAttempts:    cfg.MongodbInsertMaxAttempts,
+		InitialBackoff: cfg.MongodbInsertInitialBackoff,
+		MaxBackoff:     cfg.MongodbInsertMaxBackoff,
+	}
+
+	// Baselines of the stateful rules are written in bulk, every
+	// MONGODB_BATCH_INTERVAL, instead of on every transaction.
+	baselines := accountbaseline.NewBatchStore(db, cfg.MongodbBatchInterval,
+		accountbaseline.WithBulkWriteWrapper(kafkaWorker.BulkWriteGuard("account baselines", insertRetry, dbBreaker, stats, log)),
+		accountbaseline.WithErrorHandler(func(err error) {
+			log.Println(err)
+		}),
+	)
+	go baselines.Run(workCtx)
+
+	defaultRules := rules.Default()
+	ruleSet := func() *rules.RuleSet { return defaultRules }
+	if cfg.RulesFile != "" {
+		reloader, err := rules.NewReloader(cfg.RulesFile,
+			func(err error) {
+				if err != nil {
+					log.Println(errors.Wrap(err, "reloading rules, keeping the previous ones"))
+					return
+				}
+				log.Printf("rules reloaded from %s", cfg.RulesFile)
+			},
+			rules.WithBaselineStore(baselines),
+			rules.WithErrorHandler(func(err error) {
+				log.Println(err)
+			}),
+		)
+		if err != nil {
+			return errors.Wrap(err, "loading rules")
+		}
+		go reloader.Watch(ctx, cfg.RulesReloadInterval)
+		ruleSet = reloader.RuleSet
+	}
+
+	// Suspicious transactions are written in bulk; a message is only
+	// completed, and its offset committed, once its transaction is written.
+	var batch *suspicioustransaction.BatchWriter
+	if cfg.MongodbBatchSize > 1 {
+		batch = suspicioustransaction.NewBatchWriter(db, cfg.MongodbBatchSize, cfg.MongodbBatchInterval,
+			suspicioustransaction.WithBulkWriteWrapper(kafkaWorker.BulkWriteGuard("suspicious transactions", insertRetry, dbBreaker, stats, log)),
+			suspicioustransaction.WithFlushHandler(func(written, failed int) {
+				stats.IncrTotalBulkWrites()
+			}),
+		)
+		go batch.Run(workCtx)
+	}
+
+	// A partition with a message that could not be dead-lettered cannot
+	// have its offset committed past it, so fetching more of it would
+	// only pile up work: it is paused until it is consumed again, by this
+	// consumer after a restart, or by another after a rebalance.
+	onStuck := func(tp kafka.TopicPartition, err error) {
+		log.Printf("ALERT: partition stuck at %v, pausing it: %v", tp, err)
+		stuckMu.Lock()
+		stuck[keyOf(tp)] = true
+		stuckMu.Unlock()
+		closing.RLock()
+		defer closing.RUnlock()
+		if closed {
+			return
+		}
+		if err := consumer.Pause([]kafka.TopicPartition{tp}); err != nil {
+			log.Println(errors.Wrapf(err, "pausing partition %d", tp.Partition))
+		}
+	}
+
 	start := time.Now()
 
+	// Fetching, committing and refreshing the screen stop once
+	// fetchCtx is done, at the start of the shutdown.
+	fetchCtx, stopFetching := context.WithCancel(ctx)
+	defer stopFetching()
+	var background sync.WaitGroup
+
+	if autoscaler != nil {
+		autoscaler.Pool = pool
+		autoscaler.Lag = func() (int64, error) {
+			closing.RLock()
+			defer closing.RUnlock()
+			if closed {
+				return 0, nil
+			}
+			return consumerLag(consumer, offsets)
+		}
+		autoscaler.OnResize = func(from, to int, err error) {
+			if err != nil {
+				log.Println(errors.Wrapf(err, "resizing worker pool from %d to %d", from, to))
+				return
+			}
+			log.Printf("worker pool resized from %d to %d", from, to)
+		}
+		autoscaler.OnError = func(err error) {
+			log.Println(errors.Wrap(err, "getting consumer lag"))
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			autoscaler.Run(fetchCtx)
+		}()
+	}
+
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		for fetchCtx.Err() == nil {
+			switch e := consumer.Poll(pollTimeoutMs).(type) {
+			case *kafka.Message:
+				offsets.Track(e.TopicPartition)
+				kw := &kafkaWorker.Worker{
+					Msg:        e,
+					Stats:      stats,
+					Db:         db,
+					Rules:      ruleSet(),
+					Offsets:    offsets,
+					DeadLetter: deadLetter,
+					OnStuck:    onStuck,
+					Retry:      insertRetry,
+					Breaker:    dbBreaker,
+					Batch:      batch,
+					Log:        log,
+				}
+				// Messages with the same key are processed in order.
+				var err error
+				if key, ok := dispatchKey(e); ok {
+					err = pool.DoKeyContext(fetchCtx, key, kw)
+				} else {
+					err = pool.DoContext(fetchCtx, kw)
+				}
+				// Either shutdown started or the pool is gone.
+				if err != nil {
+					return
+				}
+			case kafka.Error:
+				// Most errors are transient and recovered from by the client.
+				if !e.IsFatal() {
+					log.Println(errors.Wrap(e, "consuming"))
+					continue
+				}
+				serverErrors <- errors.Wrap(e, "consuming")
+				return
+			}
+		}
+	}()
+
+	background.Add(1)
 	go func() {
-		defer close(shutdown)
-		defer close(serverErrors)
+		defer background.Done()
+		ticker := time.NewTicker(cfg.KafkaCommitInterval)
+		defer ticker.Stop()
 		for {
 			select {
-			case <-shutdown:
-				log.Printf("run: Start shutdown")
-				if err := consumer.Close(); err != nil {
-					serverErrors <- errors.Wrap(err, "closing Kafka consumer")
-				}
+			case <-fetchCtx.Done():
 				return
-			default:
-				msg, err := consumer.ReadMessage(-1)
-				if err != nil {
-					serverErrors <- err
-				} else {
-					kw := &kafkaWorker.Worker{Msg: msg, Stats: stats, Db: db, Log: log}
-					pool.Do(kw)
+			case <-ticker.C:
+				if err := offsets.Commit(consumer.CommitOffsets); err != nil {
+					log.Println(err)
 				}
 			}
 		}
 	}()
 
+	background.Add(1)
 	go func() {
+		defer background.Done()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
 		for {
-			time.Sleep(time.Second * time.Duration(1))
-			stats.UpdateElapsedTime(time.Since(start))
-			screen.UpdateContent(false)
+			select {
+			case <-fetchCtx.Done():
+				return
+			case <-ticker.C:
+				m := pool.Metrics()
+				stats.UpdatePool(m.Busy, m.Workers, m.QueueWait)
+				stats.UpdateElapsedTime(time.Since(start))
+				screen.UpdateContent(false)
+			}
 		}
 	}()
 
 	// Wait for any error or interrupt signal.
+	var runErr error
 	select {
-	case err := <-serverErrors:
-		return err
+	case runErr = <-serverErrors:
+		log.Printf("run: %v: Start shutdown", runErr)
 	case sig := <-shutdown:
-		screen.UpdateContent(true)
 		log.Printf("run: %v: Start shutdown", sig)
-		// Asking listener to shutdown and shed load.
-		if err := consumer.Close(); err != nil {
-			return errors.Wrap(err, "closing Kafka consumer")
+	}
+
+	// Asking listener to shutdown and shed load, then waiting up to
+	// the deadline for the messages in flight to be processed.
+	shutdownCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownTimeout)
+	defer cancel()
+	stopFetching()
+	// A resize of the pool in progress waits for its lanes to be drained.
+	stopped := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		log.Println(errors.Wrap(shutdownCtx.Err(), "stopping fetching; the messages in flight are consumed again after a restart"))
+		cancelWork(kafkaWorker.ErrShutdown)
+		<-stopped
+	}
+	if err := pool.ShutdownContext(shutdownCtx); err != nil {
+		log.Println(errors.Wrap(err, "draining workers; the messages in flight are consumed again after a restart"))
+		cancelWork(kafkaWorker.ErrShutdown)
+	}
+	if batch != nil {
+		flushed := make(chan struct{})
+		go func() {
+			batch.Flush(workCtx)
+			close(flushed)
+		}()
+		select {
+		case <-flushed:
+		case <-shutdownCtx.Done():
+			log.Println(errors.Wrap(shutdownCtx.Err(), "flushing bulk write; its messages are consumed again after a restart"))
+			cancelWork(kafkaWorker.ErrShutdown)
+			<-flushed
+		}
+	}
+	if err := baselines.Flush(shutdownCtx); err != nil {
+		log.Println(errors.Wrap(err, "flushing account baselines"))
+	}
+	if err := offsets.Commit(consumer.CommitOffsets); err != nil {
+		log.Println(err)
+	}
+	if err := closeConsumer(); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "closing Kafka consumer")
+	}
+	if err := db.Disconnect(shutdownCtx); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "disconnecting from mongodb")
+	}
+	stats.UpdateElapsedTime(time.Since(start))
+	if err := screen.UpdateContent(true); err != nil && runErr == nil {
+		runErr = errors.Wrap(err, "updating screen")
+	}
+	return runErr
+}
+
+// partitionKey identifies a partition of a topic.
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// keyOf returns the key of the partition of tp.
+func keyOf(tp kafka.TopicPartition) partitionKey {
+	var topic string
+	if tp.Topic != nil {
+		topic = *tp.Topic
+	}
+	return partitionKey{topic: topic, partition: tp.Partition}
+}
+
+// consumerLag returns how many messages of the assigned partitions
+// are not processed yet: the ones not fetched, and the ones in flight.
+func consumerLag(consumer *kafka.Consumer, offsets *offset.Tracker) (int64, error) {
+	assignment, err := consumer.Assignment()
+	if err != nil {
+		return 0, errors.Wrap(err, "getting assigned partitions")
+	}
+	positions, err := consumer.Position(assignment)
+	if err != nil {
+		return 0, errors.Wrap(err, "getting positions")
+	}
+	lag := int64(offsets.Pending())
+	for _, p := range positions {
+		// Nothing was fetched from the partition yet.
+		if p.Offset < 0 {
+			continue
+		}
+		_, high, err := consumer.GetWatermarkOffsets(*p.Topic, p.Partition)
+		if err != nil {
+			return 0, errors.Wrapf(err, "getting offsets of partition %d", p.Partition)
+		}
+		if high > int64(p.Offset) {
+			lag += high - int64(p.Offset)
 		}
-		return nil
 	}
+	return lag, nil
 }
 
 func main() {
@@ -0,0 +1,210 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package deadletter
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// Headers of a dead-lettered message.
+const (
+	ErrorHeader             = "dlq.error"
+	StageHeader             = "dlq.stage"
+	AttemptsHeader          = "dlq.attempts"
+	OriginalTopicHeader     = "dlq.original.topic"
+	OriginalPartitionHeader = "dlq.original.partition"
+	OriginalOffsetHeader    = "dlq.original.offset"
+	FailedAtHeader          = "dlq.failed_at"
+)
+
+// RedrivenHeader is the header of the markers published to the
+// dead-letter topic once a record is re-driven. Its value is the
+// offset of the record, which is in the partition of the marker.
+const RedrivenHeader = "dlq.redriven"
+
+// Stages at which processing a message can fail.
+const (
+	UnmarshalStage = "unmarshal"
+	PersistStage   = "persist"
+	PanicStage     = "panic"
+)
+
+// For ease of unit testing.
+var now = time.Now
+
+// Record is a dead-lettered message along with why it failed.
+type Record struct {
+	// Partition and Offset locate the record in the dead-letter topic.
+	Partition         int32
+	Offset            int64
+	Key               []byte
+	Value             []byte
+	Error             string
+	Stage             string
+	Attempts          int
+	OriginalTopic     string
+	OriginalPartition int32
+	OriginalOffset    int64
+	FailedAt          time.Time
+}
+
+// NewMessage creates the dead-letter message of msg, which failed at
+// the given stage, to be published to topic. The attempt count is one
+// more than the one of msg, if it was re-driven from the dead-letter topic.
+func NewMessage(topic string, msg *kafka.Message, stage string, err error) *kafka.Message {
+	attempts := 1
+	if v, ok := header(msg.Headers, AttemptsHeader); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			attempts = n + 1
+		}
+	}
+	var originalTopic string
+	if msg.TopicPartition.Topic != nil {
+		originalTopic = *msg.TopicPartition.Topic
+	}
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Headers: []kafka.Header{
+			{Key: ErrorHeader, Value: []byte(err.Error())},
+			{Key: StageHeader, Value: []byte(stage)},
+			{Key: AttemptsHeader, Value: []byte(strconv.Itoa(attempts))},
+			{Key: OriginalTopicHeader, Value: []byte(originalTopic)},
+			{Key: OriginalPartitionHeader, Value: []byte(strconv.Itoa(int(msg.TopicPartition.Partition)))},
+			{Key: OriginalOffsetHeader, Value: []byte(strconv.FormatInt(int64(msg.TopicPartition.Offset), 10))},
+			{Key: FailedAtHeader, Value: []byte(now().UTC().Format(time.RFC3339Nano))},
+		},
+	}
+}
+
+// Parse reads a message of the dead-letter topic.
+func Parse(msg *kafka.Message) (*Record, error) {
+	r := &Record{
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Key:       msg.Key,
+		Value:     msg.Value,
+	}
+	r.Error, _ = header(msg.Headers, ErrorHeader)
+	r.OriginalTopic, _ = header(msg.Headers, OriginalTopicHeader)
+	stage, ok := header(msg.Headers, StageHeader)
+	if !ok {
+		return nil, errors.Errorf("message at offset %d has no %s header", r.Offset, StageHeader)
+	}
+	r.Stage = stage
+	var err error
+	if r.Attempts, err = intHeader(msg.Headers, AttemptsHeader); err != nil {
+		return nil, err
+	}
+	partition, err := intHeader(msg.Headers, OriginalPartitionHeader)
+	if err != nil {
+		return nil, err
+	}
+	r.OriginalPartition = int32(partition)
+	offset, err := intHeader(msg.Headers, OriginalOffsetHeader)
+	if err != nil {
+		return nil, err
+	}
+	r.OriginalOffset = int64(offset)
+	if v, ok := header(msg.Headers, FailedAtHeader); ok {
+		if r.FailedAt, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s header", FailedAtHeader)
+		}
+	}
+	return r, nil
+}
+
+// RedriveMessage creates the message that re-drives the record to topic.
+// It keeps the attempt count, so a new failure is counted as a new attempt.
+func (r *Record) RedriveMessage(topic string) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            r.Key,
+		Value:          r.Value,
+		Headers: []kafka.Header{
+			{Key: AttemptsHeader, Value: []byte(strconv.Itoa(r.Attempts))},
+		},
+	}
+}
+
+// RedrivenMarker creates the message that marks the record as re-driven,
+// to be published to the dead-letter topic, in the partition of the record.
+func (r *Record) RedrivenMarker(topic string) *kafka.Message {
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: r.Partition},
+		Headers: []kafka.Header{
+			{Key: RedrivenHeader, Value: []byte(strconv.FormatInt(r.Offset, 10))},
+		},
+	}
+}
+
+// IsRedrivenMarker tells whether msg, read from the dead-letter topic,
+// marks a record as re-driven rather than being a record itself.
+func IsRedrivenMarker(msg *kafka.Message) bool {
+	_, ok := header(msg.Headers, RedrivenHeader)
+	return ok
+}
+
+// ParseRedrivenMarker returns the offset of the record that msg marks
+// as re-driven, in the partition of msg.
+func ParseRedrivenMarker(msg *kafka.Message) (int64, error) {
+	offset, err := intHeader(msg.Headers, RedrivenHeader)
+	return int64(offset), err
+}
+
+// Filter selects records. Zero fields match any record.
+type Filter struct {
+	Stage string
+	// Error matches records whose error contains it.
+	Error       string
+	Partition   *int32
+	MinAttempts int
+	Since       time.Time
+}
+
+// Match tells whether the record is selected by the filter.
+func (f Filter) Match(r *Record) bool {
+	switch {
+	case f.Stage != "" && r.Stage != f.Stage:
+		return false
+	case f.Error != "" && !strings.Contains(r.Error, f.Error):
+		return false
+	case f.Partition != nil && r.OriginalPartition != *f.Partition:
+		return false
+	case r.Attempts < f.MinAttempts:
+		return false
+	case !f.Since.IsZero() && r.FailedAt.Before(f.Since):
+		return false
+	}
+	return true
+}
+
+// header returns the value of the last header with the given key.
+func header(headers []kafka.Header, key string) (string, bool) {
+	for i := len(headers) - 1; i >= 0; i-- {
+		if headers[i].Key == key {
+			return string(headers[i].Value), true
+		}
+	}
+	return "", false
+}
+
+// intHeader returns the value of the header with the given key as an int.
+func intHeader(headers []kafka.Header, key string) (int, error) {
+	v, ok := header(headers, key)
+	if !ok {
+		return 0, errors.Errorf("missing %s header", key)
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing %s header", key)
+	}
+	return n, nil
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package deadletter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+var failedAt = time.Date(2023, 6, 5, 3, 5, 12, 0, time.UTC)
+
+func TestNewMessageAndParse(t *testing.T) {
+	now = func() time.Time { return failedAt }
+	topic := "transactions"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 42},
+		Key:            []byte("key"),
+		Value:          []byte("blabla"),
+	}
+	dlqMsg := NewMessage("transactions-dlq", msg, UnmarshalStage, errors.New("random error"))
+	require.Equal(t, "transactions-dlq", *dlqMsg.TopicPartition.Topic)
+	dlqMsg.TopicPartition.Partition = 0
+	dlqMsg.TopicPartition.Offset = 7
+
+	r, err := Parse(dlqMsg)
+	require.NoError(t, err)
+	require.Equal(t, &Record{
+		Partition:         0,
+		Offset:            7,
+		Key:               []byte("key"),
+		Value:             []byte("blabla"),
+		Error:             "random error",
+		Stage:             UnmarshalStage,
+		Attempts:          1,
+		OriginalTopic:     "transactions",
+		OriginalPartition: 2,
+		OriginalOffset:    42,
+		FailedAt:          failedAt,
+	}, r)
+
+	// A re-driven message that fails again counts one more attempt.
+	redriven := r.RedriveMessage("transactions")
+	require.Equal(t, "transactions", *redriven.TopicPartition.Topic)
+	redriven.TopicPartition.Offset = 43
+	r, err = Parse(NewMessage("transactions-dlq", redriven, PersistStage, errors.New("db down")))
+	require.NoError(t, err)
+	require.Equal(t, 2, r.Attempts)
+	require.Equal(t, PersistStage, r.Stage)
+	require.Equal(t, int64(43), r.OriginalOffset)
+}
+
+func TestRedrivenMarker(t *testing.T) {
+	r := &Record{Partition: 2, Offset: 7}
+	marker := r.RedrivenMarker("transactions-dlq")
+	require.Equal(t, "transactions-dlq", *marker.TopicPartition.Topic)
+	require.Equal(t, int32(2), marker.TopicPartition.Partition)
+	require.True(t, IsRedrivenMarker(marker))
+	offset, err := ParseRedrivenMarker(marker)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), offset)
+
+	require.False(t, IsRedrivenMarker(NewMessage("transactions-dlq", new(kafka.Message), PersistStage, errors.New("db down"))))
+	_, err = ParseRedrivenMarker(&kafka.Message{Headers: []kafka.Header{{Key: RedrivenHeader, Value: []byte("x")}}})
+	require.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		headers       []kafka.Header
+		expectedError error
+	}{
+		{
+			name:          "not a dead-letter message",
+			expectedError: errors.New("message at offset 7 has no dlq.stage header"),
+		},
+		{
+			name: "invalid attempts",
+			headers: []kafka.Header{
+				{Key: StageHeader, Value: []byte(PersistStage)},
+				{Key: AttemptsHeader, Value: []byte("x")},
+			},
+			expectedError: errors.New(`parsing dlq.attempts header: strconv.Atoi: parsing "x": invalid syntax`),
+		},
+		{
+			name: "missing original partition",
+			headers: []kafka.Header{
+				{Key: StageHeader, Value: []byte(PersistStage)},
+				{Key: AttemptsHeader, Value: []byte("1")},
+			},
+			expectedError: errors.New("missing dlq.original.partition header"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(&kafka.Message{TopicPartition: kafka.TopicPartition{Offset: 7}, Headers: tc.headers})
+			require.EqualError(t, err, tc.expectedError.Error())
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	partition := int32(1)
+	r := &Record{Stage: PersistStage, Error: "server selection timeout", Attempts: 2, OriginalPartition: 1, FailedAt: failedAt}
+	testCases := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{name: "empty", expected: true},
+		{name: "stage", filter: Filter{Stage: PersistStage}, expected: true},
+		{name: "other stage", filter: Filter{Stage: UnmarshalStage}},
+		{name: "error", filter: Filter{Error: "timeout"}, expected: true},
+		{name: "other error", filter: Filter{Error: "invalid character"}},
+		{name: "partition", filter: Filter{Partition: &partition}, expected: true},
+		{name: "attempts", filter: Filter{MinAttempts: 3}},
+		{name: "since", filter: Filter{Since: failedAt.Add(time.Second)}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.filter.Match(r))
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mockProduce   func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				deliveryChan <- msg
+				return nil
+			},
+		},
+		{
+			name: "error when producing",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				return errors.New("random error")
+			},
+			expectedError: errors.New("producing to topic transactions-dlq: random error"),
+		},
+		{
+			name: "error when delivering",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				msg.TopicPartition.Error = errors.New("random error")
+				deliveryChan <- msg
+				return nil
+			},
+			expectedError: errors.New("delivering to topic transactions-dlq: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			produce = tc.mockProduce
+			p := &Publisher{Topic: "transactions-dlq"}
+			err := p.Publish(&kafka.Message{Value: []byte("blabla")}, UnmarshalStage, errors.New("random error"))
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+			}
+		})
+	}
+}
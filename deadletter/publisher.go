@@ -0,0 +1,40 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package deadletter
+
+import (
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// For ease of unit testing.
+var produce = func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	return p.Produce(msg, deliveryChan)
+}
+
+// Publisher publishes the messages that failed to be processed
+// to the dead-letter topic.
+type Publisher struct {
+	Producer *kafka.Producer
+	Topic    string
+}
+
+// Publish publishes msg, which failed at the given stage, to the
+// dead-letter topic and waits until it is delivered, so the offset
+// of msg is only committed once the dead-letter topic has it.
+func (p *Publisher) Publish(msg *kafka.Message, stage string, cause error) error {
+	delivery := make(chan kafka.Event, 1)
+	if err := produce(p.Producer, NewMessage(p.Topic, msg, stage, cause), delivery); err != nil {
+		return errors.Wrapf(err, "producing to topic %s", p.Topic)
+	}
+	e := <-delivery
+	m, ok := e.(*kafka.Message)
+	if !ok {
+		return errors.Errorf("unexpected delivery event: %v", e)
+	}
+	if m.TopicPartition.Error != nil {
+		return errors.Wrapf(m.TopicPartition.Error, "delivering to topic %s", p.Topic)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/config"
+	"github.com/tiagomelo/realtime-data-kafka/deadletter"
+)
+
+// Useful constants.
+const (
+	bootstrapServersKey = "bootstrap.servers"
+	groupIdKey          = "group.id"
+	enableAutoCommitKey = "enable.auto.commit"
+	timeoutMs           = 10_000
+	maxValueLength      = 60
+)
+
+// For ease of unit testing.
+var now = time.Now
+
+// filterOptions are the options selecting the dead-lettered messages.
+type filterOptions struct {
+	Stage       string `long:"stage" description:"Only messages that failed at this stage" choice:"unmarshal" choice:"persist" choice:"panic"`
+	Error       string `long:"error" description:"Only messages whose error contains this text"`
+	Partition   *int32 `long:"partition" description:"Only messages from this partition of the original topic"`
+	MinAttempts int    `long:"min-attempts" description:"Only messages that failed at least this many times"`
+	Since       string `long:"since" description:"Only messages that failed after this time, as RFC 3339 or as a duration ago, like 1h"`
+	Redriven    bool   `long:"redriven" description:"Also messages that were already re-driven"`
+}
+
+// filter builds the Filter of the options.
+func (o *filterOptions) filter() (deadletter.Filter, error) {
+	f := deadletter.Filter{
+		Stage:       o.Stage,
+		Error:       o.Error,
+		Partition:   o.Partition,
+		MinAttempts: o.MinAttempts,
+	}
+	if o.Since == "" {
+		return f, nil
+	}
+	if d, err := time.ParseDuration(o.Since); err == nil {
+		f.Since = now().Add(-d)
+		return f, nil
+	}
+	since, err := time.Parse(time.RFC3339, o.Since)
+	if err != nil {
+		return f, errors.Errorf("invalid --since %q: expected RFC 3339 time or duration", o.Since)
+	}
+	f.Since = since
+	return f, nil
+}
+
+// listCommand holds the options of the list command.
+type listCommand struct {
+	filterOptions
+	Full bool `long:"full" description:"Print the whole message values"`
+}
+
+// redriveCommand holds the options of the redrive command.
+type redriveCommand struct {
+	filterOptions
+	Topic  string `long:"topic" description:"Topic to re-drive the messages to; KAFKA_TOPIC if not set"`
+	DryRun bool   `long:"dry-run" description:"Only print the messages that would be re-driven"`
+}
+
+// scan calls fn with every message of the dead-letter topic, from the
+// beginning up to its end at the time of the call.
+func scan(cfg *config.Config, fn func(msg *kafka.Message)) error {
+	topic := cfg.KafkaDlqTopic
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		bootstrapServersKey: cfg.KafkaBrokerHost,
+		groupIdKey:          cfg.KafkaGroupId + "-dlq",
+		enableAutoCommitKey: false,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "connecting to broker %s", cfg.KafkaBrokerHost)
+	}
+	defer consumer.Close()
+	md, err := consumer.GetMetadata(&topic, false, timeoutMs)
+	if err != nil {
+		return errors.Wrapf(err, "getting metadata of topic %s", topic)
+	}
+	var assignment []kafka.TopicPartition
+	ends := make(map[int32]kafka.Offset)
+	for _, p := range md.Topics[topic].Partitions {
+		low, high, err := consumer.QueryWatermarkOffsets(topic, p.ID, timeoutMs)
+		if err != nil {
+			return errors.Wrapf(err, "querying offsets of partition %d", p.ID)
+		}
+		if high > low {
+			assignment = append(assignment, kafka.TopicPartition{Topic: &topic, Partition: p.ID, Offset: kafka.Offset(low)})
+			ends[p.ID] = kafka.Offset(high)
+		}
+	}
+	if err := consumer.Assign(assignment); err != nil {
+		return errors.Wrapf(err, "assigning partitions of topic %s", topic)
+	}
+	for len(ends) > 0 {
+		switch e := consumer.Poll(timeoutMs).(type) {
+		case nil:
+			return errors.Errorf("timed out reading topic %s", topic)
+		case kafka.Error:
+			return errors.Wrapf(e, "reading topic %s", topic)
+		case *kafka.Message:
+			if e.TopicPartition.Offset+1 >= ends[e.TopicPartition.Partition] {
+				delete(ends, e.TopicPartition.Partition)
+			}
+			fn(e)
+		}
+	}
+	return nil
+}
+
+// printRecords prints the records as a table.
+func printRecords(out io.Writer, records []*deadletter.Record, full bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PARTITION\tOFFSET\tFAILED AT\tSTAGE\tATTEMPTS\tORIGIN\tERROR\tVALUE")
+	for _, r := range records {
+		value := string(r.Value)
+		if !full && len(value) > maxValueLength {
+			value = value[:maxValueLength] + "..."
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%d\t%s/%d@%d\t%s\t%s\n",
+			r.Partition, r.Offset, r.FailedAt.Format(time.RFC3339), r.Stage, r.Attempts,
+			r.OriginalTopic, r.OriginalPartition, r.OriginalOffset,
+			strings.ReplaceAll(r.Error, "\t", " "), value)
+	}
+	w.Flush()
+}
+
+// position locates a record in the dead-letter topic.
+type position struct {
+	partition int32
+	offset    int64
+}
+
+// selection gathers the records read from the dead-letter topic that
+// match the filter. The records marked as re-driven are left out,
+// unless redriven is set. Malformed messages are reported to warn
+// and skipped.
+type selection struct {
+	filter   deadletter.Filter
+	redriven bool
+	warn     io.Writer
+	records  []*deadletter.Record
+	marked   map[position]bool
+}
+
+// add reads a message of the dead-letter topic.
+func (s *selection) add(msg *kafka.Message) {
+	if deadletter.IsRedrivenMarker(msg) {
+		offset, err := deadletter.ParseRedrivenMarker(msg)
+		if err != nil {
+			fmt.Fprintf(s.warn, "skipping malformed message at partition %d offset %d: %v\n", msg.TopicPartition.Partition, msg.TopicPartition.Offset, err)
+			return
+		}
+		if s.marked == nil {
+			s.marked = make(map[position]bool)
+		}
+		s.marked[position{msg.TopicPartition.Partition, offset}] = true
+		return
+	}
+	r, err := deadletter.Parse(msg)
+	if err != nil {
+		fmt.Fprintf(s.warn, "skipping malformed message at partition %d offset %d: %v\n", msg.TopicPartition.Partition, msg.TopicPartition.Offset, err)
+		return
+	}
+	if s.filter.Match(r) {
+		s.records = append(s.records, r)
+	}
+}
+
+// result returns the selected records. Since a record is marked after
+// it, it must only be called once all the messages were added.
+func (s *selection) result() []*deadletter.Record {
+	if s.redriven {
+		return s.records
+	}
+	var records []*deadletter.Record
+	for _, r := range s.records {
+		if !s.marked[position{r.Partition, r.Offset}] {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// selectRecords reads the records of the dead-letter topic matching the
+// filter options, reporting the malformed messages to warn.
+func selectRecords(cfg *config.Config, o *filterOptions, warn io.Writer) ([]*deadletter.Record, error) {
+	f, err := o.filter()
+	if err != nil {
+		return nil, err
+	}
+	s := &selection{filter: f, redriven: o.Redriven, warn: warn}
+	if err := scan(cfg, s.add); err != nil {
+		return nil, err
+	}
+	return s.result(), nil
+}
+
+// redrive publishes the records back to the topic, waiting for each
+// delivery, and marks each of them as re-driven in the dead-letter topic.
+func redrive(cfg *config.Config, topic string, records []*deadletter.Record) error {
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{
+		bootstrapServersKey: cfg.KafkaBrokerHost,
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating producer")
+	}
+	defer producer.Close()
+	delivery := make(chan kafka.Event, 1)
+	produce := func(msg *kafka.Message) error {
+		if err := producer.Produce(msg, delivery); err != nil {
+			return err
+		}
+		if m, ok := (<-delivery).(*kafka.Message); ok && m.TopicPartition.Error != nil {
+			return m.TopicPartition.Error
+		}
+		return nil
+	}
+	for _, r := range records {
+		if err := produce(r.RedriveMessage(topic)); err != nil {
+			return errors.Wrapf(err, "re-driving message at partition %d offset %d", r.Partition, r.Offset)
+		}
+		if err := produce(r.RedrivenMarker(cfg.KafkaDlqTopic)); err != nil {
+			return errors.Wrapf(err, "marking message at partition %d offset %d as re-driven; it may be re-driven again", r.Partition, r.Offset)
+		}
+	}
+	return nil
+}
+
+func run(args []string, out io.Writer) error {
+	const envFile = ".env"
+	var (
+		listCmd    listCommand
+		redriveCmd redriveCommand
+		options    struct{}
+	)
+	parser := flags.NewParser(&options, flags.Default)
+	if _, err := parser.AddCommand("list", "List dead-lettered messages", "Lists the messages of the dead-letter topic that match the filters.", &listCmd); err != nil {
+		return err
+	}
+	if _, err := parser.AddCommand("redrive", "Re-drive dead-lettered messages", "Publishes the messages of the dead-letter topic that match the filters back to the main topic.", &redriveCmd); err != nil {
+		return err
+	}
+	if _, err := parser.ParseArgs(args[1:]); err != nil {
+		return err
+	}
+	cfg, err := config.Read(envFile)
+	if err != nil {
+		return errors.Wrap(err, "reading config")
+	}
+	if cfg.KafkaDlqTopic == "" {
+		return errors.New("KAFKA_DLQ_TOPIC is not set")
+	}
+	switch parser.Active.Name {
+	case "list":
+		records, err := selectRecords(cfg, &listCmd.filterOptions, os.Stderr)
+		if err != nil {
+			return err
+		}
+		printRecords(out, records, listCmd.Full)
+		fmt.Fprintf(out, "\n%d messages\n", len(records))
+	case "redrive":
+		records, err := selectRecords(cfg, &redriveCmd.filterOptions, os.Stderr)
+		if err != nil {
+			return err
+		}
+		topic := redriveCmd.Topic
+		if topic == "" {
+			topic = cfg.KafkaTopic
+		}
+		printRecords(out, records, false)
+		if redriveCmd.DryRun {
+			fmt.Fprintf(out, "\n%d messages would be re-driven to topic %s\n", len(records), topic)
+			return nil
+		}
+		if err := redrive(cfg, topic, records); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "\n%d messages re-driven to topic %s\n", len(records), topic)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		// The parser already printed its own errors.
+		if _, ok := err.(*flags.Error); !ok {
+			fmt.Println(err)
+		}
+		os.Exit(1)
+	}
+}
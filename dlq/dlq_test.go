@@ -0,0 +1,151 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/deadletter"
+)
+
+func TestFilterOptions(t *testing.T) {
+	current := time.Date(2023, 6, 5, 3, 0, 0, 0, time.UTC)
+	now = func() time.Time { return current }
+	partition := int32(2)
+	testCases := []struct {
+		name           string
+		options        filterOptions
+		expectedFilter deadletter.Filter
+		expectedError  error
+	}{
+		{
+			name:           "no since",
+			options:        filterOptions{Stage: deadletter.PersistStage, Error: "timeout", Partition: &partition, MinAttempts: 2},
+			expectedFilter: deadletter.Filter{Stage: deadletter.PersistStage, Error: "timeout", Partition: &partition, MinAttempts: 2},
+		},
+		{
+			name:           "since duration",
+			options:        filterOptions{Since: "1h"},
+			expectedFilter: deadletter.Filter{Since: current.Add(-time.Hour)},
+		},
+		{
+			name:           "since time",
+			options:        filterOptions{Since: "2023-06-04T00:00:00Z"},
+			expectedFilter: deadletter.Filter{Since: time.Date(2023, 6, 4, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:          "invalid since",
+			options:       filterOptions{Since: "yesterday"},
+			expectedError: errors.New(`invalid --since "yesterday": expected RFC 3339 time or duration`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := tc.options.filter()
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedFilter, f)
+			}
+		})
+	}
+}
+
+func TestPrintRecords(t *testing.T) {
+	records := []*deadletter.Record{
+		{
+			Partition:         0,
+			Offset:            3,
+			Value:             []byte(`{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal"}`),
+			Error:             "server selection error",
+			Stage:             deadletter.PersistStage,
+			Attempts:          2,
+			OriginalTopic:     "transactions",
+			OriginalPartition: 1,
+			OriginalOffset:    42,
+			FailedAt:          time.Date(2023, 6, 5, 3, 5, 12, 0, time.UTC),
+		},
+	}
+	var out bytes.Buffer
+	printRecords(&out, records, false)
+	expected := `PARTITION  OFFSET  FAILED AT             STAGE    ATTEMPTS  ORIGIN             ERROR                   VALUE
+0          3       2023-06-05T03:05:12Z  persist  2         transactions/1@42  server selection error  {"transaction_id":5699757367,"account_number":215489034,"tra...
+`
+	require.Equal(t, expected, out.String())
+}
+
+func TestSelection(t *testing.T) {
+	topic := "transactions"
+	dlqTopic := "transactions-dlq"
+	record := func(partition int32, offset kafka.Offset, stage string) *kafka.Message {
+		msg := deadletter.NewMessage(dlqTopic, &kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 42},
+			Value:          []byte("blabla"),
+		}, stage, errors.New("random error"))
+		msg.TopicPartition.Partition = partition
+		msg.TopicPartition.Offset = offset
+		return msg
+	}
+	marker := func(partition int32, offset int64, at kafka.Offset) *kafka.Message {
+		msg := (&deadletter.Record{Partition: partition, Offset: offset}).RedrivenMarker(dlqTopic)
+		msg.TopicPartition.Offset = at
+		return msg
+	}
+	messages := []*kafka.Message{
+		record(0, 0, deadletter.PersistStage),
+		record(0, 1, deadletter.UnmarshalStage),
+		{TopicPartition: kafka.TopicPartition{Topic: &dlqTopic, Partition: 0, Offset: 2}, Value: []byte("malformed")},
+		record(1, 0, deadletter.PersistStage),
+		marker(0, 0, 3),
+		record(0, 4, deadletter.PersistStage),
+	}
+	testCases := []struct {
+		name            string
+		filter          deadletter.Filter
+		redriven        bool
+		expectedRecords []string
+	}{
+		{
+			name:            "not re-driven",
+			expectedRecords: []string{"0@1", "1@0", "0@4"},
+		},
+		{
+			name:            "with re-driven",
+			redriven:        true,
+			expectedRecords: []string{"0@0", "0@1", "1@0", "0@4"},
+		},
+		{
+			name:            "filtered",
+			filter:          deadletter.Filter{Stage: deadletter.PersistStage},
+			expectedRecords: []string{"1@0", "0@4"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var warn bytes.Buffer
+			s := &selection{filter: tc.filter, redriven: tc.redriven, warn: &warn}
+			for _, msg := range messages {
+				s.add(msg)
+			}
+			var records []string
+			for _, r := range s.result() {
+				records = append(records, fmt.Sprintf("%d@%d", r.Partition, r.Offset))
+			}
+			require.Equal(t, tc.expectedRecords, records)
+			require.Equal(t, "skipping malformed message at partition 0 offset 2: message at offset 2 has no dlq.stage header\n", warn.String())
+		})
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// options holds the command-line options.
+type options struct {
+	Files []string `short:"f" long:"file" description:"Labeled input file or glob pattern, like sampledata/*.json; may be repeated" required:"true"`
+	Rules string   `short:"r" long:"rules" description:"Rules file; the default rules are used if not set"`
+}
+
+// confusion is a confusion matrix of the verdicts against the labels.
+type confusion struct {
+	truePositives, falsePositives, trueNegatives, falseNegatives int
+}
+
+// add records a verdict against its label.
+func (c *confusion) add(flagged, isFraud bool) {
+	switch {
+	case flagged && isFraud:
+		c.truePositives++
+	case flagged:
+		c.falsePositives++
+	case isFraud:
+		c.falseNegatives++
+	default:
+		c.trueNegatives++
+	}
+}
+
+// precision is the share of the flagged transactions that are frauds.
+func (c *confusion) precision() float64 {
+	return ratio(c.truePositives, c.truePositives+c.falsePositives)
+}
+
+// recall is the share of the frauds that were flagged.
+func (c *confusion) recall() float64 {
+	return ratio(c.truePositives, c.truePositives+c.falseNegatives)
+}
+
+// f1 is the harmonic mean of precision and recall.
+func (c *confusion) f1() float64 {
+	p, r := c.precision(), c.recall()
+	if p+r == 0 {
+		return 0
+	}
+	return 2 * p * r / (p + r)
+}
+
+// scenarioResult holds the outcome of the transactions of a scenario.
+type scenarioResult struct {
+	total, fraud, flagged, detected int
+}
+
+// loadRules loads the rules file, or the default rules if path is empty.
+// Baselines are kept in memory, so no MongoDB is needed.
+func loadRules(path string) (*rules.RuleSet, error) {
+	if path == "" {
+		return rules.Default(), nil
+	}
+	rs, err := rules.Load(path, rules.WithBaselineStore(rules.NewMemoryBaselineStore()))
+	if err != nil {
+		return nil, errors.Wrap(err, "loading rules")
+	}
+	return rs, nil
+}
+
+func run(args []string, out io.Writer) error {
+	var opts options
+	if _, err := flags.ParseArgs(&opts, args); err != nil {
+		return err
+	}
+	txs, invalid, err := transaction.ReadFiles(opts.Files)
+	if err != nil {
+		return err
+	}
+	ruleSet, err := loadRules(opts.Rules)
+	if err != nil {
+		return err
+	}
+	// Scenarios are written by concurrent workers, so the files are not
+	// in time order, which the stateful rules depend on.
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].TransactionTime.Before(txs[j].TransactionTime)
+	})
+	var (
+		matrix     confusion
+		unlabeled  int
+		byScenario = make(map[string]*scenarioResult)
+	)
+	for _, t := range txs {
+		if t.Scenario == "" {
+			unlabeled++
+			continue
+		}
+		flagged := ruleSet.Assess(&t.Transaction).Suspicious()
+		matrix.add(flagged, t.IsFraud)
+		s, ok := byScenario[t.Scenario]
+		if !ok {
+			s = &scenarioResult{}
+			byScenario[t.Scenario] = s
+		}
+		s.total++
+		if t.IsFraud {
+			s.fraud++
+		}
+		if flagged {
+			s.flagged++
+			if t.IsFraud {
+				s.detected++
+			}
+		}
+	}
+	if unlabeled == len(txs) {
+		return errors.New("no labeled transactions found; generate them with jsongenerator --scenario or --labels")
+	}
+	fmt.Fprintf(out, "Transactions: %d\n", len(txs))
+	fmt.Fprintf(out, "Invalid lines: %d\n", invalid)
+	fmt.Fprintf(out, "Unlabeled: %d\n\n", unlabeled)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tPREDICTED FRAUD\tPREDICTED LEGIT")
+	fmt.Fprintf(w, "ACTUAL FRAUD\t%d\t%d\n", matrix.truePositives, matrix.falseNegatives)
+	fmt.Fprintf(w, "ACTUAL LEGIT\t%d\t%d\n", matrix.falsePositives, matrix.trueNegatives)
+	w.Flush()
+
+	fmt.Fprintf(out, "\nPrecision: %.4f\n", matrix.precision())
+	fmt.Fprintf(out, "Recall: %.4f\n", matrix.recall())
+	fmt.Fprintf(out, "F1: %.4f\n\n", matrix.f1())
+
+	names := make([]string, 0, len(byScenario))
+	for name := range byScenario {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCENARIO\tTRANSACTIONS\tFRAUD\tFLAGGED\tRECALL")
+	for _, name := range names {
+		s := byScenario[name]
+		recall := "-"
+		if s.fraud > 0 {
+			recall = fmt.Sprintf("%.4f", ratio(s.detected, s.fraud))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", name, s.total, s.fraud, s.flagged, recall)
+	}
+	w.Flush()
+	return nil
+}
+
+// ratio returns n / total, or 0 if total is 0.
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func main() {
+	if err := run(os.Args, os.Stdout); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
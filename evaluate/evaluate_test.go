@@ -0,0 +1,89 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const transactions = `{"transaction_id":1,"account_number":1,"transaction_type":"withdrawal","transaction_amount":500,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX","is_fraud":false,"scenario":"normal"}
+{"transaction_id":2,"account_number":2,"transaction_type":"withdrawal","transaction_amount":12000,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX","is_fraud":false,"scenario":"normal"}
+invalid line
+{"transaction_id":3,"account_number":3,"transaction_type":"withdrawal","transaction_amount":9500,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Austin, TX","is_fraud":true,"scenario":"structuring"}
+{"transaction_id":4,"account_number":4,"transaction_type":"withdrawal","transaction_amount":300,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Austin, TX","is_fraud":false,"scenario":"account_takeover"}
+{"transaction_id":5,"account_number":4,"transaction_type":"withdrawal","transaction_amount":15000,"transaction_time":"2023-06-05T04:05:12.495058-03:00","location":"Seattle, WA","is_fraud":true,"scenario":"account_takeover"}
+{"transaction_id":6,"account_number":5,"transaction_type":"withdrawal","transaction_amount":15000,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Austin, TX"}
+`
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	labeled := write("labeled.json", transactions)
+	unlabeled := write("unlabeled.json", `{"transaction_id":6,"account_number":5,"transaction_amount":15000}`)
+	testCases := []struct {
+		name           string
+		args           []string
+		expectedOutput string
+		expectedError  error
+	}{
+		{
+			name: "happy path",
+			args: []string{"evaluate", "-f", labeled},
+			expectedOutput: `Transactions: 6
+Invalid lines: 1
+Unlabeled: 1
+
+              PREDICTED FRAUD  PREDICTED LEGIT
+ACTUAL FRAUD  1                1
+ACTUAL LEGIT  1                2
+
+Precision: 0.5000
+Recall: 0.5000
+F1: 0.5000
+
+SCENARIO          TRANSACTIONS  FRAUD  FLAGGED  RECALL
+account_takeover  2             1      1        1.0000
+normal            2             0      1        -
+structuring       1             1      0        0.0000
+`,
+		},
+		{
+			name:          "no labels",
+			args:          []string{"evaluate", "-f", unlabeled},
+			expectedError: errors.New("no labeled transactions found; generate them with jsongenerator --scenario or --labels"),
+		},
+		{
+			name:          "invalid rules file",
+			args:          []string{"evaluate", "-f", labeled, "-r", filepath.Join(dir, "missing.json")},
+			expectedError: errors.New("loading rules: reading rules file " + filepath.Join(dir, "missing.json") + ": open " + filepath.Join(dir, "missing.json") + ": no such file or directory"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := run(tc.args, &out)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedOutput, out.String())
+			}
+		})
+	}
+}
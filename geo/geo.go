@@ -0,0 +1,98 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package geo
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Gazetteer.
+var (
+	//go:embed cities.csv
+	citiesCsv string
+)
+
+// earthRadiusKm is the mean radius of the Earth, in kilometers.
+const earthRadiusKm = 6371.0
+
+// Coordinates represents a point on the Earth.
+type Coordinates struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// cities maps city names, like "New York, NY", to their coordinates.
+var cities = mustParseCities(citiesCsv)
+
+// Lookup returns the coordinates of the given city.
+func Lookup(city string) (Coordinates, bool) {
+	c, ok := cities[city]
+	return c, ok
+}
+
+// Cities returns a sorted list of the cities of the gazetteer.
+func Cities() []string {
+	names := make([]string, 0, len(cities))
+	for name := range cities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DistanceKm returns the great-circle distance between two points,
+// in kilometers, using the haversine formula.
+func DistanceKm(a, b Coordinates) float64 {
+	lat1 := radians(a.Latitude)
+	lat2 := radians(b.Latitude)
+	dLat := lat2 - lat1
+	dLon := radians(b.Longitude - a.Longitude)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// radians converts degrees to radians.
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+// mustParseCities parses the embedded gazetteer, panicking if it is invalid.
+func mustParseCities(data string) map[string]Coordinates {
+	c, err := parseCities(data)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// parseCities parses a gazetteer in the "name,latitude,longitude" CSV format.
+func parseCities(data string) (map[string]Coordinates, error) {
+	records, err := csv.NewReader(strings.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading gazetteer")
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty gazetteer")
+	}
+	c := make(map[string]Coordinates, len(records)-1)
+	for _, r := range records[1:] {
+		lat, err := strconv.ParseFloat(r[1], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing latitude of %s", r[0])
+		}
+		lon, err := strconv.ParseFloat(r[2], 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing longitude of %s", r[0])
+		}
+		c[r[0]] = Coordinates{Latitude: lat, Longitude: lon}
+	}
+	return c, nil
+}
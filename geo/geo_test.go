@@ -0,0 +1,72 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package geo
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	c, ok := Lookup("New York, NY")
+	require.True(t, ok)
+	require.Equal(t, Coordinates{Latitude: 40.7128, Longitude: -74.0060}, c)
+	_, ok = Lookup("Atlantis")
+	require.False(t, ok)
+	require.Contains(t, Cities(), "Seattle, WA")
+}
+
+func TestDistanceKm(t *testing.T) {
+	ny, _ := Lookup("New York, NY")
+	la, _ := Lookup("Los Angeles, CA")
+	require.InDelta(t, 3936, DistanceKm(ny, la), 5)
+	require.InDelta(t, 3936, DistanceKm(la, ny), 5)
+	require.Zero(t, DistanceKm(ny, ny))
+}
+
+func TestParseCities(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedError error
+	}{
+		{
+			name:  "happy path",
+			input: "name,latitude,longitude\n\"Austin, TX\",30.2672,-97.7431\n",
+		},
+		{
+			name:          "empty",
+			input:         "",
+			expectedError: errors.New("empty gazetteer"),
+		},
+		{
+			name:          "invalid latitude",
+			input:         "name,latitude,longitude\n\"Austin, TX\",north,-97.7431\n",
+			expectedError: errors.New(`parsing latitude of Austin, TX: strconv.ParseFloat: parsing "north": invalid syntax`),
+		},
+		{
+			name:          "invalid longitude",
+			input:         "name,latitude,longitude\n\"Austin, TX\",30.2672,west\n",
+			expectedError: errors.New(`parsing longitude of Austin, TX: strconv.ParseFloat: parsing "west": invalid syntax`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := parseCities(tc.input)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Len(t, c, 1)
+			}
+		})
+	}
+}
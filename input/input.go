@@ -0,0 +1,136 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package input
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/checkpoint"
+)
+
+// Stdin is the name of the standard input.
+const Stdin = "-"
+
+// For ease of unit testing.
+var stdin io.Reader = os.Stdin
+
+// Expand expands the names into the files to read, in order. A name is
+// either Stdin, a file, a directory, whose files are read in lexical
+// order, or a glob pattern, whose matches are read in lexical order.
+// The checkpoints in a directory, or matching a pattern, are not read.
+func Expand(names []string) ([]string, error) {
+	var files []string
+	for _, name := range names {
+		if name == Stdin {
+			files = append(files, name)
+			continue
+		}
+		info, err := os.Stat(name)
+		switch {
+		case err == nil && info.IsDir():
+			entries, err := os.ReadDir(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading directory %s", name)
+			}
+			// ReadDir sorts the entries by name.
+			for _, e := range entries {
+				if e.Type().IsRegular() && !checkpoint.IsCheckpoint(e.Name()) {
+					files = append(files, filepath.Join(name, e.Name()))
+				}
+			}
+		case err == nil:
+			files = append(files, name)
+		case strings.ContainsAny(name, "*?["):
+			matches, err := filepath.Glob(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "expanding %s", name)
+			}
+			if len(matches) == 0 {
+				return nil, errors.Errorf("no file matches %s", name)
+			}
+			sort.Strings(matches)
+			for _, m := range matches {
+				if !checkpoint.IsCheckpoint(m) {
+					files = append(files, m)
+				}
+			}
+		default:
+			return nil, errors.Wrapf(err, "reading %s", name)
+		}
+	}
+	return files, nil
+}
+
+// Open opens the file, or the standard input if name is Stdin. Files
+// ending in .gz or .zst are decompressed as they are read.
+func Open(name string) (io.ReadCloser, error) {
+	if name == Stdin {
+		return io.NopCloser(stdin), nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "opening file %s", name)
+	}
+	switch filepath.Ext(name) {
+	case ".gz":
+		r, err := gzip.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "decompressing file %s", name)
+		}
+		return &readCloser{Reader: r, close: r.Close, file: file}, nil
+	case ".zst":
+		d, err := zstd.NewReader(file)
+		if err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "decompressing file %s", name)
+		}
+		return &readCloser{Reader: d, close: func() error { d.Close(); return nil }, file: file}, nil
+	default:
+		return file, nil
+	}
+}
+
+// Skip skips the first offset bytes of r. It seeks when r can, like
+// a plain file, and reads them otherwise, like a compressed file.
+func Skip(r io.Reader, offset int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return errors.Wrapf(err, "seeking to offset %d", offset)
+		}
+		return nil
+	}
+	n, err := io.CopyN(io.Discard, r, offset)
+	if err == io.EOF {
+		return errors.Errorf("skipping to offset %d: input has %d bytes only", offset, n)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "skipping to offset %d", offset)
+	}
+	return nil
+}
+
+// readCloser is a decompressed file: closing it closes both the
+// decompressor and the file.
+type readCloser struct {
+	io.Reader
+	close func() error
+	file  *os.File
+}
+
+// Close closes the decompressor and the file.
+func (r *readCloser) Close() error {
+	err := r.close()
+	if ferr := r.file.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,207 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package input
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name string, content []byte) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+	require.NoError(t, os.WriteFile(name, content, 0644))
+}
+
+func TestExpand(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.txt", "c.gz", "sub/d.txt", "a.txt.checkpoint", "b.txt.checkpoint.tmp"} {
+		writeFile(t, filepath.Join(dir, name), nil)
+	}
+	testCases := []struct {
+		name          string
+		names         []string
+		expectedFiles []string
+		expectedError error
+	}{
+		{
+			name:          "files and stdin, in the given order",
+			names:         []string{filepath.Join(dir, "b.txt"), Stdin, filepath.Join(dir, "a.txt")},
+			expectedFiles: []string{filepath.Join(dir, "b.txt"), Stdin, filepath.Join(dir, "a.txt")},
+		},
+		{
+			name:          "directory",
+			names:         []string{dir},
+			expectedFiles: []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.gz")},
+		},
+		{
+			name:          "glob",
+			names:         []string{filepath.Join(dir, "*.txt")},
+			expectedFiles: []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")},
+		},
+		{
+			name:          "glob matching checkpoints",
+			names:         []string{filepath.Join(dir, "a.*")},
+			expectedFiles: []string{filepath.Join(dir, "a.txt")},
+		},
+		{
+			name:          "glob without match",
+			names:         []string{filepath.Join(dir, "*.zst")},
+			expectedError: errors.New("no file matches " + filepath.Join(dir, "*.zst")),
+		},
+		{
+			name:          "missing file",
+			names:         []string{filepath.Join(dir, "e.txt")},
+			expectedError: errors.New("reading " + filepath.Join(dir, "e.txt") + ": stat " + filepath.Join(dir, "e.txt") + ": no such file or directory"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files, err := Expand(tc.names)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedFiles, files)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	const content = "line 1\nline 2\n"
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "plain.txt"), []byte(content))
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	writeFile(t, filepath.Join(dir, "file.txt.gz"), gz.Bytes())
+	var zst bytes.Buffer
+	zw, err := zstd.NewWriter(&zst)
+	require.NoError(t, err)
+	_, err = zw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	writeFile(t, filepath.Join(dir, "file.txt.zst"), zst.Bytes())
+	writeFile(t, filepath.Join(dir, "corrupt.gz"), []byte(content))
+	stdin = strings.NewReader(content)
+	testCases := []struct {
+		name          string
+		file          string
+		expectedError error
+	}{
+		{
+			name: "plain file",
+			file: filepath.Join(dir, "plain.txt"),
+		},
+		{
+			name: "gzip",
+			file: filepath.Join(dir, "file.txt.gz"),
+		},
+		{
+			name: "zstd",
+			file: filepath.Join(dir, "file.txt.zst"),
+		},
+		{
+			name: "stdin",
+			file: Stdin,
+		},
+		{
+			name:          "corrupt gzip",
+			file:          filepath.Join(dir, "corrupt.gz"),
+			expectedError: errors.New("decompressing file " + filepath.Join(dir, "corrupt.gz") + ": gzip: invalid header"),
+		},
+		{
+			name:          "missing file",
+			file:          filepath.Join(dir, "missing.txt"),
+			expectedError: errors.New("opening file " + filepath.Join(dir, "missing.txt") + ": open " + filepath.Join(dir, "missing.txt") + ": no such file or directory"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Open(tc.file)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+				b, err := io.ReadAll(r)
+				require.NoError(t, err)
+				require.Equal(t, content, string(b))
+				require.NoError(t, r.Close())
+			}
+		})
+	}
+}
+
+func TestSkip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	writeFile(t, file, []byte("line 1\nline 2\n"))
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+	testCases := []struct {
+		name          string
+		input         io.Reader
+		offset        int64
+		expectedRest  string
+		expectedError error
+	}{
+		{
+			name:         "seeking",
+			input:        f,
+			offset:       7,
+			expectedRest: "line 2\n",
+		},
+		{
+			name:         "reading",
+			input:        strings.NewReader("line 1\nline 2\n"),
+			offset:       7,
+			expectedRest: "line 2\n",
+		},
+		{
+			name:          "past the end",
+			input:         io.LimitReader(strings.NewReader("line 1\n"), 7),
+			offset:        10,
+			expectedError: errors.New("skipping to offset 10: input has 7 bytes only"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Skip(tc.input, tc.offset)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+				rest, err := io.ReadAll(tc.input)
+				require.NoError(t, err)
+				require.Equal(t, tc.expectedRest, string(rest))
+			}
+		})
+	}
+}
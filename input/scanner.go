@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLineTooLong is returned for a line longer than the maximum line size.
+var ErrLineTooLong = errors.New("line too long")
+
+// LineError is an error reading a line.
+type LineError struct {
+	Source string
+	Line   int
+	Err    error
+}
+
+// Error returns the error along with where it happened.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %v", e.Source, e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Scanner reads lines of up to a maximum size. Unlike bufio.Scanner,
+// it goes on after a line that is too long.
+type Scanner struct {
+	source  string
+	r       *bufio.Reader
+	maxSize int
+	line    int
+	offset  int64
+	buf     []byte
+}
+
+// NewScanner creates a new Scanner of the lines of r, named source in
+// errors, which must be at most maxSize bytes long.
+func NewScanner(source string, r io.Reader, maxSize int) *Scanner {
+	return &Scanner{
+		source:  source,
+		r:       bufio.NewReader(r),
+		maxSize: maxSize,
+	}
+}
+
+// SetPosition sets the number of the last line read and the byte
+// offset of its end, for a scan that does not start at the beginning.
+func (s *Scanner) SetPosition(line int, offset int64) {
+	s.line = line
+	s.offset = offset
+}
+
+// Line returns the number of the last line read, starting from 1.
+func (s *Scanner) Line() int {
+	return s.line
+}
+
+// Offset returns the byte offset of the end of the last line read.
+func (s *Scanner) Offset() int64 {
+	return s.offset
+}
+
+// Next returns the next line, without its end of line. The line is
+// only valid until the next call. It returns io.EOF once there are no
+// more lines, and a *LineError if the line cannot be read. A line that
+// is too long is skipped, with a *LineError wrapping ErrLineTooLong,
+// and the scan can go on; any other error ends it.
+func (s *Scanner) Next() ([]byte, error) {
+	s.buf = s.buf[:0]
+	var size int
+	for {
+		chunk, err := s.r.ReadSlice('\n')
+		size += len(chunk)
+		s.offset += int64(len(chunk))
+		// Up to two more bytes are the end of line, \r\n.
+		if size <= s.maxSize+2 {
+			s.buf = append(s.buf, chunk...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			if size == 0 {
+				return nil, io.EOF
+			}
+			break
+		}
+		if err != nil {
+			s.line++
+			return nil, &LineError{Source: s.source, Line: s.line, Err: err}
+		}
+		break
+	}
+	s.line++
+	line := bytes.TrimSuffix(s.buf, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if size > s.maxSize+2 || len(line) > s.maxSize {
+		return nil, &LineError{Source: s.source, Line: s.line, Err: ErrLineTooLong}
+	}
+	return line, nil
+}
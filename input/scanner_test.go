@@ -0,0 +1,105 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package input
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          io.Reader
+		maxSize        int
+		expectedLines  []string
+		expectedErrors []string
+	}{
+		{
+			name:          "lines",
+			input:         strings.NewReader("a\nbb\r\n\nccc"),
+			maxSize:       3,
+			expectedLines: []string{"a", "bb", "", "ccc"},
+		},
+		{
+			name:           "line too long",
+			input:          strings.NewReader("a\nbbbb\ncc\ndddd"),
+			maxSize:        3,
+			expectedLines:  []string{"a", "cc"},
+			expectedErrors: []string{"file.txt:2: line too long", "file.txt:4: line too long"},
+		},
+		{
+			name:           "line longer than the read buffer",
+			input:          strings.NewReader(strings.Repeat("a", 5000) + "\nb\n"),
+			maxSize:        4096,
+			expectedLines:  []string{"b"},
+			expectedErrors: []string{"file.txt:1: line too long"},
+		},
+		{
+			name:          "line longer than the read buffer, within the maximum",
+			input:         strings.NewReader(strings.Repeat("a", 5000) + "\nb\n"),
+			maxSize:       5000,
+			expectedLines: []string{strings.Repeat("a", 5000), "b"},
+		},
+		{
+			name:           "read error",
+			input:          io.MultiReader(strings.NewReader("a\nb"), iotest.ErrReader(errors.New("random error"))),
+			maxSize:        3,
+			expectedLines:  []string{"a"},
+			expectedErrors: []string{"file.txt:2: random error"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewScanner("file.txt", tc.input, tc.maxSize)
+			var (
+				lines []string
+				errs  []string
+			)
+			for {
+				line, err := s.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					var le *LineError
+					require.ErrorAs(t, err, &le)
+					require.Equal(t, s.Line(), le.Line)
+					errs = append(errs, err.Error())
+					if !errors.Is(err, ErrLineTooLong) {
+						break
+					}
+					continue
+				}
+				lines = append(lines, string(line))
+			}
+			require.Equal(t, tc.expectedLines, lines)
+			require.Equal(t, tc.expectedErrors, errs)
+		})
+	}
+}
+
+func TestScannerPosition(t *testing.T) {
+	s := NewScanner("file.txt", strings.NewReader("cc\r\ndddd\ne"), 3)
+	s.SetPosition(2, 4)
+	line, err := s.Next()
+	require.NoError(t, err)
+	require.Equal(t, "cc", string(line))
+	require.Equal(t, 3, s.Line())
+	require.Equal(t, int64(8), s.Offset())
+	_, err = s.Next()
+	require.EqualError(t, err, "file.txt:4: line too long")
+	require.Equal(t, int64(13), s.Offset())
+	line, err = s.Next()
+	require.NoError(t, err)
+	require.Equal(t, "e", string(line))
+	require.Equal(t, int64(14), s.Offset())
+	_, err = s.Next()
+	require.Equal(t, io.EOF, err)
+}
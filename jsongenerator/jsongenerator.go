@@ -5,48 +5,135 @@ package main
 
 import (
 	"context"
-	"math/rand"
+	"fmt"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/randomdata"
 	"github.com/tiagomelo/realtime-data-kafka/task"
 	"github.com/tiagomelo/realtime-data-kafka/task/worker/randomtransaction"
 )
 
-// opts holds the command-line options.
-var opts struct {
-	LowerLimitMinValue float32 `long:"llmin" description:"Lower limit min value" required:"true"`
-	LowerLimitMaxValue float32 `long:"llmax" description:"Lower limit max value" required:"true"`
-	UpperLimitMinValue float32 `long:"ulmin" description:"Upper limit min value" required:"true"`
-	UpperLimitMaxValue float32 `long:"ulmax" description:"Upper limit max value" required:"true"`
-	Percentage         float32 `short:"p" long:"percentage" description:"Percentage for lower limit" required:"true"`
-	TotalLines         int     `short:"t" long:"totallines" description:"Total lines" required:"true"`
-	File               string  `short:"f" long:"file" description:"Output file" required:"true"`
+// seededNow is the reference time of the transaction times when a seed
+// is given, so the output does not depend on when it is generated.
+var seededNow = time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+
+// options holds the command-line options.
+type options struct {
+	LowerLimitMinValue float32  `long:"llmin" description:"Lower limit min value" required:"true"`
+	LowerLimitMaxValue float32  `long:"llmax" description:"Lower limit max value" required:"true"`
+	UpperLimitMinValue float32  `long:"ulmin" description:"Upper limit min value" required:"true"`
+	UpperLimitMaxValue float32  `long:"ulmax" description:"Upper limit max value" required:"true"`
+	Percentage         float32  `short:"p" long:"percentage" description:"Percentage for lower limit" required:"true"`
+	TotalLines         int      `short:"t" long:"totallines" description:"Total lines" required:"true"`
+	File               string   `short:"f" long:"file" description:"Output file" required:"true"`
+	Scenarios          []string `long:"scenario" description:"Fraud scenario to generate, as name:count, like velocity_burst:10; may be repeated"`
+	Labels             bool     `short:"l" long:"labels" description:"Write the is_fraud/scenario labels; implied by --scenario"`
+	Seed               *int64   `long:"seed" description:"Seed of the random data; the same seed and options always generate the same file, with transaction times within the 24 hours before 2023-06-05T00:00:00Z"`
+}
+
+// parseScenario parses a name:count scenario option.
+func parseScenario(s string) (string, int, error) {
+	name, count, found := strings.Cut(s, ":")
+	if !found {
+		return "", 0, errors.Errorf("invalid scenario %q: expected name:count", s)
+	}
+	valid := false
+	for _, n := range randomtransaction.Scenarios() {
+		if n == name {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", 0, errors.Errorf("unknown scenario %q: expected one of %s", name, strings.Join(randomtransaction.Scenarios(), ", "))
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return "", 0, errors.Errorf("invalid count of scenario %q", s)
+	}
+	return name, n, nil
 }
 
+// newWorker creates the worker that writes at the given position of the output file.
+type newWorker func(out *randomtransaction.Writer, seq int, gen *randomdata.Generator) task.Worker
+
 func run(args []string) error {
-	flags.ParseArgs(&opts, args)
+	var opts options
+	if _, err := flags.ParseArgs(&opts, args); err != nil {
+		return err
+	}
+	labeled := opts.Labels || len(opts.Scenarios) > 0
+	var scenarioWorkers []newWorker
+	for _, sc := range opts.Scenarios {
+		name, count, err := parseScenario(sc)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < count; i++ {
+			scenarioWorkers = append(scenarioWorkers, func(out *randomtransaction.Writer, seq int, gen *randomdata.Generator) task.Worker {
+				return &randomtransaction.ScenarioWorker{Out: out, Seq: seq, Gen: gen, Scenario: name}
+			})
+		}
+	}
+	gen := randomdata.NewGenerator(time.Now().UnixNano(), time.Time{})
+	if opts.Seed != nil {
+		gen = randomdata.NewGenerator(*opts.Seed, seededNow)
+	}
+	out, err := randomtransaction.NewWriter(opts.File, nil)
+	if err != nil {
+		return err
+	}
 	ctx := context.Background()
 	maxGoRoutines := runtime.GOMAXPROCS(0)
-	pool := task.New(ctx, maxGoRoutines)
-	lowerLimit := float32(opts.TotalLines) * opts.Percentage
-	remaining := float32(opts.TotalLines) - lowerLimit
-	workers := make([]task.Worker, opts.TotalLines)
-	for i := 0; i < int(lowerLimit); i++ {
-		workers[i] = &randomtransaction.Worker{FilePath: opts.File, MinAmount: opts.LowerLimitMinValue, MaxAmount: opts.LowerLimitMaxValue}
+	// A worker that panicked leaves its sequence number unwritten, so
+	// the file is not finished; the first panic is reported.
+	panics := make(chan error, 1)
+	pool := task.New(ctx, maxGoRoutines, task.WithPanicHandler(func(w task.Worker, err error) {
+		select {
+		case panics <- err:
+		default:
+		}
+	}))
+	lowerLimit := int(float32(opts.TotalLines) * opts.Percentage)
+	workers := make([]newWorker, opts.TotalLines)
+	for i := 0; i < lowerLimit; i++ {
+		workers[i] = func(out *randomtransaction.Writer, seq int, gen *randomdata.Generator) task.Worker {
+			return &randomtransaction.Worker{Out: out, Seq: seq, Gen: gen, MinAmount: opts.LowerLimitMinValue, MaxAmount: opts.LowerLimitMaxValue, Labeled: labeled}
+		}
 	}
-	for i := int(remaining); i < opts.TotalLines; i++ {
-		workers[i] = &randomtransaction.Worker{FilePath: opts.File, MinAmount: opts.UpperLimitMinValue, MaxAmount: opts.UpperLimitMaxValue}
+	for i := lowerLimit; i < opts.TotalLines; i++ {
+		workers[i] = func(out *randomtransaction.Writer, seq int, gen *randomdata.Generator) task.Worker {
+			return &randomtransaction.Worker{Out: out, Seq: seq, Gen: gen, MinAmount: opts.UpperLimitMinValue, MaxAmount: opts.UpperLimitMaxValue, Labeled: labeled}
+		}
 	}
-	rand.Shuffle(len(workers), func(i, j int) { workers[i], workers[j] = workers[j], workers[i] })
-	for _, w := range workers {
-		pool.Do(w)
+	workers = append(workers, scenarioWorkers...)
+	gen.Shuffle(len(workers), func(i, j int) { workers[i], workers[j] = workers[j], workers[i] })
+	// Every worker gets its own generator, split in order from the main
+	// one, so the data does not depend on which goroutine runs it.
+	for i, w := range workers {
+		if err := pool.DoContext(ctx, w(out, i, gen.Split())); err != nil {
+			return err
+		}
 	}
 	pool.Shutdown()
-	return nil
+	select {
+	case err := <-panics:
+		out.Close()
+		return err
+	default:
+	}
+	return out.Close()
 }
 
 func main() {
-	run(os.Args)
+	if err := run(os.Args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
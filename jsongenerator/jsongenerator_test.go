@@ -5,8 +5,11 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -76,5 +79,166 @@ func TestRun(t *testing.T) {
 		t.Fatalf("reading file %s: %v", fileName, err)
 	}
 	require.Equal(t, totalLines, count)
-	require.Equal(t, totalSuspicious, 3)
+	require.Equal(t, totalSuspicious, 7)
+}
+
+func TestRunPercentage(t *testing.T) {
+	testCases := []struct {
+		name          string
+		percentage    string
+		expectedLower int
+	}{
+		{
+			name:          "mostly lower limit",
+			percentage:    "0.7",
+			expectedLower: 70,
+		},
+		{
+			name:          "mostly upper limit",
+			percentage:    "0.3",
+			expectedLower: 30,
+		},
+		{
+			name:          "upper limit only",
+			percentage:    "0",
+			expectedLower: 0,
+		},
+		{
+			name:          "lower limit only",
+			percentage:    "1",
+			expectedLower: 100,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			const totalLines = 100
+			path := filepath.Join(t.TempDir(), "data.json")
+			args := []string{
+				"--llmin", "10", "--llmax", "20", "--ulmin", "100", "--ulmax", "200",
+				fmt.Sprintf("-t=%d", totalLines), "-p=" + tc.percentage, "-f=" + path,
+			}
+			require.NoError(t, run(args))
+			txs, invalid, err := transaction.ReadFiles([]string{path})
+			require.NoError(t, err)
+			require.Zero(t, invalid)
+			require.Len(t, txs, totalLines)
+			lower := 0
+			for _, tx := range txs {
+				if tx.TransactionAmount <= 20 {
+					lower++
+				}
+			}
+			require.Equal(t, tc.expectedLower, lower)
+		})
+	}
+}
+
+func TestRunWithScenarios(t *testing.T) {
+	if err := cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	totalLines := 10
+	args := []string{
+		"--llmin",
+		"10000",
+		"--llmax",
+		"30000",
+		"--ulmin",
+		"100",
+		"--ulmax",
+		"3000",
+		fmt.Sprintf("-t=%d", totalLines),
+		"-p=0.7",
+		fmt.Sprintf("-f=%s", fileName),
+		"--scenario=structuring:2",
+		"--scenario=impossible_travel:1",
+	}
+	require.NoError(t, run(args))
+	txs, invalid, err := transaction.ReadFiles([]string{fileName})
+	require.NoError(t, err)
+	require.Zero(t, invalid)
+	byScenario := make(map[string]int)
+	fraud := 0
+	for _, tx := range txs {
+		byScenario[tx.Scenario]++
+		if tx.IsFraud {
+			fraud++
+		}
+	}
+	require.Equal(t, totalLines, byScenario[transaction.NormalScenario])
+	require.GreaterOrEqual(t, byScenario["structuring"], 6)
+	require.Equal(t, 2, byScenario["impossible_travel"])
+	require.Equal(t, byScenario["structuring"]+1, fraud)
+}
+
+func TestParseScenario(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedName  string
+		expectedCount int
+		expectedError error
+	}{
+		{
+			name:          "happy path",
+			input:         "velocity_burst:10",
+			expectedName:  "velocity_burst",
+			expectedCount: 10,
+		},
+		{
+			name:          "missing count",
+			input:         "velocity_burst",
+			expectedError: errors.New(`invalid scenario "velocity_burst": expected name:count`),
+		},
+		{
+			name:          "unknown scenario",
+			input:         "phishing:1",
+			expectedError: errors.New(`unknown scenario "phishing": expected one of account_takeover, impossible_travel, structuring, velocity_burst`),
+		},
+		{
+			name:          "invalid count",
+			input:         "structuring:-1",
+			expectedError: errors.New(`invalid count of scenario "structuring:-1"`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, count, err := parseScenario(tc.input)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedName, name)
+				require.Equal(t, tc.expectedCount, count)
+			}
+		})
+	}
+}
+
+func TestRunWithSeed(t *testing.T) {
+	dir := t.TempDir()
+	generate := func(name string, seed, procs int) []byte {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+		path := filepath.Join(dir, name)
+		args := []string{
+			"--llmin", "10000", "--llmax", "30000", "--ulmin", "100", "--ulmax", "3000",
+			"-t=200", "-p=0.7", "-f=" + path, fmt.Sprintf("--seed=%d", seed),
+			"--scenario=velocity_burst:5", "--scenario=account_takeover:5",
+		}
+		require.NoError(t, run(args))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return data
+	}
+	single := generate("single.json", 42, 1)
+	parallel := generate("parallel.json", 42, 8)
+	require.Equal(t, string(single), string(parallel))
+	// Generating to the same file again overwrites it.
+	require.Equal(t, string(single), string(generate("single.json", 42, 8)))
+	require.NotEqual(t, string(single), string(generate("other.json", 43, 8)))
 }
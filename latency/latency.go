@@ -0,0 +1,83 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package latency
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// growth is the ratio between the upper bounds of consecutive
+	// buckets, so quantiles are at most 5% over the actual latency.
+	growth = 1.05
+	// buckets is the number of buckets. The first one holds the
+	// latencies up to a microsecond; the last one, those over 18 hours.
+	buckets = 512
+)
+
+// Histogram records latencies in exponentially growing buckets, to
+// get their quantiles in constant memory, however many they are. Its
+// zero value is an empty histogram.
+type Histogram struct {
+	mu     sync.Mutex
+	counts [buckets]int64
+	total  int64
+}
+
+// Record records the latency.
+func (h *Histogram) Record(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[bucket(d)]++
+	h.total++
+}
+
+// Count returns the number of latencies recorded.
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Quantile returns the q quantile, between 0 and 1, of the latencies
+// recorded: the upper bound of the bucket that holds it. It returns
+// zero if none was recorded.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(q * float64(h.total)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		if seen += c; seen >= rank {
+			return upperBound(i)
+		}
+	}
+	return upperBound(buckets - 1)
+}
+
+// bucket returns the index of the bucket of the latency.
+func bucket(d time.Duration) int {
+	us := float64(d) / float64(time.Microsecond)
+	if us <= 1 {
+		return 0
+	}
+	i := int(math.Ceil(math.Log(us) / math.Log(growth)))
+	if i >= buckets {
+		return buckets - 1
+	}
+	return i
+}
+
+// upperBound returns the upper bound of the bucket.
+func upperBound(i int) time.Duration {
+	return time.Duration(math.Pow(growth, float64(i)) * float64(time.Microsecond))
+}
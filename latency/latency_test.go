@@ -0,0 +1,89 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package latency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuantile(t *testing.T) {
+	testCases := []struct {
+		name      string
+		latencies func(h *Histogram)
+		q         float64
+		expected  time.Duration
+	}{
+		{
+			name:      "empty",
+			latencies: func(h *Histogram) {},
+			q:         0.5,
+		},
+		{
+			name: "median",
+			latencies: func(h *Histogram) {
+				for i := 1; i <= 100; i++ {
+					h.Record(time.Duration(i) * time.Millisecond)
+				}
+			},
+			q:        0.5,
+			expected: 50 * time.Millisecond,
+		},
+		{
+			name: "99th percentile",
+			latencies: func(h *Histogram) {
+				for i := 0; i < 990; i++ {
+					h.Record(time.Millisecond)
+				}
+				for i := 0; i < 10; i++ {
+					h.Record(time.Second)
+				}
+			},
+			q:        0.99,
+			expected: time.Millisecond,
+		},
+		{
+			name: "over the 99th percentile",
+			latencies: func(h *Histogram) {
+				for i := 0; i < 980; i++ {
+					h.Record(time.Millisecond)
+				}
+				for i := 0; i < 20; i++ {
+					h.Record(time.Second)
+				}
+			},
+			q:        0.99,
+			expected: time.Second,
+		},
+		{
+			name: "sub-microsecond",
+			latencies: func(h *Histogram) {
+				h.Record(0)
+				h.Record(500 * time.Nanosecond)
+			},
+			q:        1,
+			expected: time.Microsecond,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := new(Histogram)
+			tc.latencies(h)
+			got := h.Quantile(tc.q)
+			// The quantile is the upper bound of its bucket.
+			require.GreaterOrEqual(t, got, tc.expected)
+			require.LessOrEqual(t, float64(got), float64(tc.expected)*growth)
+		})
+	}
+}
+
+func TestHistogramBounds(t *testing.T) {
+	h := new(Histogram)
+	h.Record(100 * 24 * time.Hour)
+	require.Equal(t, int64(1), h.Count())
+	require.Equal(t, upperBound(buckets-1), h.Quantile(0.5))
+	require.Greater(t, upperBound(buckets-1), 18*time.Hour)
+}
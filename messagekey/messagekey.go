@@ -0,0 +1,99 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package messagekey
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// None is the spec of the extractor that never finds a key.
+const None = "none"
+
+// ErrNoKey is returned when a line has no key.
+var ErrNoKey = errors.New("no key")
+
+// Extractor pulls the message key out of a line. It returns ErrNoKey,
+// possibly wrapped, if the line has none.
+type Extractor func(line []byte) ([]byte, error)
+
+// New creates the Extractor of the spec, which is either:
+//   - none, for messages without key;
+//   - a JSON pointer (RFC 6901), like /account/number;
+//   - the name of a top-level field, like account_number.
+//
+// The key is the value found there, which must be a string or a number.
+func New(spec string) (Extractor, error) {
+	switch {
+	case spec == None:
+		return func(line []byte) ([]byte, error) {
+			return nil, ErrNoKey
+		}, nil
+	case spec == "":
+		return nil, errors.New("empty key spec: expected a field name, a JSON pointer or none")
+	case strings.HasPrefix(spec, "/"):
+		tokens, err := parsePointer(spec)
+		if err != nil {
+			return nil, err
+		}
+		return pointerExtractor(spec, tokens), nil
+	default:
+		return pointerExtractor(spec, []string{spec}), nil
+	}
+}
+
+// parsePointer splits the JSON pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		// ~ is only valid as part of ~0 or ~1.
+		if strings.Count(t, "~") != strings.Count(t, "~0")+strings.Count(t, "~1") {
+			return nil, errors.Errorf("invalid JSON pointer %q", pointer)
+		}
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// pointerExtractor returns the Extractor of the value at the path
+// given by the tokens. spec is how the path is reported in errors.
+func pointerExtractor(spec string, tokens []string) Extractor {
+	return func(line []byte) ([]byte, error) {
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return nil, errors.Wrapf(ErrNoKey, "invalid JSON: %v", err)
+		}
+		for _, t := range tokens {
+			switch n := v.(type) {
+			case map[string]interface{}:
+				v = n[t]
+			case []interface{}:
+				i, err := strconv.Atoi(t)
+				if err != nil || i < 0 || i >= len(n) {
+					return nil, errors.Wrapf(ErrNoKey, "%s not found", spec)
+				}
+				v = n[i]
+			default:
+				v = nil
+			}
+			if v == nil {
+				return nil, errors.Wrapf(ErrNoKey, "%s not found", spec)
+			}
+		}
+		switch k := v.(type) {
+		case string:
+			return []byte(k), nil
+		case json.Number:
+			return []byte(k.String()), nil
+		default:
+			return nil, errors.Wrapf(ErrNoKey, "%s is not a string or a number", spec)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package messagekey
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		name          string
+		spec          string
+		expectedError error
+	}{
+		{
+			name: "field",
+			spec: "account_number",
+		},
+		{
+			name: "JSON pointer",
+			spec: "/account/number",
+		},
+		{
+			name: "none",
+			spec: None,
+		},
+		{
+			name:          "empty",
+			spec:          "",
+			expectedError: errors.New("empty key spec: expected a field name, a JSON pointer or none"),
+		},
+		{
+			name:          "invalid JSON pointer",
+			spec:          "/account~2",
+			expectedError: errors.New(`invalid JSON pointer "/account~2"`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			extract, err := New(tc.spec)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+				require.NotNil(t, extract)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	testCases := []struct {
+		name          string
+		spec          string
+		line          string
+		expectedKey   string
+		expectedError error
+	}{
+		{
+			name:        "number field",
+			spec:        "account_number",
+			line:        `{"transaction_id":4508561159,"account_number":395402066}`,
+			expectedKey: "395402066",
+		},
+		{
+			name:        "string field",
+			spec:        "location",
+			line:        `{"location":"Jacksonville, FL"}`,
+			expectedKey: "Jacksonville, FL",
+		},
+		{
+			name:        "large number is kept as is",
+			spec:        "account_number",
+			line:        `{"account_number":12345678901234567890}`,
+			expectedKey: "12345678901234567890",
+		},
+		{
+			name:        "JSON pointer",
+			spec:        "/account/number",
+			line:        `{"account":{"number":395402066}}`,
+			expectedKey: "395402066",
+		},
+		{
+			name:        "JSON pointer into an array",
+			spec:        "/accounts/1",
+			line:        `{"accounts":[1,2]}`,
+			expectedKey: "2",
+		},
+		{
+			name:        "escaped JSON pointer",
+			spec:        "/a~1b/c~0d",
+			line:        `{"a/b":{"c~d":"key"}}`,
+			expectedKey: "key",
+		},
+		{
+			name:          "missing field",
+			spec:          "account_number",
+			line:          `{"transaction_id":4508561159}`,
+			expectedError: errors.New("account_number not found: no key"),
+		},
+		{
+			name:          "null field",
+			spec:          "account_number",
+			line:          `{"account_number":null}`,
+			expectedError: errors.New("account_number not found: no key"),
+		},
+		{
+			name:          "JSON pointer out of the array",
+			spec:          "/accounts/2",
+			line:          `{"accounts":[1,2]}`,
+			expectedError: errors.New("/accounts/2 not found: no key"),
+		},
+		{
+			name:          "JSON pointer through a number",
+			spec:          "/account/number",
+			line:          `{"account":395402066}`,
+			expectedError: errors.New("/account/number not found: no key"),
+		},
+		{
+			name:          "object",
+			spec:          "account",
+			line:          `{"account":{"number":395402066}}`,
+			expectedError: errors.New("account is not a string or a number: no key"),
+		},
+		{
+			name:          "invalid JSON",
+			spec:          "account_number",
+			line:          `{"account_number":`,
+			expectedError: errors.New("invalid JSON: unexpected EOF: no key"),
+		},
+		{
+			name:          "none",
+			spec:          None,
+			line:          `{"account_number":395402066}`,
+			expectedError: ErrNoKey,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			extract, err := New(tc.spec)
+			require.NoError(t, err)
+			key, err := extract([]byte(tc.line))
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.ErrorIs(t, err, ErrNoKey)
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedKey, string(key))
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package accountbaseline
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/accountbaseline/models"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = "account_baselines"
+
+// For ease of unit testing.
+var (
+	collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+		return mongoClient.Database(databaseName).Collection(collectionName)
+	}
+	findOne = func(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+		return collection.FindOne(ctx, filter).Decode(result)
+	}
+	replaceOne = func(ctx context.Context, collection *mongo.Collection, filter interface{}, replacement interface{}) (*mongo.UpdateResult, error) {
+		return collection.ReplaceOne(ctx, filter, replacement, options.Replace().SetUpsert(true))
+	}
+	createIndex = func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error) {
+		return collection.Indexes().CreateOne(ctx, index)
+	}
+)
+
+// EnsureIndexes creates the indexes of the account baselines collection,
+// if they do not exist yet. The unique index on account_number keeps
+// lookups from scanning the collection, and concurrent upserts from
+// storing an account twice.
+func EnsureIndexes(ctx context.Context, db *mongodb.MongoDb) error {
+	coll := collection(db.Client, db.DatabaseName, collectionName)
+	_, err := createIndex(ctx, coll, mongo.IndexModel{
+		Keys:    bson.D{{Key: "account_number", Value: 1}},
+		Options: options.Index().SetName("account_number_unique").SetUnique(true),
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating account baselines index")
+	}
+	return nil
+}
+
+// Find returns the baseline of the given account, or nil if there is none.
+func Find(ctx context.Context, db *mongodb.MongoDb, accountNumber int) (*models.AccountBaseline, error) {
+	coll := collection(db.Client, db.DatabaseName, collectionName)
+	b := new(models.AccountBaseline)
+	if err := findOne(ctx, coll, filter(accountNumber), b); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "finding account baseline")
+	}
+	return b, nil
+}
+
+// Upsert creates or replaces the baseline of an account.
+func Upsert(ctx context.Context, db *mongodb.MongoDb, b *models.AccountBaseline) error {
+	coll := collection(db.Client, db.DatabaseName, collectionName)
+	if _, err := replaceOne(ctx, coll, filter(b.AccountNumber), b); err != nil {
+		return errors.Wrap(err, "upserting account baseline")
+	}
+	return nil
+}
+
+// filter selects the stored baseline of the account.
+func filter(accountNumber int) bson.M {
+	return bson.M{"account_number": accountNumber}
+}
+
+// Store is a rules.BaselineStore backed by MongoDB.
+type Store struct {
+	Db *mongodb.MongoDb
+}
+
+// Load returns the baseline of the account, or nil if there is none.
+func (s *Store) Load(ctx context.Context, accountNumber int) (*rules.Baseline, error) {
+	b, err := Find(ctx, s.Db, accountNumber)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return &rules.Baseline{
+		AccountNumber: b.AccountNumber,
+		Count:         b.Count,
+		Mean:          b.Mean,
+		M2:            b.M2,
+	}, nil
+}
+
+// Save creates or replaces the baseline of the account.
+func (s *Store) Save(ctx context.Context, b *rules.Baseline) error {
+	return Upsert(ctx, s.Db, toModel(b))
+}
+
+// toModel converts the baseline to its stored form.
+func toModel(b *rules.Baseline) *models.AccountBaseline {
+	return &models.AccountBaseline{
+		AccountNumber: b.AccountNumber,
+		Count:         b.Count,
+		Mean:          b.Mean,
+		M2:            b.M2,
+	}
+}
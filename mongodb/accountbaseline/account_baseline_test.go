@@ -0,0 +1,155 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package accountbaseline
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/accountbaseline/models"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestEnsureIndexes(t *testing.T) {
+	testCases := []struct {
+		name            string
+		mockCreateIndex func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error)
+		expectedError   error
+	}{
+		{
+			name: "happy path",
+			mockCreateIndex: func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error) {
+				require.Equal(t, bson.D{{Key: "account_number", Value: 1}}, index.Keys)
+				require.True(t, *index.Options.Unique)
+				return *index.Options.Name, nil
+			},
+		},
+		{
+			name: "error",
+			mockCreateIndex: func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error) {
+				return "", errors.New("random error")
+			},
+			expectedError: errors.New("creating account baselines index: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			}
+			createIndex = tc.mockCreateIndex
+			err := EnsureIndexes(context.TODO(), new(mongodb.MongoDb))
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mockFindOne      func(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error
+		expectedBaseline *rules.Baseline
+		expectedError    error
+	}{
+		{
+			name: "happy path",
+			mockFindOne: func(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+				*result.(*models.AccountBaseline) = models.AccountBaseline{AccountNumber: 1, Count: 2, Mean: 3, M2: 4}
+				return nil
+			},
+			expectedBaseline: &rules.Baseline{AccountNumber: 1, Count: 2, Mean: 3, M2: 4},
+		},
+		{
+			name: "not found",
+			mockFindOne: func(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+				return mongo.ErrNoDocuments
+			},
+		},
+		{
+			name: "error",
+			mockFindOne: func(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+				return errors.New("random error")
+			},
+			expectedError: errors.New("finding account baseline: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			}
+			findOne = tc.mockFindOne
+			store := &Store{Db: new(mongodb.MongoDb)}
+			b, err := store.Load(context.TODO(), 1)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedBaseline, b)
+			}
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	testCases := []struct {
+		name           string
+		mockReplaceOne func(ctx context.Context, collection *mongo.Collection, filter interface{}, replacement interface{}) (*mongo.UpdateResult, error)
+		expectedError  error
+	}{
+		{
+			name: "happy path",
+			mockReplaceOne: func(ctx context.Context, collection *mongo.Collection, filter interface{}, replacement interface{}) (*mongo.UpdateResult, error) {
+				require.Equal(t, &models.AccountBaseline{AccountNumber: 1, Count: 2, Mean: 3, M2: 4}, replacement)
+				return new(mongo.UpdateResult), nil
+			},
+		},
+		{
+			name: "error",
+			mockReplaceOne: func(ctx context.Context, collection *mongo.Collection, filter interface{}, replacement interface{}) (*mongo.UpdateResult, error) {
+				return nil, errors.New("random error")
+			},
+			expectedError: errors.New("upserting account baseline: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			}
+			replaceOne = tc.mockReplaceOne
+			store := &Store{Db: new(mongodb.MongoDb)}
+			err := store.Save(context.TODO(), &rules.Baseline{AccountNumber: 1, Count: 2, Mean: 3, M2: 4})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+			}
+		})
+	}
+}
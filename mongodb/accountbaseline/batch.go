@@ -0,0 +1,152 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package accountbaseline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// For ease of unit testing.
+var bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return collection.BulkWrite(ctx, documents, options.BulkWrite().SetOrdered(false))
+}
+
+// BatchOption configures a BatchStore.
+type BatchOption func(s *BatchStore)
+
+// WithBulkWriteWrapper sets the function that wraps every bulk write,
+// like to retry it.
+func WithBulkWriteWrapper(wrap func(ctx context.Context, write func(ctx context.Context) error) error) BatchOption {
+	return func(s *BatchStore) {
+		s.wrap = wrap
+	}
+}
+
+// WithErrorHandler sets the function called when a bulk write made
+// by Run fails. Its baselines are kept, to be written with the next one.
+func WithErrorHandler(onError func(err error)) BatchOption {
+	return func(s *BatchStore) {
+		s.onError = onError
+	}
+}
+
+// BatchStore is a rules.BaselineStore backed by MongoDB that does not
+// write on Save: it keeps the latest baseline of every account and
+// writes them with an unordered bulk write every interval. Load returns
+// the baseline that is not written yet, if any.
+type BatchStore struct {
+	store    *Store
+	interval time.Duration
+	wrap     func(ctx context.Context, write func(ctx context.Context) error) error
+	onError  func(err error)
+	mu       sync.Mutex
+	pending  map[int]rules.Baseline
+}
+
+// NewBatchStore creates a new BatchStore. Run must be called for the
+// baselines to be written every interval.
+func NewBatchStore(db *mongodb.MongoDb, interval time.Duration, opts ...BatchOption) *BatchStore {
+	s := &BatchStore{
+		store:    &Store{Db: db},
+		interval: interval,
+		wrap: func(ctx context.Context, write func(ctx context.Context) error) error {
+			return write(ctx)
+		},
+		onError: func(err error) {},
+		pending: make(map[int]rules.Baseline),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Load returns the baseline of the account, or nil if there is none.
+func (s *BatchStore) Load(ctx context.Context, accountNumber int) (*rules.Baseline, error) {
+	s.mu.Lock()
+	b, ok := s.pending[accountNumber]
+	s.mu.Unlock()
+	if ok {
+		return &b, nil
+	}
+	return s.store.Load(ctx, accountNumber)
+}
+
+// Save buffers the baseline of the account. A baseline with less
+// samples than the buffered one is older, and is ignored.
+func (s *BatchStore) Save(ctx context.Context, b *rules.Baseline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keep(*b)
+	return nil
+}
+
+// keep buffers the baseline, unless a newer one is buffered already.
+// It must be called with the lock held.
+func (s *BatchStore) keep(b rules.Baseline) {
+	if prev, ok := s.pending[b.AccountNumber]; ok && prev.Count > b.Count {
+		return
+	}
+	s.pending[b.AccountNumber] = b
+}
+
+// Run writes the buffered baselines every interval, until the context
+// is done.
+func (s *BatchStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				s.onError(err)
+			}
+		}
+	}
+}
+
+// Flush writes the buffered baselines with a single unordered bulk
+// write. If it fails, they are buffered again, unless newer ones were
+// saved meanwhile.
+func (s *BatchStore) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = make(map[int]rules.Baseline)
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	documents := make([]mongo.WriteModel, 0, len(batch))
+	for _, b := range batch {
+		b := b
+		documents = append(documents, mongo.NewReplaceOneModel().
+			SetFilter(filter(b.AccountNumber)).
+			SetReplacement(toModel(&b)).
+			SetUpsert(true))
+	}
+	err := s.wrap(ctx, func(ctx context.Context) error {
+		coll := collection(s.store.Db.Client, s.store.Db.DatabaseName, collectionName)
+		_, err := bulkWrite(ctx, coll, documents)
+		return err
+	})
+	if err == nil {
+		return nil
+	}
+	s.mu.Lock()
+	for _, b := range batch {
+		s.keep(b)
+	}
+	s.mu.Unlock()
+	return errors.Wrapf(err, "bulk upserting %d account baselines", len(batch))
+}
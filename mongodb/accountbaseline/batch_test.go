@@ -0,0 +1,77 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package accountbaseline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/accountbaseline/models"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBatchStore(t *testing.T) {
+	collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+		return new(mongo.Collection)
+	}
+	findOne = func(ctx context.Context, collection *mongo.Collection, filter interface{}, result interface{}) error {
+		return mongo.ErrNoDocuments
+	}
+	var written [][]*models.AccountBaseline
+	bulkErr := errors.New("random error")
+	bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		if bulkErr != nil {
+			return nil, bulkErr
+		}
+		var batch []*models.AccountBaseline
+		for _, d := range documents {
+			batch = append(batch, d.(*mongo.ReplaceOneModel).Replacement.(*models.AccountBaseline))
+		}
+		written = append(written, batch)
+		return new(mongo.BulkWriteResult), nil
+	}
+	attempts := 0
+	store := NewBatchStore(new(mongodb.MongoDb), time.Hour,
+		WithBulkWriteWrapper(func(ctx context.Context, write func(ctx context.Context) error) error {
+			attempts++
+			return write(ctx)
+		}),
+	)
+	ctx := context.TODO()
+
+	// Saves are buffered, the latest one of every account winning.
+	require.NoError(t, store.Save(ctx, &rules.Baseline{AccountNumber: 1, Count: 1, Mean: 10}))
+	require.NoError(t, store.Save(ctx, &rules.Baseline{AccountNumber: 1, Count: 2, Mean: 15, M2: 50}))
+	require.NoError(t, store.Save(ctx, &rules.Baseline{AccountNumber: 1, Count: 1, Mean: 99}))
+	b, err := store.Load(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, &rules.Baseline{AccountNumber: 1, Count: 2, Mean: 15, M2: 50}, b)
+	b, err = store.Load(ctx, 2)
+	require.NoError(t, err)
+	require.Nil(t, b)
+
+	// A failed bulk write keeps the baselines, unless newer ones were saved.
+	require.EqualError(t, store.Flush(ctx), "bulk upserting 1 account baselines: random error")
+	require.Empty(t, written)
+	b, err = store.Load(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), b.Count)
+
+	bulkErr = nil
+	require.NoError(t, store.Flush(ctx))
+	require.Equal(t, [][]*models.AccountBaseline{{{AccountNumber: 1, Count: 2, Mean: 15, M2: 50}}}, written)
+	require.NoError(t, store.Flush(ctx))
+	require.Len(t, written, 1)
+	require.Equal(t, 2, attempts)
+
+	// Once written, the baseline is loaded from MongoDB.
+	b, err = store.Load(ctx, 1)
+	require.NoError(t, err)
+	require.Nil(t, b)
+}
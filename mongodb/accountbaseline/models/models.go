@@ -0,0 +1,13 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package models
+
+// AccountBaseline represents the online mean and variance of the
+// transaction amounts of an account.
+type AccountBaseline struct {
+	AccountNumber int     `bson:"account_number"`
+	Count         int64   `bson:"count"`
+	Mean          float64 `bson:"mean"`
+	M2            float64 `bson:"m2"`
+}
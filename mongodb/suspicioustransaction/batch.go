@@ -0,0 +1,202 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package suspicioustransaction
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction/models"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// For ease of unit testing.
+var bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	return collection.BulkWrite(ctx, documents, options.BulkWrite().SetOrdered(false))
+}
+
+// BatchOption configures a BatchWriter.
+type BatchOption func(b *BatchWriter)
+
+// WithBulkWriteWrapper sets the function that wraps every bulk write,
+// like to retry it. write returns an error only if the bulk write as
+// a whole failed; failures of single documents are reported to
+// their callbacks instead.
+func WithBulkWriteWrapper(wrap func(ctx context.Context, write func(ctx context.Context) error) error) BatchOption {
+	return func(b *BatchWriter) {
+		b.wrap = wrap
+	}
+}
+
+// WithFlushHandler sets the function called after every bulk write,
+// with the number of documents written and the number that failed.
+func WithFlushHandler(onFlush func(written, failed int)) BatchOption {
+	return func(b *BatchWriter) {
+		b.onFlush = onFlush
+	}
+}
+
+// pendingDocument is a buffered document along with the function
+// to call once it is written.
+type pendingDocument struct {
+	document *models.SuspiciousTransaction
+	done     func(ctx context.Context, inserted bool, err error)
+}
+
+// BatchWriter buffers suspicious transactions and inserts them into
+// MongoDB with unordered bulk writes, once it holds size of them or
+// every interval, whichever comes first. Like Insert, it skips the
+// suspicious transactions that are already stored.
+type BatchWriter struct {
+	db       *mongodb.MongoDb
+	size     int
+	interval time.Duration
+	wrap     func(ctx context.Context, write func(ctx context.Context) error) error
+	onFlush  func(written, failed int)
+	mu       sync.Mutex
+	// ctx is the context full buffers are flushed under, the one of
+	// Run once it is called.
+	ctx     context.Context
+	pending []pendingDocument
+}
+
+// NewBatchWriter creates a new BatchWriter. Run must be called for
+// the documents to be written every interval.
+func NewBatchWriter(db *mongodb.MongoDb, size int, interval time.Duration, opts ...BatchOption) *BatchWriter {
+	b := &BatchWriter{
+		db:       db,
+		size:     size,
+		interval: interval,
+		wrap: func(ctx context.Context, write func(ctx context.Context) error) error {
+			return write(ctx)
+		},
+		onFlush: func(written, failed int) {},
+		ctx:     context.Background(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Add buffers the suspicious transaction. done is called once it is
+// written, with the context it was written under, telling whether it
+// was inserted or already stored, or with the error if it could not
+// be. If the buffer is full, it is flushed by the calling goroutine,
+// under the context of Run rather than the one of the caller, whose
+// deadline should not cut short the writes of the other documents.
+func (b *BatchWriter) Add(sp *models.SuspiciousTransaction, done func(ctx context.Context, inserted bool, err error)) {
+	b.mu.Lock()
+	b.pending = append(b.pending, pendingDocument{document: sp, done: done})
+	var batch []pendingDocument
+	if len(b.pending) >= b.size {
+		batch = b.take()
+	}
+	ctx := b.ctx
+	b.mu.Unlock()
+	b.write(ctx, batch)
+}
+
+// Run flushes the buffer every interval, until the context is done.
+// Full buffers are flushed under the context too.
+func (b *BatchWriter) Run(ctx context.Context) {
+	b.mu.Lock()
+	b.ctx = ctx
+	b.mu.Unlock()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.Flush(ctx)
+		}
+	}
+}
+
+// Flush writes the buffered suspicious transactions.
+func (b *BatchWriter) Flush(ctx context.Context) {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+	b.write(ctx, batch)
+}
+
+// take empties the buffer, returning what it held. It must be called
+// with the lock held.
+func (b *BatchWriter) take() []pendingDocument {
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// write inserts the batch with a single unordered bulk write and
+// calls back every document with its outcome.
+func (b *BatchWriter) write(ctx context.Context, batch []pendingDocument) {
+	if len(batch) == 0 {
+		return
+	}
+	documents := make([]mongo.WriteModel, len(batch))
+	for i, p := range batch {
+		documents[i] = mongo.NewUpdateOneModel().
+			SetFilter(filter(p.document)).
+			SetUpdate(setOnInsert(p.document)).
+			SetUpsert(true)
+	}
+	var (
+		failures map[int]error
+		upserted map[int64]interface{}
+	)
+	err := b.wrap(ctx, func(ctx context.Context) error {
+		failures, upserted = nil, nil
+		coll := collection(b.db.Client, b.db.DatabaseName, collectionName)
+		res, err := bulkWrite(ctx, coll, documents)
+		if res != nil {
+			upserted = res.UpsertedIDs
+		}
+		var bwe mongo.BulkWriteException
+		// Documents rejected by MongoDB would be rejected again, so
+		// only failures of the bulk write as a whole are returned.
+		if errors.As(err, &bwe) && bwe.WriteConcernError == nil && len(bwe.WriteErrors) > 0 {
+			failures = make(map[int]error, len(bwe.WriteErrors))
+			for _, we := range bwe.WriteErrors {
+				// A concurrent upsert of the same transaction inserted it first.
+				if we.Code == duplicateKeyCode {
+					continue
+				}
+				failures[we.Index] = we.WriteError
+			}
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		// Failing because the context was canceled is reported as
+		// such, whatever the error of the last attempt was.
+		if cause := context.Cause(ctx); cause != nil {
+			err = cause
+		}
+		err = errors.Wrapf(err, "bulk inserting %d suspicious transactions", len(batch))
+		b.onFlush(0, len(batch))
+		for _, p := range batch {
+			p.done(ctx, false, err)
+		}
+		return
+	}
+	b.onFlush(len(batch)-len(failures), len(failures))
+	for i, p := range batch {
+		if err, ok := failures[i]; ok {
+			p.done(ctx, false, errors.Wrap(err, "inserting suspicious transaction"))
+			continue
+		}
+		// Documents that were not upserted matched a stored one.
+		_, inserted := upserted[int64(i)]
+		p.done(ctx, inserted, nil)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package suspicioustransaction
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBatchWriter(t *testing.T) {
+	testCases := []struct {
+		name             string
+		mockBulkWrite    func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error)
+		expectedOutcomes []string
+		expectedWritten  int
+		expectedFailed   int
+		expectedAttempts int
+	}{
+		{
+			name: "happy path",
+			mockBulkWrite: func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+				return &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{0: 0, 1: 1, 2: 2}}, nil
+			},
+			expectedOutcomes: []string{"inserted", "inserted", "inserted"},
+			expectedWritten:  3,
+			expectedAttempts: 1,
+		},
+		{
+			name: "already stored",
+			mockBulkWrite: func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+				return &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{0: 0}}, mongo.BulkWriteException{
+					WriteErrors: []mongo.BulkWriteError{
+						{WriteError: mongo.WriteError{Index: 2, Code: duplicateKeyCode, Message: "duplicate key error"}},
+					},
+				}
+			},
+			expectedOutcomes: []string{"inserted", "duplicate", "duplicate"},
+			expectedWritten:  3,
+			expectedAttempts: 1,
+		},
+		{
+			name: "some documents fail",
+			mockBulkWrite: func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+				return &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{0: 0, 2: 2}}, mongo.BulkWriteException{
+					WriteErrors: []mongo.BulkWriteError{
+						{WriteError: mongo.WriteError{Index: 1, Code: 121, Message: "document failed validation"}},
+					},
+				}
+			},
+			expectedOutcomes: []string{"inserted", "inserting suspicious transaction: document failed validation", "inserted"},
+			expectedWritten:  2,
+			expectedFailed:   1,
+			expectedAttempts: 1,
+		},
+		{
+			name: "bulk write fails",
+			mockBulkWrite: func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+				return nil, errors.New("random error")
+			},
+			expectedOutcomes: []string{
+				"bulk inserting 3 suspicious transactions: random error",
+				"bulk inserting 3 suspicious transactions: random error",
+				"bulk inserting 3 suspicious transactions: random error",
+			},
+			expectedFailed:   3,
+			expectedAttempts: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			}
+			var batches [][]mongo.WriteModel
+			bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+				batches = append(batches, documents)
+				return tc.mockBulkWrite(ctx, collection, documents)
+			}
+			var written, failed int
+			b := NewBatchWriter(new(mongodb.MongoDb), 3, time.Hour,
+				WithBulkWriteWrapper(func(ctx context.Context, write func(ctx context.Context) error) error {
+					// A single retry.
+					if err := write(ctx); err != nil {
+						return write(ctx)
+					}
+					return nil
+				}),
+				WithFlushHandler(func(w, f int) {
+					written += w
+					failed += f
+				}),
+			)
+			outcomes := make([]string, 3)
+			for i := range outcomes {
+				i := i
+				b.Add(&models.SuspiciousTransaction{TransactionId: i}, func(ctx context.Context, inserted bool, err error) {
+					switch {
+					case err != nil:
+						outcomes[i] = err.Error()
+					case inserted:
+						outcomes[i] = "inserted"
+					default:
+						outcomes[i] = "duplicate"
+					}
+				})
+				if i < 2 {
+					require.Empty(t, batches)
+				}
+			}
+			require.Equal(t, tc.expectedOutcomes, outcomes)
+			require.Len(t, batches, tc.expectedAttempts)
+			require.Len(t, batches[0], 3)
+			require.Equal(t, tc.expectedWritten, written)
+			require.Equal(t, tc.expectedFailed, failed)
+		})
+	}
+}
+
+func TestBatchWriterRun(t *testing.T) {
+	collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+		return new(mongo.Collection)
+	}
+	var (
+		mu      sync.Mutex
+		flushed int
+	)
+	bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		flushed += len(documents)
+		return new(mongo.BulkWriteResult), nil
+	}
+	b := NewBatchWriter(new(mongodb.MongoDb), 100, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Run(ctx)
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		b.Add(new(models.SuspiciousTransaction), func(ctx context.Context, inserted bool, err error) {
+			done <- err
+		})
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("buffer was not flushed")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 2, flushed)
+}
+
+func TestBatchWriterFlush(t *testing.T) {
+	collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+		return new(mongo.Collection)
+	}
+	var calls int
+	bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		calls++
+		return &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{0: 0}}, nil
+	}
+	b := NewBatchWriter(new(mongodb.MongoDb), 100, time.Hour)
+	b.Flush(context.TODO())
+	require.Equal(t, 0, calls)
+	var written bool
+	b.Add(new(models.SuspiciousTransaction), func(ctx context.Context, inserted bool, err error) {
+		written = inserted && err == nil
+	})
+	require.False(t, written)
+	b.Flush(context.TODO())
+	require.True(t, written)
+	require.Equal(t, 1, calls)
+}
+
+func TestBatchWriterCanceled(t *testing.T) {
+	collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+		return new(mongo.Collection)
+	}
+	bulkWrite = func(ctx context.Context, collection *mongo.Collection, documents []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+		return nil, errors.New("random error")
+	}
+	stopping := errors.New("stopping")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(stopping)
+	b := NewBatchWriter(new(mongodb.MongoDb), 1, time.Hour)
+	// Full buffers are flushed under the context of Run.
+	b.Run(ctx)
+	var err error
+	b.Add(new(models.SuspiciousTransaction), func(ctx context.Context, inserted bool, e error) {
+		err = e
+	})
+	require.ErrorIs(t, err, stopping)
+	require.Equal(t, "bulk inserting 1 suspicious transactions: stopping", err.Error())
+}
@@ -13,4 +13,23 @@ type SuspiciousTransaction struct {
 	TransactionAmount float32   `bson:"transaction_amount"`
 	TransactionTime   time.Time `bson:"transaction_time"`
 	Location          string    `bson:"location"`
+	Findings          []Finding `bson:"findings"`
+	Score             float64   `bson:"score,omitempty"`
+	ScoreFactors      []Factor  `bson:"score_factors,omitempty"`
+}
+
+// Finding represents a detection rule that fired for a suspicious transaction.
+type Finding struct {
+	Rule       string         `bson:"rule"`
+	Detail     string         `bson:"detail"`
+	Attributes map[string]any `bson:"attributes,omitempty"`
+}
+
+// Factor represents the contribution of a signal to the risk score
+// of a suspicious transaction.
+type Factor struct {
+	Signal       string  `bson:"signal"`
+	Value        float64 `bson:"value"`
+	Weight       float64 `bson:"weight"`
+	Contribution float64 `bson:"contribution"`
 }
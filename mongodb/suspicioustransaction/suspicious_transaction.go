@@ -9,7 +9,15 @@ import (
 	"github.com/pkg/errors"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction/models"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionName = "suspicious_transactions"
+	// duplicateKeyCode is the code of the errors caused by a unique index.
+	duplicateKeyCode = 11000
 )
 
 // For ease of unit testing.
@@ -17,18 +25,53 @@ var (
 	collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
 		return mongoClient.Database(databaseName).Collection(collectionName)
 	}
-	insertIntoCollection = func(ctx context.Context, collection *mongo.Collection, document interface{}) (*mongo.InsertOneResult, error) {
-		return collection.InsertOne(ctx, document)
+	upsertIntoCollection = func(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+		return collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	}
+	createIndex = func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error) {
+		return collection.Indexes().CreateOne(ctx, index)
 	}
 )
 
-// Insert inserts a new suspicious transaction into the MongoDB collection.
-func Insert(ctx context.Context, db *mongodb.MongoDb, newSuspiciousTran *models.SuspiciousTransaction) error {
-	const collectionName = "suspicious_transactions"
+// EnsureIndexes creates the indexes of the suspicious transactions
+// collection, if they do not exist yet. The unique index on
+// transaction_id keeps a transaction from being stored twice.
+func EnsureIndexes(ctx context.Context, db *mongodb.MongoDb) error {
 	coll := collection(db.Client, db.DatabaseName, collectionName)
-	_, err := insertIntoCollection(ctx, coll, newSuspiciousTran)
+	_, err := createIndex(ctx, coll, mongo.IndexModel{
+		Keys:    bson.D{{Key: "transaction_id", Value: 1}},
+		Options: options.Index().SetName("transaction_id_unique").SetUnique(true),
+	})
 	if err != nil {
-		return errors.Wrap(err, "inserting suspicious transaction")
+		return errors.Wrap(err, "creating suspicious transactions index")
 	}
 	return nil
 }
+
+// Insert inserts a new suspicious transaction into the MongoDB collection,
+// unless one with the same transaction id is already there. It returns
+// whether the suspicious transaction was inserted.
+func Insert(ctx context.Context, db *mongodb.MongoDb, newSuspiciousTran *models.SuspiciousTransaction) (bool, error) {
+	coll := collection(db.Client, db.DatabaseName, collectionName)
+	res, err := upsertIntoCollection(ctx, coll, filter(newSuspiciousTran), setOnInsert(newSuspiciousTran))
+	if err != nil {
+		// A concurrent upsert of the same transaction inserted it first.
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "inserting suspicious transaction")
+	}
+	return res.UpsertedCount == 1, nil
+}
+
+// filter selects the stored suspicious transaction with the same
+// transaction id.
+func filter(sp *models.SuspiciousTransaction) bson.M {
+	return bson.M{"transaction_id": sp.TransactionId}
+}
+
+// setOnInsert is the update that stores the suspicious transaction only
+// if it is not stored yet, leaving the stored one untouched otherwise.
+func setOnInsert(sp *models.SuspiciousTransaction) bson.M {
+	return bson.M{"$setOnInsert": sp}
+}
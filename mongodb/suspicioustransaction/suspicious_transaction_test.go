@@ -11,6 +11,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction/models"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -18,7 +19,8 @@ func TestInsert(t *testing.T) {
 	testCases := []struct {
 		name                     string
 		mockCollection           func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection
-		mockInsertIntoCollection func(ctx context.Context, collection *mongo.Collection, document interface{}) (*mongo.InsertOneResult, error)
+		mockUpsertIntoCollection func(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error)
+		expectedInserted         bool
 		expectedError            error
 	}{
 		{
@@ -26,8 +28,28 @@ func TestInsert(t *testing.T) {
 			mockCollection: func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
 				return new(mongo.Collection)
 			},
-			mockInsertIntoCollection: func(ctx context.Context, collection *mongo.Collection, document interface{}) (*mongo.InsertOneResult, error) {
-				return new(mongo.InsertOneResult), nil
+			mockUpsertIntoCollection: func(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+				require.Equal(t, bson.M{"transaction_id": 7}, filter)
+				return &mongo.UpdateResult{UpsertedCount: 1}, nil
+			},
+			expectedInserted: true,
+		},
+		{
+			name: "already inserted",
+			mockCollection: func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			},
+			mockUpsertIntoCollection: func(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+				return &mongo.UpdateResult{MatchedCount: 1}, nil
+			},
+		},
+		{
+			name: "inserted concurrently",
+			mockCollection: func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			},
+			mockUpsertIntoCollection: func(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
+				return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: duplicateKeyCode}}}
 			},
 		},
 		{
@@ -35,7 +57,7 @@ func TestInsert(t *testing.T) {
 			mockCollection: func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
 				return new(mongo.Collection)
 			},
-			mockInsertIntoCollection: func(ctx context.Context, collection *mongo.Collection, document interface{}) (*mongo.InsertOneResult, error) {
+			mockUpsertIntoCollection: func(ctx context.Context, collection *mongo.Collection, filter interface{}, update interface{}) (*mongo.UpdateResult, error) {
 				return nil, errors.New("random error")
 			},
 			expectedError: errors.New("inserting suspicious transaction: random error"),
@@ -44,8 +66,52 @@ func TestInsert(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			collection = tc.mockCollection
-			insertIntoCollection = tc.mockInsertIntoCollection
-			err := Insert(context.TODO(), new(mongodb.MongoDb), new(models.SuspiciousTransaction))
+			upsertIntoCollection = tc.mockUpsertIntoCollection
+			inserted, err := Insert(context.TODO(), new(mongodb.MongoDb), &models.SuspiciousTransaction{TransactionId: 7})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedInserted, inserted)
+			}
+		})
+	}
+}
+
+func TestEnsureIndexes(t *testing.T) {
+	testCases := []struct {
+		name            string
+		mockCreateIndex func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error)
+		expectedError   error
+	}{
+		{
+			name: "happy path",
+			mockCreateIndex: func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error) {
+				require.Equal(t, bson.D{{Key: "transaction_id", Value: 1}}, index.Keys)
+				require.True(t, *index.Options.Unique)
+				return *index.Options.Name, nil
+			},
+		},
+		{
+			name: "error",
+			mockCreateIndex: func(ctx context.Context, collection *mongo.Collection, index mongo.IndexModel) (string, error) {
+				return "", errors.New("random error")
+			},
+			expectedError: errors.New("creating suspicious transactions index: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			collection = func(mongoClient *mongo.Client, databaseName, collectionName string) *mongo.Collection {
+				return new(mongo.Collection)
+			}
+			createIndex = tc.mockCreateIndex
+			err := EnsureIndexes(context.TODO(), new(mongodb.MongoDb))
 			if err != nil {
 				if tc.expectedError == nil {
 					t.Fatalf(`expected no error, got "%v"`, err)
@@ -0,0 +1,172 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package offset
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// Tracker tracks the messages of every partition that are being
+// processed, so that the committed offset of a partition never goes
+// past a message whose processing did not complete. Messages complete
+// out of order, since they are processed concurrently; the offset to
+// commit is the one after the highest contiguous completed message.
+type Tracker struct {
+	mu         sync.Mutex
+	partitions map[partitionKey]*partition
+}
+
+// partitionKey identifies a partition of a topic.
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partition is the processing state of a partition.
+type partition struct {
+	// pending holds the offsets of the messages being processed, in order.
+	pending []kafka.Offset
+	done    map[kafka.Offset]bool
+	// next is the offset to commit, and committed the last one committed.
+	next      kafka.Offset
+	committed kafka.Offset
+}
+
+// NewTracker creates a new Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{partitions: make(map[partitionKey]*partition)}
+}
+
+// keyOf returns the key of the partition of tp.
+func keyOf(tp kafka.TopicPartition) partitionKey {
+	var topic string
+	if tp.Topic != nil {
+		topic = *tp.Topic
+	}
+	return partitionKey{topic: topic, partition: tp.Partition}
+}
+
+// Track records that the message at tp is about to be processed.
+// It must be called in the order the messages are consumed.
+func (t *Tracker) Track(tp kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := keyOf(tp)
+	p, ok := t.partitions[key]
+	if !ok {
+		p = &partition{done: make(map[kafka.Offset]bool), next: tp.Offset, committed: tp.Offset}
+		t.partitions[key] = p
+	}
+	p.pending = append(p.pending, tp.Offset)
+}
+
+// Done records that the processing of the message at tp completed.
+// Messages that are not being processed, like the ones of partitions
+// that were forgotten, are ignored.
+func (t *Tracker) Done(tp kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.partitions[keyOf(tp)]
+	if !ok {
+		return
+	}
+	// Offsets are tracked in order.
+	i := sort.Search(len(p.pending), func(i int) bool { return p.pending[i] >= tp.Offset })
+	if i == len(p.pending) || p.pending[i] != tp.Offset {
+		return
+	}
+	p.done[tp.Offset] = true
+	for len(p.pending) > 0 && p.done[p.pending[0]] {
+		delete(p.done, p.pending[0])
+		p.next = p.pending[0] + 1
+		p.pending = p.pending[1:]
+	}
+}
+
+// Pending returns the number of messages being processed.
+func (t *Tracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var n int
+	for _, p := range t.partitions {
+		n += len(p.pending)
+	}
+	return n
+}
+
+// Committable returns the offsets to commit of the partitions that
+// advanced since their last commit, restricted to the given partitions
+// if any is given.
+func (t *Tracker) Committable(partitions ...kafka.TopicPartition) []kafka.TopicPartition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var only map[partitionKey]bool
+	if len(partitions) > 0 {
+		only = make(map[partitionKey]bool, len(partitions))
+		for _, tp := range partitions {
+			only[keyOf(tp)] = true
+		}
+	}
+	var offsets []kafka.TopicPartition
+	for key, p := range t.partitions {
+		if only != nil && !only[key] {
+			continue
+		}
+		if p.next <= p.committed {
+			continue
+		}
+		topic := key.topic
+		offsets = append(offsets, kafka.TopicPartition{Topic: &topic, Partition: key.partition, Offset: p.next})
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		if *offsets[i].Topic != *offsets[j].Topic {
+			return *offsets[i].Topic < *offsets[j].Topic
+		}
+		return offsets[i].Partition < offsets[j].Partition
+	})
+	return offsets
+}
+
+// Commit commits the committable offsets, restricted to the given
+// partitions if any is given, with the commit function, which is
+// usually the CommitOffsets method of the consumer.
+func (t *Tracker) Commit(commit func(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error), partitions ...kafka.TopicPartition) error {
+	offsets := t.Committable(partitions...)
+	if len(offsets) == 0 {
+		return nil
+	}
+	committed, err := commit(offsets)
+	if err != nil {
+		return errors.Wrap(err, "committing offsets")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tp := range committed {
+		if tp.Error != nil {
+			err = errors.Wrapf(tp.Error, "committing offset %v of partition %d", tp.Offset, tp.Partition)
+			continue
+		}
+		if p, ok := t.partitions[keyOf(tp)]; ok && tp.Offset > p.committed {
+			p.committed = tp.Offset
+		}
+	}
+	return err
+}
+
+// Forget stops tracking the given partitions, usually because they
+// were revoked from this consumer, dropping all their state. Messages
+// of these partitions that are still being processed will be consumed
+// again by their new owner; their completion is ignored, even if the
+// partitions are tracked again meanwhile.
+func (t *Tracker) Forget(partitions []kafka.TopicPartition) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tp := range partitions {
+		delete(t.partitions, keyOf(tp))
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package offset
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+var topic = "transactions"
+
+func tp(partition int32, offset kafka.Offset) kafka.TopicPartition {
+	return kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: offset}
+}
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker()
+	for _, o := range []kafka.Offset{10, 11, 12, 14} {
+		tr.Track(tp(0, o))
+	}
+	tr.Track(tp(1, 5))
+	require.Equal(t, 5, tr.Pending())
+	require.Empty(t, tr.Committable())
+
+	// 11 is done, but 10 is still being processed.
+	tr.Done(tp(0, 11))
+	require.Empty(t, tr.Committable())
+
+	tr.Done(tp(0, 10))
+	require.Equal(t, []kafka.TopicPartition{tp(0, 12)}, tr.Committable())
+
+	// Offsets may have gaps, like 13 here.
+	tr.Done(tp(0, 14))
+	tr.Done(tp(0, 12))
+	tr.Done(tp(1, 5))
+	require.Equal(t, []kafka.TopicPartition{tp(0, 15), tp(1, 6)}, tr.Committable())
+	require.Equal(t, []kafka.TopicPartition{tp(1, 6)}, tr.Committable(tp(1, 0)))
+	require.Zero(t, tr.Pending())
+
+	tr.Forget([]kafka.TopicPartition{tp(1, 0)})
+	tr.Done(tp(1, 6))
+	require.Equal(t, []kafka.TopicPartition{tp(0, 15)}, tr.Committable())
+
+	// A message of a forgotten partition completing after the partition
+	// is tracked again leaves nothing behind.
+	tr.Track(tp(1, 20))
+	tr.Track(tp(1, 21))
+	tr.Forget([]kafka.TopicPartition{tp(1, 0)})
+	tr.Track(tp(1, 30))
+	tr.Done(tp(1, 21))
+	tr.Done(tp(1, 20))
+	require.Empty(t, tr.partitions[keyOf(tp(1, 0))].done)
+	require.Equal(t, 1, tr.Pending())
+	tr.Done(tp(1, 30))
+	require.Empty(t, tr.partitions[keyOf(tp(1, 0))].done)
+	require.Equal(t, []kafka.TopicPartition{tp(1, 31)}, tr.Committable(tp(1, 0)))
+}
+
+func TestCommit(t *testing.T) {
+	testCases := []struct {
+		name              string
+		mockCommit        func(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+		expectedRemaining []kafka.TopicPartition
+		expectedError     error
+	}{
+		{
+			name: "happy path",
+			mockCommit: func(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+				return offsets, nil
+			},
+		},
+		{
+			name: "error",
+			mockCommit: func(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+				return nil, errors.New("random error")
+			},
+			expectedRemaining: []kafka.TopicPartition{tp(0, 2), tp(1, 1)},
+			expectedError:     errors.New("committing offsets: random error"),
+		},
+		{
+			name: "error on a partition",
+			mockCommit: func(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+				failed := offsets[1]
+				failed.Error = errors.New("random error")
+				return []kafka.TopicPartition{offsets[0], failed}, nil
+			},
+			expectedRemaining: []kafka.TopicPartition{tp(1, 1)},
+			expectedError:     errors.New("committing offset 1 of partition 1: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := NewTracker()
+			tr.Track(tp(0, 0))
+			tr.Track(tp(0, 1))
+			tr.Track(tp(1, 0))
+			tr.Done(tp(0, 0))
+			tr.Done(tp(0, 1))
+			tr.Done(tp(1, 0))
+			err := tr.Commit(tc.mockCommit)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+			}
+			require.Equal(t, tc.expectedRemaining, tr.Committable())
+		})
+	}
+}
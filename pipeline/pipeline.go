@@ -0,0 +1,163 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package pipeline
+
+import (
+	"context"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/stats"
+)
+
+const (
+	// flushTimeoutMs is how long every call to the Flush of the producer
+	// waits, so that Flush can give up once its context is done.
+	flushTimeoutMs = 100
+	// unknownCode is the error code of failures that are not Kafka errors.
+	unknownCode = "unknown"
+)
+
+// For ease of unit testing.
+var (
+	now     = time.Now
+	produce = func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+		return p.Produce(msg, deliveryChan)
+	}
+	flush = func(p *kafka.Producer, timeoutMs int) int {
+		return p.Flush(timeoutMs)
+	}
+)
+
+// Option configures a Pipeline.
+type Option func(p *Pipeline)
+
+// WithDeliveryHandler sets the function called with the delivery
+// report of every message, successful or not.
+func WithDeliveryHandler(onDelivery func(m *kafka.Message)) Option {
+	return func(p *Pipeline) {
+		p.onDelivery = onDelivery
+	}
+}
+
+// envelope wraps the opaque of a message while it is in flight, along
+// with when it was produced.
+type envelope struct {
+	opaque   interface{}
+	produced time.Time
+}
+
+// Pipeline publishes messages without waiting for each of them to be
+// delivered. Up to depth messages can be in flight, that is, produced
+// but not acknowledged by Kafka yet; delivery reports are handled on
+// a goroutine of their own.
+type Pipeline struct {
+	producer   *kafka.Producer
+	stats      *stats.KafkaProducerStats
+	onDelivery func(m *kafka.Message)
+	inFlight   chan struct{}
+	deliveries chan kafka.Event
+	done       chan struct{}
+}
+
+// New creates a new Pipeline that publishes with the producer, keeping
+// up to depth messages in flight. Close must be called once done.
+func New(producer *kafka.Producer, depth int, stats *stats.KafkaProducerStats, opts ...Option) *Pipeline {
+	p := &Pipeline{
+		producer:   producer,
+		stats:      stats,
+		onDelivery: func(m *kafka.Message) {},
+		inFlight:   make(chan struct{}, depth),
+		deliveries: make(chan kafka.Event, depth),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	go p.handleDeliveries()
+	return p
+}
+
+// Publish produces the message, waiting for room in the pipeline if
+// depth messages are in flight. It returns the context error if the
+// context is done first. Whether the message is delivered is counted
+// in the stats once Kafka reports it, along with its delivery latency.
+func (p *Pipeline) Publish(ctx context.Context, msg *kafka.Message) error {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	opaque := msg.Opaque
+	msg.Opaque = &envelope{opaque: opaque, produced: now()}
+	if err := produce(p.producer, msg, p.deliveries); err != nil {
+		msg.Opaque = opaque
+		<-p.inFlight
+		p.stats.IncrTotalFailedMessageDeliveries()
+		p.stats.IncrFailedMessageDeliveriesByCode(code(err))
+		return errors.Wrapf(err, "producing to topic %s", *msg.TopicPartition.Topic)
+	}
+	return nil
+}
+
+// code returns the error code of the failure.
+func code(err error) string {
+	var kerr kafka.Error
+	if errors.As(err, &kerr) {
+		return kerr.Code().String()
+	}
+	return unknownCode
+}
+
+// InFlight returns the number of messages produced whose delivery was
+// not reported yet.
+func (p *Pipeline) InFlight() int {
+	return len(p.inFlight)
+}
+
+// Flush waits for the delivery of every message in flight. It returns
+// the context error if the context is done first.
+func (p *Pipeline) Flush(ctx context.Context) error {
+	for p.InFlight() > 0 {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "flushing %d messages", p.InFlight())
+		}
+		flush(p.producer, flushTimeoutMs)
+	}
+	return nil
+}
+
+// Close stops handling delivery reports. It must be called after the
+// last Publish; messages still in flight are not counted.
+func (p *Pipeline) Close() {
+	close(p.deliveries)
+	<-p.done
+}
+
+// handleDeliveries counts the delivery report of every message and
+// frees its room in the pipeline.
+func (p *Pipeline) handleDeliveries() {
+	defer close(p.done)
+	for e := range p.deliveries {
+		m, ok := e.(*kafka.Message)
+		if !ok {
+			continue
+		}
+		if env, ok := m.Opaque.(*envelope); ok {
+			m.Opaque = env.opaque
+			if m.TopicPartition.Error == nil {
+				p.stats.RecordDeliveryLatency(now().Sub(env.produced))
+			}
+		}
+		if m.TopicPartition.Error != nil {
+			p.stats.IncrTotalFailedMessageDeliveries()
+			p.stats.IncrFailedMessageDeliveriesByCode(code(m.TopicPartition.Error))
+		} else {
+			p.stats.IncrTotalPublishedMessages()
+		}
+		p.onDelivery(m)
+		<-p.inFlight
+	}
+}
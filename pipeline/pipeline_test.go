@@ -0,0 +1,185 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/stats"
+)
+
+func message() *kafka.Message {
+	topic := "transactions"
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Value:          []byte("{}"),
+	}
+}
+
+func TestPublish(t *testing.T) {
+	testCases := []struct {
+		name              string
+		mockProduce       func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error
+		expectedPublished int64
+		expectedFailed    int64
+		expectedDelivered int
+		expectedFailures  map[string]int64
+		expectedLatency   time.Duration
+		expectedError     error
+	}{
+		{
+			name: "happy path",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				deliveryChan <- msg
+				return nil
+			},
+			expectedPublished: 1,
+			expectedDelivered: 1,
+			expectedFailures:  map[string]int64{},
+			expectedLatency:   10 * time.Millisecond,
+		},
+		{
+			name: "delivery fails",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				m := *msg
+				m.TopicPartition.Error = errors.New("random error")
+				deliveryChan <- &m
+				return nil
+			},
+			expectedFailed:    1,
+			expectedDelivered: 1,
+			expectedFailures:  map[string]int64{"unknown": 1},
+		},
+		{
+			name: "delivery times out",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				m := *msg
+				m.TopicPartition.Error = kafka.NewError(kafka.ErrMsgTimedOut, "message timed out", false)
+				deliveryChan <- &m
+				return nil
+			},
+			expectedFailed:    1,
+			expectedDelivered: 1,
+			expectedFailures:  map[string]int64{kafka.ErrMsgTimedOut.String(): 1},
+		},
+		{
+			name: "produce fails",
+			mockProduce: func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+				return errors.New("random error")
+			},
+			expectedFailed:   1,
+			expectedFailures: map[string]int64{"unknown": 1},
+			expectedError:    errors.New("producing to topic transactions: random error"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			produce = tc.mockProduce
+			flush = func(p *kafka.Producer, timeoutMs int) int {
+				return 0
+			}
+			// Every message is delivered 10ms after it is produced.
+			var clock time.Time
+			now = func() time.Time {
+				clock = clock.Add(10 * time.Millisecond)
+				return clock
+			}
+			s := new(stats.KafkaProducerStats)
+			var delivered int
+			p := New(nil, 2, s, WithDeliveryHandler(func(m *kafka.Message) {
+				require.Equal(t, "opaque", m.Opaque)
+				delivered++
+			}))
+			msg := message()
+			msg.Opaque = "opaque"
+			err := p.Publish(context.TODO(), msg)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+				// The message is left as it was.
+				require.Equal(t, "opaque", msg.Opaque)
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected "%v" error, got nil`, tc.expectedError)
+				}
+			}
+			require.NoError(t, p.Flush(context.TODO()))
+			p.Close()
+			require.Zero(t, p.InFlight())
+			require.Equal(t, tc.expectedPublished, s.TotalPublishedMessages())
+			require.Equal(t, tc.expectedFailed, s.TotalFailedMessageDeliveries())
+			require.Equal(t, tc.expectedDelivered, delivered)
+			require.Equal(t, tc.expectedFailures, s.FailedMessageDeliveriesByCode())
+			latency := s.DeliveryLatency(0.5)
+			require.GreaterOrEqual(t, latency, tc.expectedLatency)
+			require.LessOrEqual(t, latency, tc.expectedLatency*21/20)
+		})
+	}
+	now = time.Now
+}
+
+func TestPublishBounded(t *testing.T) {
+	var (
+		mu         sync.Mutex
+		unreported []kafka.Event
+		deliveries chan kafka.Event
+	)
+	produce = func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		unreported = append(unreported, msg)
+		deliveries = deliveryChan
+		return nil
+	}
+	// Flushing reports the delivery of what was produced.
+	flush = func(p *kafka.Producer, timeoutMs int) int {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, e := range unreported {
+			deliveries <- e
+		}
+		unreported = nil
+		return 0
+	}
+	s := new(stats.KafkaProducerStats)
+	p := New(nil, 2, s)
+	defer p.Close()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, p.Publish(context.TODO(), message()))
+	}
+	require.Equal(t, 2, p.InFlight())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Publish(ctx, message()), context.DeadlineExceeded)
+	require.NoError(t, p.Flush(context.TODO()))
+	require.Zero(t, p.InFlight())
+	require.Equal(t, int64(2), s.TotalPublishedMessages())
+	require.NoError(t, p.Publish(context.TODO(), message()))
+	require.Equal(t, 1, p.InFlight())
+}
+
+func TestFlushCanceled(t *testing.T) {
+	produce = func(p *kafka.Producer, msg *kafka.Message, deliveryChan chan kafka.Event) error {
+		return nil
+	}
+	flush = func(p *kafka.Producer, timeoutMs int) int {
+		return 1
+	}
+	p := New(nil, 2, new(stats.KafkaProducerStats))
+	defer p.Close()
+	require.NoError(t, p.Publish(context.TODO(), message()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := p.Flush(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, "flushing 1 messages: context canceled", err.Error())
+}
@@ -4,43 +4,142 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"sort"
+	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/jessevdk/go-flags"
 	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/checkpoint"
 	"github.com/tiagomelo/realtime-data-kafka/config"
+	"github.com/tiagomelo/realtime-data-kafka/input"
+	"github.com/tiagomelo/realtime-data-kafka/messagekey"
+	"github.com/tiagomelo/realtime-data-kafka/pipeline"
 	"github.com/tiagomelo/realtime-data-kafka/screen"
 	"github.com/tiagomelo/realtime-data-kafka/stats"
+	"github.com/tiagomelo/realtime-data-kafka/throttle"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
 )
 
-const bootstrapServersKey = "bootstrap.servers"
+const (
+	bootstrapServersKey          = "bootstrap.servers"
+	queueBufferingMaxMessagesKey = "queue.buffering.max.messages"
+	checkpointInterval           = time.Second
+)
 
 func stringPrt(s string) *string {
 	return &s
 }
 
-func run(log *log.Logger, cfg *config.Config, transactionsFile string) error {
+// settings are how the lines are published.
+type settings struct {
+	extractKey messagekey.Extractor
+	strictKey  bool
+	// maxLineSize is the size of the longest line that is published.
+	maxLineSize int
+	// rate is the limit of messages per second; zero means no limit.
+	rate float64
+	// replaySpeed spaces the messages by the time between their
+	// transactions, sped up by it; zero means no spacing.
+	replaySpeed float64
+	// checkpoint checkpoints every file but stdin to its sidecar file.
+	checkpoint bool
+	// resume resumes every file from its checkpoint.
+	resume bool
+}
+
+// lineRef is the line of a message, set as its opaque, so its delivery
+// report can be checkpointed.
+type lineRef struct {
+	tracker *checkpoint.Tracker
+	line    int
+	offset  int64
+}
+
+// rateBurst returns the burst of the token bucket of the rate: about
+// 10ms worth of messages, so high rates are not held back by the
+// granularity of timers.
+func rateBurst(rate float64) int {
+	if burst := int(rate / 100); burst > 1 {
+		return burst
+	}
+	return 1
+}
+
+func run(log *log.Logger, cfg *config.Config, transactionsFiles []string, set settings) error {
 	log.Println("main: Initializing Kafka producer")
 	defer log.Println("main: Completed")
 	producer, err := kafka.NewProducer(&kafka.ConfigMap{
 		bootstrapServersKey: cfg.KafkaBrokerHost,
+		// The producer must be able to queue every message in flight.
+		queueBufferingMaxMessagesKey: cfg.KafkaProducerQueueDepth,
 	})
 	if err != nil {
 		return errors.Wrap(err, "creating producer")
 	}
-	defer producer.Close()
-	file, err := os.Open(transactionsFile)
+	stats := &stats.KafkaProducerStats{}
+
+	// Messages are published without waiting for each delivery; up to
+	// KAFKA_PRODUCER_QUEUE_DEPTH of them can be in flight. A line is
+	// checkpointed once its message is acknowledged.
+	publisher := pipeline.New(producer, cfg.KafkaProducerQueueDepth, stats,
+		pipeline.WithDeliveryHandler(func(m *kafka.Message) {
+			ref, ok := m.Opaque.(*lineRef)
+			if !ok {
+				return
+			}
+			if m.TopicPartition.Error != nil {
+				ref.tracker.Failed(ref.line)
+				return
+			}
+			ref.tracker.Done(ref.line, ref.offset)
+		}),
+	)
+	defer func() {
+		// No delivery is reported once the producer is closed.
+		producer.Close()
+		publisher.Close()
+	}()
+	files, err := input.Expand(transactionsFiles)
 	if err != nil {
-		return errors.Wrapf(err, "opening file %s", transactionsFile)
+		return errors.Wrap(err, "expanding input files")
+	}
+	for _, file := range files {
+		if set.resume && file == input.Stdin {
+			return errors.New("stdin cannot be resumed")
+		}
+	}
+
+	// With checkpointing, every file but stdin is checkpointed to its
+	// sidecar file.
+	var (
+		checkpointing sync.Mutex
+		trackers      []*checkpoint.Tracker
+	)
+	saveCheckpoints := func() {
+		checkpointing.Lock()
+		defer checkpointing.Unlock()
+		for _, t := range trackers {
+			if err := t.Save(); err != nil {
+				log.Println(err)
+			}
+		}
 	}
-	defer file.Close()
+	go func() {
+		for {
+			time.Sleep(checkpointInterval)
+			saveCheckpoints()
+		}
+	}()
 
 	// Make a channel to listen for an interrupt or terminate signal from the OS.
 	// Use a buffered channel because the signal package requires it.
@@ -51,7 +150,6 @@ func run(log *log.Logger, cfg *config.Config, transactionsFile string) error {
 	// buffered channel so the goroutine can exit if we don't collect this error.
 	serverErrors := make(chan error, 1)
 
-	stats := &stats.KafkaProducerStats{}
 	screen, err := screen.NewKafkaProducerScreen(stats)
 	if err != nil {
 		return errors.New("starting screen")
@@ -59,51 +157,251 @@ func run(log *log.Logger, cfg *config.Config, transactionsFile string) error {
 
 	start := time.Now()
 
+	// The screen is refreshed every second until the final update.
+	stopRefreshing := make(chan struct{})
+	refreshing := make(chan struct{})
 	go func() {
+		defer close(refreshing)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		last, delivered := start, int64(0)
 		for {
-			time.Sleep(time.Second * time.Duration(1))
+			select {
+			case <-stopRefreshing:
+				return
+			case <-ticker.C:
+			}
 			stats.UpdateElapsedTime(time.Since(start))
+			// Throughput is the rate of messages delivered since the
+			// last refresh.
+			t, d := time.Now(), stats.TotalPublishedMessages()
+			stats.UpdateThroughput(float64(d-delivered) / t.Sub(last).Seconds())
+			last, delivered = t, d
+			stats.UpdateInFlightMessages(publisher.InFlight())
 			screen.UpdateContent(false)
 		}
 	}()
 
-	deliveryChan := make(chan kafka.Event)
-	scanner := bufio.NewScanner(file)
+	ctx, stopReading := context.WithCancel(context.Background())
+	defer stopReading()
+	reading := make(chan struct{})
+	var (
+		limiter  *throttle.TokenBucket
+		replayer *throttle.Replayer
+	)
+	if set.rate > 0 {
+		limiter = throttle.NewTokenBucket(set.rate, rateBurst(set.rate))
+	}
+	if set.replaySpeed > 0 {
+		replayer = throttle.NewReplayer(set.replaySpeed)
+	}
 
-	go func() {
-		for scanner.Scan() {
-			line := scanner.Text()
-			if err := producer.Produce(&kafka.Message{
+	// publishFile publishes the lines of the file. It returns the
+	// error that stopped reading it, if any, or the context error.
+	publishFile := func(file string) error {
+		r, err := input.Open(file)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		scanner := input.NewScanner(file, r, set.maxLineSize)
+		var tracker *checkpoint.Tracker
+		if set.checkpoint && file != input.Stdin {
+			var from checkpoint.Position
+			if set.resume {
+				if from, err = checkpoint.Read(file); err != nil {
+					return err
+				}
+				if err := input.Skip(r, from.Offset); err != nil {
+					return errors.Wrapf(err, "resuming %s", file)
+				}
+				scanner.SetPosition(from.Line, from.Offset)
+				log.Printf("run: resuming %s after line %d", file, from.Line)
+			} else if err := checkpoint.Write(file, from); err != nil {
+				return err
+			}
+			tracker = checkpoint.NewTracker(file, from)
+			checkpointing.Lock()
+			trackers = append(trackers, tracker)
+			checkpointing.Unlock()
+		}
+		// skip checkpoints a line that is not published.
+		skip := func() {
+			if tracker != nil {
+				tracker.Done(scanner.Line(), scanner.Offset())
+			}
+		}
+		for {
+			line, err := scanner.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if errors.Is(err, input.ErrLineTooLong) {
+				stats.IncrTotalRejectedLines()
+				log.Printf("rejecting line: %v", err)
+				skip()
+				continue
+			}
+			if err != nil {
+				return errors.Wrap(err, "reading line")
+			}
+			// The line is reused by the scanner.
+			line = append([]byte(nil), line...)
+			// Messages with the same key, like the transactions of an
+			// account, go to the same partition.
+			key, err := set.extractKey(line)
+			if err != nil && set.strictKey {
+				stats.IncrTotalRejectedLines()
+				log.Printf("rejecting line %d of %s: %v", scanner.Line(), file, err)
+				skip()
+				continue
+			}
+			// Lines without transaction time are not spaced.
+			if replayer != nil {
+				if t, err := transaction.New(string(line)); err == nil && !t.TransactionTime.IsZero() {
+					if err := replayer.Wait(ctx, t.TransactionTime); err != nil {
+						return err
+					}
+				}
+			}
+			if limiter != nil {
+				if err := limiter.Wait(ctx); err != nil {
+					return err
+				}
+			}
+			msg := &kafka.Message{
 				TopicPartition: kafka.TopicPartition{Topic: stringPrt(cfg.KafkaTopic), Partition: kafka.PartitionAny},
-				Value:          []byte(line),
-			}, deliveryChan); err != nil {
-				log.Printf("%v when publishing to kafka topic %s", err, cfg.KafkaTopic)
+				Key:            key,
+				Value:          line,
 			}
-			stats.IncrTotalPublishedMessages()
-			delivery := <-deliveryChan
-			m := delivery.(*kafka.Message)
-			if m.TopicPartition.Error != nil {
-				stats.IncrTotalFailedMessageDeliveries()
+			if tracker != nil {
+				msg.Opaque = &lineRef{tracker: tracker, line: scanner.Line(), offset: scanner.Offset()}
+			}
+			if err := publisher.Publish(ctx, msg); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				log.Printf("line %d of %s: %v", scanner.Line(), file, err)
+				if tracker != nil {
+					tracker.Failed(scanner.Line())
+				}
 			}
 		}
-		if err := scanner.Err(); err != nil {
-			errors.Wrapf(err, "reading file %s", transactionsFile)
+	}
+
+	// finished is closed once every line was read.
+	finished := make(chan struct{})
+
+	go func() {
+		defer close(reading)
+		// Files are published one after the other, in order.
+		for _, file := range files {
+			if err := publishFile(file); err != nil {
+				if ctx.Err() == nil {
+					serverErrors <- err
+				}
+				return
+			}
 		}
+		close(finished)
 	}()
 
-	// Wait for any error or interrupt signal.
+	// finish waits for the messages in flight to be delivered, until
+	// the context is done, then updates the screen one last time and
+	// prints the summary. It fails if any message was not delivered.
+	finish := func(ctx context.Context) error {
+		if err := publisher.Flush(ctx); err != nil {
+			log.Println(err)
+		}
+		saveCheckpoints()
+		close(stopRefreshing)
+		<-refreshing
+		elapsed := time.Since(start)
+		stats.UpdateElapsedTime(elapsed)
+		// The final throughput is the one of the whole run.
+		stats.UpdateThroughput(float64(stats.TotalPublishedMessages()) / elapsed.Seconds())
+		stats.UpdateInFlightMessages(publisher.InFlight())
+		if err := screen.UpdateContent(true); err != nil {
+			log.Println(err)
+		}
+		printSummary(os.Stdout, stats)
+		if undelivered := stats.TotalFailedMessageDeliveries() + stats.InFlightMessages(); undelivered > 0 {
+			return errors.Errorf("%d messages were not delivered", undelivered)
+		}
+		return nil
+	}
+
+	// Wait for the end of input, any error or interrupt signal.
 	select {
 	case err := <-serverErrors:
+		stopReading()
+		<-reading
+		// Waits for the messages in flight to be delivered for up to
+		// SHUTDOWN_TIMEOUT.
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancelFlush()
+		if ferr := finish(flushCtx); ferr != nil {
+			log.Println(ferr)
+		}
 		return err
+	case <-finished:
+		log.Println("run: end of input")
+		// The messages in flight are waited for until delivered, or
+		// until an interrupt signal.
+		deliveredCtx, stopWaiting := context.WithCancel(context.Background())
+		defer stopWaiting()
+		go func() {
+			select {
+			case sig := <-shutdown:
+				log.Printf("run: %v: Stop waiting for deliveries", sig)
+				stopWaiting()
+			case <-deliveredCtx.Done():
+			}
+		}()
+		return finish(deliveredCtx)
 	case sig := <-shutdown:
-		screen.UpdateContent(true)
 		log.Printf("run: %v: Start shutdown", sig)
-		return nil
+		stopReading()
+		<-reading
+		flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancelFlush()
+		return finish(flushCtx)
 	}
 }
 
+// printSummary prints the summary of the run.
+func printSummary(w io.Writer, stats *stats.KafkaProducerStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Summary")
+	fmt.Fprintf(tw, "  Published messages:\t%d\n", stats.TotalPublishedMessages())
+	fmt.Fprintf(tw, "  Message delivery errors:\t%d\n", stats.TotalFailedMessageDeliveries())
+	failures := stats.FailedMessageDeliveriesByCode()
+	codes := make([]string, 0, len(failures))
+	for code := range failures {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(tw, "    %s:\t%d\n", code, failures[code])
+	}
+	fmt.Fprintf(tw, "  Undelivered messages in flight:\t%d\n", stats.InFlightMessages())
+	fmt.Fprintf(tw, "  Rejected lines:\t%d\n", stats.TotalRejectedLines())
+	fmt.Fprintf(tw, "  Elapsed time:\t%s\n", stats.ElapsedTime().Round(time.Millisecond))
+	fmt.Fprintf(tw, "  Throughput:\t%.0f msg/s\n", stats.Throughput())
+	fmt.Fprintf(tw, "  Delivery latency p50:\t%s\n", stats.DeliveryLatency(0.5).Round(time.Microsecond))
+	fmt.Fprintf(tw, "  Delivery latency p99:\t%s\n", stats.DeliveryLatency(0.99).Round(time.Microsecond))
+	tw.Flush()
+}
+
 var opts struct {
-	File string `short:"f" long:"file" description:"input file" required:"true"`
+	Files        []string `short:"f" long:"file" description:"input file, directory or glob pattern, - for stdin; .gz and .zst files are decompressed; can be repeated" required:"true"`
+	MaxLineSize  int      `long:"max-line-size" description:"size in bytes of the longest line; longer lines are rejected" default:"1048576"`
+	Key          string   `long:"key" description:"message key: a field name, a JSON pointer like /account/number, or none" default:"account_number"`
+	StrictKey    bool     `long:"strict-key" description:"reject the lines without key instead of publishing them unkeyed"`
+	Rate         float64  `long:"rate" description:"maximum messages per second; 0 for no limit"`
+	NoCheckpoint bool     `long:"no-checkpoint" description:"do not checkpoint the files to sidecar files, so they cannot be resumed"`
+	Resume       bool     `long:"resume" description:"resume every file after its last checkpointed line"`
+	ReplaySpeed  float64  `long:"replay-speed" description:"space messages by the time between their transactions, sped up by this factor (10 is ten times real time); 0 for no spacing"`
 }
 
 func main() {
@@ -111,7 +409,15 @@ func main() {
 		envFile     = ".env"
 		logFileName = "logs/producer.txt"
 	)
-	flags.ParseArgs(&opts, os.Args)
+	parser := flags.NewParser(&opts, flags.Default)
+	if _, err := parser.ParseArgs(os.Args); err != nil {
+		// The error was printed already, along with the usage if asked for.
+		if flagsErr, ok := err.(*flags.Error); ok && flagsErr.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		parser.WriteHelp(os.Stderr)
+		os.Exit(1)
+	}
 	logFile, err := os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Printf(`opening log file "%s": %v`, logFileName, err)
@@ -123,7 +429,42 @@ func main() {
 		fmt.Println(errors.Wrap(err, "reading config"))
 		os.Exit(1)
 	}
-	if err := run(log, cfg, opts.File); err != nil {
+	extractKey, err := messagekey.New(opts.Key)
+	if err != nil {
+		log.Println(errors.Wrap(err, "parsing key"))
+		fmt.Println(errors.Wrap(err, "parsing key"))
+		os.Exit(1)
+	}
+	if opts.StrictKey && opts.Key == messagekey.None {
+		log.Println("--strict-key requires a key")
+		fmt.Println("--strict-key requires a key")
+		os.Exit(1)
+	}
+	if opts.MaxLineSize < 1 {
+		log.Println("--max-line-size must be positive")
+		fmt.Println("--max-line-size must be positive")
+		os.Exit(1)
+	}
+	if opts.Rate < 0 || opts.ReplaySpeed < 0 {
+		log.Println("--rate and --replay-speed cannot be negative")
+		fmt.Println("--rate and --replay-speed cannot be negative")
+		os.Exit(1)
+	}
+	if opts.NoCheckpoint && opts.Resume {
+		log.Println("--resume cannot be used with --no-checkpoint")
+		fmt.Println("--resume cannot be used with --no-checkpoint")
+		os.Exit(1)
+	}
+	set := settings{
+		extractKey:  extractKey,
+		maxLineSize: opts.MaxLineSize,
+		strictKey:   opts.StrictKey,
+		rate:        opts.Rate,
+		replaySpeed: opts.ReplaySpeed,
+		checkpoint:  !opts.NoCheckpoint,
+		resume:      opts.Resume,
+	}
+	if err := run(log, cfg, opts.Files, set); err != nil {
 		log.Println(err)
 		fmt.Println(err)
 		os.Exit(1)
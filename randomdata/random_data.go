@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -34,43 +35,151 @@ var locations = []string{
 	"Washington, DC",
 }
 
-// TransactionID generates a random transaction ID.
+// Transaction IDs are sequential from a random offset within the first
+// maxIDOffset IDs, so they never collide, even across millions of
+// transactions. Every split gets the next idsPerSplit of them.
+const (
+	minTransactionID = 1111111111
+	maxIDOffset      = 1_000_000_000
+	idsPerSplit      = 64
+)
+
+// Generator generates random data from its own seeded source, so the
+// same seed always generates the same sequence of values.
+// A Generator is not safe for concurrent use; use Split to give each
+// goroutine its own.
+type Generator struct {
+	r   *rand.Rand
+	now time.Time
+	// nextID is the next transaction ID; endID, unless zero, is the
+	// end of the IDs this Generator can issue.
+	nextID int
+	endID  int
+}
+
+// NewGenerator creates a new Generator with the given seed. Transaction
+// times are generated within the 24 hours before now; if now is zero,
+// the current time at each call is used instead.
+func NewGenerator(seed int64, now time.Time) *Generator {
+	g := &Generator{r: rand.New(rand.NewSource(seed)), now: now}
+	g.nextID = minTransactionID + g.r.Intn(maxIDOffset)
+	return g
+}
+
+// Split creates a new Generator seeded from this one. It can issue up
+// to idsPerSplit transaction IDs, which this one never issues.
+func (g *Generator) Split() *Generator {
+	firstID := g.reserveIDs(idsPerSplit)
+	return &Generator{
+		r:      rand.New(rand.NewSource(g.r.Int63())),
+		now:    g.now,
+		nextID: firstID,
+		endID:  firstID + idsPerSplit,
+	}
+}
+
+// reserveIDs reserves the next n transaction IDs and returns the first.
+func (g *Generator) reserveIDs(n int) int {
+	if g.endID != 0 && g.nextID+n > g.endID {
+		panic("randomdata: generator ran out of transaction IDs")
+	}
+	id := g.nextID
+	g.nextID += n
+	return id
+}
+
+// Now returns the reference time of the generated transaction times.
+func (g *Generator) Now() time.Time {
+	if g.now.IsZero() {
+		return time.Now()
+	}
+	return g.now
+}
+
+// Intn returns a random int in [0, n).
+func (g *Generator) Intn(n int) int {
+	return g.r.Intn(n)
+}
+
+// Duration returns a random duration in [min, max).
+func (g *Generator) Duration(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(g.r.Int63n(int64(max-min)))
+}
+
+// Shuffle randomizes the order of n elements using swap.
+func (g *Generator) Shuffle(n int, swap func(i, j int)) {
+	g.r.Shuffle(n, swap)
+}
+
+// TransactionID generates a transaction ID, unique among the ones of
+// this Generator and of its splits.
+func (g *Generator) TransactionID() int {
+	return g.reserveIDs(1)
+}
+
+// AccountNumber generates a random account number.
+func (g *Generator) AccountNumber() int {
+	return g.r.Intn(999999999-111111111+1) + 111111111
+}
+
+// TransactionAmount generates a random transaction amount between the specified minimum and maximum amounts.
+func (g *Generator) TransactionAmount(minAmount, maxAmount float32) float32 {
+	randomAmount := g.r.Float32()*(maxAmount-minAmount) + minAmount
+	formattedAmount, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", randomAmount), 32)
+	return float32(formattedAmount)
+}
+
+// TransactionTime generates a random transaction time within the 24 hours before Now.
+func (g *Generator) TransactionTime() time.Time {
+	randomDuration := time.Duration(g.r.Intn(86400)) * time.Second
+	return g.Now().Add(-randomDuration)
+}
+
+// Location generates a random transaction location from the pre-defined locations.
+func (g *Generator) Location() string {
+	return locations[g.r.Intn(len(locations))]
+}
+
+// defaultGenerator backs the package-level functions.
+var (
+	mu               sync.Mutex
+	defaultGenerator = NewGenerator(time.Now().UnixNano(), time.Time{})
+)
+
+// TransactionID generates a transaction ID, unique within the process.
 func TransactionID() int {
-	seed := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(seed))
-	r.Seed(time.Now().UnixNano())
-	return r.Intn(9999999999-1111111111+1) + 1111111111
+	mu.Lock()
+	defer mu.Unlock()
+	return defaultGenerator.TransactionID()
 }
 
 // AccountNumber generates a random account number.
 func AccountNumber() int {
-	seed := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(seed))
-	r.Seed(time.Now().UnixNano())
-	return r.Intn(999999999-111111111+1) + 111111111
+	mu.Lock()
+	defer mu.Unlock()
+	return defaultGenerator.AccountNumber()
 }
 
 // TransactionAmount generates a random transaction amount between the specified minimum and maximum amounts.
 func TransactionAmount(minAmount, maxAmount float32) float32 {
-	seed := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(seed))
-	randomAmount := r.Float32()*(maxAmount-minAmount) + minAmount
-	formattedAmount, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", randomAmount), 32)
-	return float32(formattedAmount)
+	mu.Lock()
+	defer mu.Unlock()
+	return defaultGenerator.TransactionAmount(minAmount, maxAmount)
 }
 
 // TransactionTime generates a random transaction time within the last 24 hours.
 func TransactionTime() time.Time {
-	seed := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(seed))
-	randomDuration := time.Duration(r.Intn(86400)) * time.Second
-	randomTime := time.Now().Add(-randomDuration)
-	return randomTime
+	mu.Lock()
+	defer mu.Unlock()
+	return defaultGenerator.TransactionTime()
 }
 
 // Location generates a random transaction location from the pre-defined locations.
 func Location() string {
-	seed := time.Now().UnixNano()
-	r := rand.New(rand.NewSource(seed))
-	return locations[r.Intn(len(locations))]
+	mu.Lock()
+	defer mu.Unlock()
+	return defaultGenerator.Location()
 }
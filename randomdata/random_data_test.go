@@ -6,6 +6,8 @@ package randomdata
 import (
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestTransactionID(t *testing.T) {
@@ -53,3 +55,54 @@ func TestLocation(t *testing.T) {
 		t.Errorf("Invalid random location: %s", location)
 	}
 }
+
+func TestGenerator(t *testing.T) {
+	now := time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+	g := NewGenerator(42, now)
+	require.Equal(t, 1912183416, g.TransactionID())
+	require.Equal(t, 1912183417, g.TransactionID())
+	require.Equal(t, 252846098, g.AccountNumber())
+	require.Equal(t, float32(643.68), g.TransactionAmount(100, 1000))
+	require.Equal(t, time.Date(2023, 6, 4, 18, 47, 30, 0, time.UTC), g.TransactionTime())
+	require.Equal(t, "Houston, TX", g.Location())
+	require.Equal(t, now, g.Now())
+
+	// The same seed always gives the same values.
+	a, b := NewGenerator(7, now), NewGenerator(7, now)
+	for i := 0; i < 100; i++ {
+		require.Equal(t, a.TransactionID(), b.TransactionID())
+	}
+	require.Equal(t, a.Split().AccountNumber(), b.Split().AccountNumber())
+}
+
+func TestGeneratorTransactionIDUnique(t *testing.T) {
+	g := NewGenerator(42, time.Time{})
+	seen := make(map[int]bool)
+	issue := func(g *Generator, n int) {
+		for i := 0; i < n; i++ {
+			id := g.TransactionID()
+			require.False(t, seen[id], "duplicate transaction ID %d", id)
+			require.GreaterOrEqual(t, id, 1111111111)
+			require.LessOrEqual(t, id, 9999999999)
+			seen[id] = true
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		issue(g.Split(), 1+i%idsPerSplit)
+		issue(g, 1)
+	}
+	require.PanicsWithValue(t, "randomdata: generator ran out of transaction IDs", func() {
+		issue(g.Split(), idsPerSplit+1)
+	})
+}
+
+func TestGeneratorDuration(t *testing.T) {
+	g := NewGenerator(1, time.Time{})
+	for i := 0; i < 100; i++ {
+		d := g.Duration(time.Minute, time.Hour)
+		require.GreaterOrEqual(t, d, time.Minute)
+		require.Less(t, d, time.Hour)
+	}
+	require.Equal(t, time.Minute, g.Duration(time.Minute, time.Minute))
+	require.WithinDuration(t, time.Now(), g.Now(), time.Second)
+}
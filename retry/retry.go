@@ -0,0 +1,69 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// For ease of unit testing.
+var (
+	randFloat64 = rand.Float64
+	sleep       = func(ctx context.Context, d time.Duration) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+)
+
+// Policy tells how many times an operation is attempted and how long
+// to wait between attempts. The zero Policy attempts only once.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the upper bound of the wait before the first
+	// retry; it doubles on every retry, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the wait before the given retry, starting from 1.
+// It is random between zero and the exponential bound ("full jitter"),
+// so clients that failed together do not retry together.
+func (p Policy) Backoff(retry int) time.Duration {
+	bound := float64(p.InitialBackoff) * math.Pow(2, float64(retry-1))
+	if p.MaxBackoff > 0 && bound > float64(p.MaxBackoff) {
+		bound = float64(p.MaxBackoff)
+	}
+	return time.Duration(randFloat64() * bound)
+}
+
+// Do calls fn until it succeeds, the attempts are exhausted or the
+// context is done, and returns the last error. onRetry, if not nil,
+// is called before every retry with the error of the previous attempt.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error, onRetry func(retry int, err error)) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= p.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+		if sleepErr := sleep(ctx, p.Backoff(attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
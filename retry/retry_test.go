@@ -0,0 +1,109 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	randFloat64 = func() float64 { return 1 }
+	p := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	require.Equal(t, 100*time.Millisecond, p.Backoff(1))
+	require.Equal(t, 200*time.Millisecond, p.Backoff(2))
+	require.Equal(t, 800*time.Millisecond, p.Backoff(4))
+	require.Equal(t, time.Second, p.Backoff(5))
+	randFloat64 = func() float64 { return 0.5 }
+	require.Equal(t, 100*time.Millisecond, p.Backoff(2))
+}
+
+func TestDo(t *testing.T) {
+	randFloat64 = func() float64 { return 1 }
+	policy := Policy{MaxAttempts: 3, InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	testCases := []struct {
+		name             string
+		policy           Policy
+		failures         int
+		expectedAttempts int
+		expectedSleeps   []time.Duration
+		expectedError    error
+	}{
+		{
+			name:             "first attempt succeeds",
+			policy:           policy,
+			expectedAttempts: 1,
+		},
+		{
+			name:             "succeeds after retries",
+			policy:           policy,
+			failures:         2,
+			expectedAttempts: 3,
+			expectedSleeps:   []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+		},
+		{
+			name:             "attempts exhausted",
+			policy:           policy,
+			failures:         5,
+			expectedAttempts: 3,
+			expectedSleeps:   []time.Duration{100 * time.Millisecond, 200 * time.Millisecond},
+			expectedError:    errors.New("random error 3"),
+		},
+		{
+			name:             "zero policy",
+			failures:         1,
+			expectedAttempts: 1,
+			expectedError:    errors.New("random error 1"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var sleeps []time.Duration
+			sleep = func(ctx context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			}
+			var attempts, retries int
+			err := Do(context.TODO(), tc.policy, func(ctx context.Context) error {
+				attempts++
+				if attempts <= tc.failures {
+					return errors.New("random error " + string(rune('0'+attempts)))
+				}
+				return nil
+			}, func(retry int, err error) {
+				retries++
+				require.Equal(t, retries, retry)
+			})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+			}
+			require.Equal(t, tc.expectedAttempts, attempts)
+			require.Equal(t, tc.expectedSleeps, sleeps)
+		})
+	}
+}
+
+func TestDoContextDone(t *testing.T) {
+	sleep = func(ctx context.Context, d time.Duration) error {
+		return context.Canceled
+	}
+	var attempts int
+	err := Do(context.TODO(), Policy{MaxAttempts: 5}, func(ctx context.Context) error {
+		attempts++
+		return errors.New("random error")
+	}, nil)
+	require.EqualError(t, err, "random error")
+	require.Equal(t, 1, attempts)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"container/list"
+	"sync"
+)
+
+// numStateShards is the number of shards the per-account state is split into,
+// so concurrent workers rarely wait on each other.
+const numStateShards = 32
+
+// defaultMaxAccounts is the number of accounts a stateful rule tracks
+// when max_accounts is not configured.
+const defaultMaxAccounts = 100_000
+
+// accountStates keeps the state of type T of stateful rules per account.
+// Memory is bounded: once maxAccounts is reached, the least recently
+// used account is evicted.
+type accountStates[T any] struct {
+	shards [numStateShards]*stateShard[T]
+}
+
+// stateShard is a LRU map of accounts to their state.
+type stateShard[T any] struct {
+	mu          sync.Mutex
+	maxAccounts int
+	lru         *list.List
+	items       map[int]*list.Element
+}
+
+// stateEntry is the element stored in the LRU list.
+type stateEntry[T any] struct {
+	account int
+	state   T
+}
+
+// newAccountStates creates a new accountStates tracking at most maxAccounts.
+func newAccountStates[T any](maxAccounts int) *accountStates[T] {
+	perShard := (maxAccounts + numStateShards - 1) / numStateShards
+	if perShard < 1 {
+		perShard = 1
+	}
+	s := new(accountStates[T])
+	for i := range s.shards {
+		s.shards[i] = &stateShard[T]{
+			maxAccounts: perShard,
+			lru:         list.New(),
+			items:       make(map[int]*list.Element),
+		}
+	}
+	return s
+}
+
+// shard returns the shard that holds the given account.
+func (s *accountStates[T]) shard(account int) *stateShard[T] {
+	h := uint64(account) * 0x9E3779B97F4A7C15
+	return s.shards[h>>59%numStateShards]
+}
+
+// update calls fn with the state of the account, creating it if needed,
+// while holding the lock of its shard.
+func (s *accountStates[T]) update(account int, fn func(state *T)) {
+	sh := s.shard(account)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	el, ok := sh.items[account]
+	if ok {
+		sh.lru.MoveToFront(el)
+	} else {
+		el = sh.lru.PushFront(&stateEntry[T]{account: account})
+		sh.items[account] = el
+		if sh.lru.Len() > sh.maxAccounts {
+			oldest := sh.lru.Back()
+			sh.lru.Remove(oldest)
+			delete(sh.items, oldest.Value.(*stateEntry[T]).account)
+		}
+	}
+	fn(&el.Value.(*stateEntry[T]).state)
+}
+
+// len returns the number of tracked accounts.
+func (s *accountStates[T]) len() int {
+	var n int
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += sh.lru.Len()
+		sh.mu.Unlock()
+	}
+	return n
+}
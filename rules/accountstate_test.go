@@ -0,0 +1,30 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountStates(t *testing.T) {
+	const maxAccounts = numStateShards * 2
+	s := newAccountStates[int](maxAccounts)
+	for account := 0; account < maxAccounts*10; account++ {
+		s.update(account, func(state *int) {
+			*state++
+		})
+	}
+	require.LessOrEqual(t, s.len(), maxAccounts)
+
+	s.update(1, func(state *int) {
+		*state = 42
+	})
+	var got int
+	s.update(1, func(state *int) {
+		got = *state
+	})
+	require.Equal(t, 42, got)
+}
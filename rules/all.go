@@ -0,0 +1,78 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// AllKind is the kind name of AllRule.
+const AllKind = "all"
+
+func init() {
+	Register(AllKind, newAllRule)
+}
+
+// AllRule combines other rules and fires only when all of them fire,
+// which allows policies like "withdrawals over 5,000 during the night".
+type AllRule struct {
+	name  string
+	rules []Rule
+}
+
+// newAllRule is the Factory of AllRule.
+func newAllRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	var p struct {
+		Rules []Definition `json:"rules"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Rules) < 2 {
+		return nil, errors.New("at least two rules are required")
+	}
+	rules, err := buildAll(p.Rules, deps, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &AllRule{name: name, rules: rules}, nil
+}
+
+// Name returns the name of the rule.
+func (r *AllRule) Name() string {
+	return r.name
+}
+
+// Evaluate checks whether every combined rule fires for the transaction.
+func (r *AllRule) Evaluate(t *transaction.Transaction) *Finding {
+	return r.EvaluateContext(context.Background(), t)
+}
+
+// EvaluateContext is like Evaluate, passing the context to the combined
+// rules that need it. Every combined rule is evaluated, even once one
+// did not fire, so the stateful ones see every transaction.
+func (r *AllRule) EvaluateContext(ctx context.Context, t *transaction.Transaction) *Finding {
+	details := make([]string, 0, len(r.rules))
+	fired := true
+	for _, rule := range r.rules {
+		f := evaluate(ctx, rule, t)
+		if f == nil {
+			fired = false
+			continue
+		}
+		details = append(details, f.Detail)
+	}
+	if !fired {
+		return nil
+	}
+	return &Finding{
+		Rule:   r.name,
+		Detail: strings.Join(details, "; "),
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestAllRule(t *testing.T) {
+	_, err := newAllRule("x", []byte(`{"rules":[{"name":"a","kind":"amount","params":{"greater_than":1}}]}`), Dependencies{})
+	require.Equal(t, errors.New("at least two rules are required").Error(), err.Error())
+
+	r, err := newAllRule("big_withdrawal", []byte(`{"rules":[
+		{"name":"withdrawal","kind":"transaction_type","params":{"types":["withdrawal"]}},
+		{"name":"big","kind":"amount","params":{"greater_than":5000}}
+	]}`), Dependencies{})
+	require.NoError(t, err)
+	require.Nil(t, r.Evaluate(&transaction.Transaction{TransactionType: "deposit", TransactionAmount: 6000}))
+	require.Nil(t, r.Evaluate(&transaction.Transaction{TransactionType: "withdrawal", TransactionAmount: 100}))
+	require.Equal(t,
+		&Finding{Rule: "big_withdrawal", Detail: "transaction type is withdrawal; amount 6000.00 is greater than 5000.00"},
+		r.Evaluate(&transaction.Transaction{TransactionType: "withdrawal", TransactionAmount: 6000}),
+	)
+}
+
+func TestAllRuleStatefulRules(t *testing.T) {
+	// The velocity rule comes after one that rarely fires, and must
+	// still count the transactions it does not fire for.
+	r, err := newAllRule("fast_withdrawals", []byte(`{"rules":[
+		{"name":"withdrawal","kind":"transaction_type","params":{"types":["withdrawal"]}},
+		{"name":"fast","kind":"velocity","params":{"window":"1h","max_count":2}}
+	]}`), Dependencies{})
+	require.NoError(t, err)
+	start := time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC)
+	for i, transactionType := range []string{"deposit", "deposit"} {
+		require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionType: transactionType, TransactionTime: start.Add(time.Duration(i) * time.Minute)}))
+	}
+	f := r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionType: "withdrawal", TransactionTime: start.Add(2 * time.Minute)})
+	require.NotNil(t, f)
+	require.Equal(t, "fast_withdrawals", f.Rule)
+}
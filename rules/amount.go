@@ -0,0 +1,63 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// AmountKind is the kind name of AmountRule.
+const AmountKind = "amount"
+
+func init() {
+	Register(AmountKind, newAmountRule)
+}
+
+// AmountRule fires when the transaction amount is greater than GreaterThan
+// and, if set, lower than LessThan.
+type AmountRule struct {
+	name        string
+	GreaterThan float32 `json:"greater_than"`
+	LessThan    float32 `json:"less_than,omitempty"`
+}
+
+// NewAmountRule creates a new AmountRule. A zero lessThan means no upper bound.
+func NewAmountRule(name string, greaterThan, lessThan float32) *AmountRule {
+	return &AmountRule{name: name, GreaterThan: greaterThan, LessThan: lessThan}
+}
+
+// newAmountRule is the Factory of AmountRule.
+func newAmountRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &AmountRule{name: name}
+	if err := decodeParams(params, r); err != nil {
+		return nil, err
+	}
+	if r.LessThan != 0 && r.LessThan <= r.GreaterThan {
+		return nil, errors.New("less_than must be greater than greater_than")
+	}
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *AmountRule) Name() string {
+	return r.name
+}
+
+// Evaluate checks the transaction amount against the configured bounds.
+func (r *AmountRule) Evaluate(t *transaction.Transaction) *Finding {
+	if t.TransactionAmount <= r.GreaterThan {
+		return nil
+	}
+	if r.LessThan != 0 && t.TransactionAmount >= r.LessThan {
+		return nil
+	}
+	return &Finding{
+		Rule:   r.name,
+		Detail: fmt.Sprintf("amount %.2f is greater than %.2f", t.TransactionAmount, r.GreaterThan),
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestNewAmountRule(t *testing.T) {
+	_, err := newAmountRule("x", []byte(`{"greater_than":100,"less_than":50}`), Dependencies{})
+	require.Equal(t, errors.New("less_than must be greater than greater_than").Error(), err.Error())
+}
+
+func TestAmountRuleEvaluate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		rule           *AmountRule
+		amount         float32
+		expectedDetail string
+	}{
+		{
+			name:           "greater than",
+			rule:           NewAmountRule("x", 100, 0),
+			amount:         100.01,
+			expectedDetail: "amount 100.01 is greater than 100.00",
+		},
+		{
+			name:   "equal",
+			rule:   NewAmountRule("x", 100, 0),
+			amount: 100,
+		},
+		{
+			name:           "inside band",
+			rule:           NewAmountRule("x", 100, 200),
+			amount:         150,
+			expectedDetail: "amount 150.00 is greater than 100.00",
+		},
+		{
+			name:   "above band",
+			rule:   NewAmountRule("x", 100, 200),
+			amount: 200,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := tc.rule.Evaluate(&transaction.Transaction{TransactionAmount: tc.amount})
+			if tc.expectedDetail == "" {
+				require.Nil(t, f)
+				return
+			}
+			require.Equal(t, &Finding{Rule: "x", Detail: tc.expectedDetail}, f)
+		})
+	}
+}
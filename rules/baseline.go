@@ -0,0 +1,73 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// Baseline is the online mean and variance of the transaction amounts
+// of an account, computed with Welford's algorithm.
+type Baseline struct {
+	AccountNumber int
+	Count         int64
+	Mean          float64
+	M2            float64
+}
+
+// Add updates the baseline with a new amount.
+func (b *Baseline) Add(amount float64) {
+	b.Count++
+	delta := amount - b.Mean
+	b.Mean += delta / float64(b.Count)
+	b.M2 += delta * (amount - b.Mean)
+}
+
+// StdDev returns the sample standard deviation of the amounts.
+func (b *Baseline) StdDev() float64 {
+	if b.Count < 2 {
+		return 0
+	}
+	return math.Sqrt(b.M2 / float64(b.Count-1))
+}
+
+// BaselineStore persists per-account baselines.
+type BaselineStore interface {
+	// Load returns the baseline of the account, or nil if there is none.
+	Load(ctx context.Context, accountNumber int) (*Baseline, error)
+	// Save creates or replaces the baseline of the account.
+	Save(ctx context.Context, b *Baseline) error
+}
+
+// MemoryBaselineStore is a BaselineStore that keeps baselines in memory.
+type MemoryBaselineStore struct {
+	mu        sync.Mutex
+	baselines map[int]Baseline
+}
+
+// NewMemoryBaselineStore creates a new MemoryBaselineStore.
+func NewMemoryBaselineStore() *MemoryBaselineStore {
+	return &MemoryBaselineStore{baselines: make(map[int]Baseline)}
+}
+
+// Load returns the baseline of the account, or nil if there is none.
+func (s *MemoryBaselineStore) Load(ctx context.Context, accountNumber int) (*Baseline, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.baselines[accountNumber]
+	if !ok {
+		return nil, nil
+	}
+	return &b, nil
+}
+
+// Save creates or replaces the baseline of the account.
+func (s *MemoryBaselineStore) Save(ctx context.Context, b *Baseline) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.baselines[b.AccountNumber] = *b
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	var b Baseline
+	require.Zero(t, b.StdDev())
+	for _, amount := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		b.Add(amount)
+	}
+	require.Equal(t, int64(8), b.Count)
+	require.InDelta(t, 5, b.Mean, 1e-9)
+	require.InDelta(t, 2.138, b.StdDev(), 1e-3)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/geo"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// ImpossibleTravelKind is the kind name of ImpossibleTravelRule.
+const ImpossibleTravelKind = "impossible_travel"
+
+// defaultMaxSpeedKmh is roughly the cruise speed of a commercial airplane.
+const defaultMaxSpeedKmh = 900
+
+func init() {
+	Register(ImpossibleTravelKind, newImpossibleTravelRule)
+}
+
+// ImpossibleTravelRule keeps the last known location and time per account
+// and fires when the speed needed to travel from the previous transaction
+// location to the current one is greater than MaxSpeedKmh.
+// Locations missing from the gazetteer are ignored.
+type ImpossibleTravelRule struct {
+	name          string
+	MaxSpeedKmh   float64 `json:"max_speed_kmh,omitempty"`
+	MinDistanceKm float64 `json:"min_distance_km,omitempty"`
+	MaxAccounts   int     `json:"max_accounts,omitempty"`
+	states        *accountStates[travelState]
+}
+
+// travelState is the last known location of an account.
+type travelState struct {
+	location string
+	coords   geo.Coordinates
+	at       time.Time
+}
+
+// newImpossibleTravelRule is the Factory of ImpossibleTravelRule.
+func newImpossibleTravelRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &ImpossibleTravelRule{name: name}
+	if len(params) > 0 {
+		if err := decodeParams(params, r); err != nil {
+			return nil, err
+		}
+	}
+	if r.MaxSpeedKmh < 0 || r.MinDistanceKm < 0 || r.MaxAccounts < 0 {
+		return nil, errors.New("max_speed_kmh, min_distance_km and max_accounts must not be negative")
+	}
+	if r.MaxSpeedKmh == 0 {
+		r.MaxSpeedKmh = defaultMaxSpeedKmh
+	}
+	if r.MaxAccounts == 0 {
+		r.MaxAccounts = defaultMaxAccounts
+	}
+	r.states = newAccountStates[travelState](r.MaxAccounts)
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *ImpossibleTravelRule) Name() string {
+	return r.name
+}
+
+// Evaluate compares the transaction location with the last known location
+// of its account.
+func (r *ImpossibleTravelRule) Evaluate(t *transaction.Transaction) *Finding {
+	coords, ok := geo.Lookup(t.Location)
+	if !ok {
+		return nil
+	}
+	var (
+		prev  travelState
+		found bool
+	)
+	r.states.update(t.AccountNumber, func(s *travelState) {
+		prev, found = *s, !s.at.IsZero()
+		if !found || !t.TransactionTime.Before(s.at) {
+			*s = travelState{location: t.Location, coords: coords, at: t.TransactionTime}
+		}
+	})
+	if !found || prev.location == t.Location {
+		return nil
+	}
+	distance := geo.DistanceKm(prev.coords, coords)
+	if distance < r.MinDistanceKm {
+		return nil
+	}
+	elapsed := t.TransactionTime.Sub(prev.at)
+	if elapsed < 0 {
+		elapsed = -elapsed
+	}
+	speed := math.Inf(1)
+	if elapsed > 0 {
+		speed = distance / elapsed.Hours()
+	}
+	if speed <= r.MaxSpeedKmh {
+		return nil
+	}
+	return &Finding{
+		Rule: r.name,
+		Detail: fmt.Sprintf("from %s to %s: %.0f km in %s (%s)",
+			prev.location, t.Location, distance, elapsed, formatSpeed(speed)),
+		Attributes: map[string]any{
+			"previous_location": prev.location,
+			"previous_time":     prev.at,
+			"location":          t.Location,
+			"distance_km":       math.Round(distance),
+			"speed_kmh":         roundSpeed(speed),
+		},
+	}
+}
+
+// formatSpeed formats a speed in km/h.
+func formatSpeed(speed float64) string {
+	if math.IsInf(speed, 1) {
+		return "instantaneous"
+	}
+	return fmt.Sprintf("%.0f km/h", speed)
+}
+
+// roundSpeed rounds a speed for storage, using -1 for instantaneous
+// travel so the value survives a JSON export of the collection.
+func roundSpeed(speed float64) float64 {
+	if math.IsInf(speed, 1) {
+		return -1
+	}
+	return math.Round(speed)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestNewImpossibleTravelRule(t *testing.T) {
+	r, err := newImpossibleTravelRule("x", nil, Dependencies{})
+	require.NoError(t, err)
+	require.Equal(t, float64(defaultMaxSpeedKmh), r.(*ImpossibleTravelRule).MaxSpeedKmh)
+
+	_, err = newImpossibleTravelRule("x", []byte(`{"max_speed_kmh":-1}`), Dependencies{})
+	require.Equal(t, errors.New("max_speed_kmh, min_distance_km and max_accounts must not be negative").Error(), err.Error())
+}
+
+func TestImpossibleTravelRuleEvaluate(t *testing.T) {
+	start := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	tx := func(account int, location string, offset time.Duration) *transaction.Transaction {
+		return &transaction.Transaction{
+			AccountNumber:   account,
+			Location:        location,
+			TransactionTime: start.Add(offset),
+		}
+	}
+	type step struct {
+		input         *transaction.Transaction
+		expectedFired bool
+	}
+	testCases := []struct {
+		name   string
+		params string
+		steps  []step
+	}{
+		{
+			name: "impossible travel",
+			steps: []step{
+				{input: tx(1, "New York, NY", 0)},
+				{input: tx(1, "Los Angeles, CA", time.Hour), expectedFired: true},
+			},
+		},
+		{
+			name: "plausible travel",
+			steps: []step{
+				{input: tx(1, "New York, NY", 0)},
+				{input: tx(1, "Los Angeles, CA", 6*time.Hour)},
+			},
+		},
+		{
+			name: "same location",
+			steps: []step{
+				{input: tx(1, "New York, NY", 0)},
+				{input: tx(1, "New York, NY", 0)},
+			},
+		},
+		{
+			name: "same time in different locations",
+			steps: []step{
+				{input: tx(1, "Dallas, TX", 0)},
+				{input: tx(1, "Fort Worth, TX", 0), expectedFired: true},
+			},
+		},
+		{
+			name:   "closer than min distance",
+			params: `{"min_distance_km":100}`,
+			steps: []step{
+				{input: tx(1, "Dallas, TX", 0)},
+				{input: tx(1, "Fort Worth, TX", 0)},
+			},
+		},
+		{
+			name: "unknown location is ignored",
+			steps: []step{
+				{input: tx(1, "New York, NY", 0)},
+				{input: tx(1, "Atlantis", time.Minute)},
+				{input: tx(1, "New York, NY", 2*time.Minute)},
+			},
+		},
+		{
+			name: "accounts are independent",
+			steps: []step{
+				{input: tx(1, "New York, NY", 0)},
+				{input: tx(2, "Los Angeles, CA", time.Minute)},
+			},
+		},
+		{
+			name: "out of order transaction",
+			steps: []step{
+				{input: tx(1, "New York, NY", time.Hour)},
+				{input: tx(1, "Los Angeles, CA", 0), expectedFired: true},
+				{input: tx(1, "New York, NY", 2*time.Hour)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var params []byte
+			if tc.params != "" {
+				params = []byte(tc.params)
+			}
+			r, err := newImpossibleTravelRule("travel", params, Dependencies{})
+			require.NoError(t, err)
+			for i, s := range tc.steps {
+				f := r.Evaluate(s.input)
+				require.Equal(t, s.expectedFired, f != nil, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestImpossibleTravelRuleFinding(t *testing.T) {
+	start := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	r, err := newImpossibleTravelRule("travel", nil, Dependencies{})
+	require.NoError(t, err)
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, Location: "New York, NY", TransactionTime: start}))
+	f := r.Evaluate(&transaction.Transaction{AccountNumber: 1, Location: "Los Angeles, CA", TransactionTime: start.Add(time.Hour)})
+	require.Equal(t, &Finding{
+		Rule:   "travel",
+		Detail: "from New York, NY to Los Angeles, CA: 3936 km in 1h0m0s (3936 km/h)",
+		Attributes: map[string]any{
+			"previous_location": "New York, NY",
+			"previous_time":     start,
+			"location":          "Los Angeles, CA",
+			"distance_km":       float64(3936),
+			"speed_kmh":         float64(3936),
+		},
+	}, f)
+	f = r.Evaluate(&transaction.Transaction{AccountNumber: 1, Location: "New York, NY", TransactionTime: start.Add(time.Hour)})
+	require.Equal(t, "from Los Angeles, CA to New York, NY: 3936 km in 0s (instantaneous)", f.Detail)
+	require.Equal(t, float64(-1), f.Attributes["speed_kmh"])
+}
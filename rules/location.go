@@ -0,0 +1,55 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// LocationKind is the kind name of LocationRule.
+const LocationKind = "location"
+
+func init() {
+	Register(LocationKind, newLocationRule)
+}
+
+// LocationRule fires when the transaction location is one of Locations.
+type LocationRule struct {
+	name      string
+	Locations []string `json:"locations"`
+	locations map[string]struct{}
+}
+
+// newLocationRule is the Factory of LocationRule.
+func newLocationRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &LocationRule{name: name}
+	if err := decodeParams(params, r); err != nil {
+		return nil, err
+	}
+	if len(r.Locations) == 0 {
+		return nil, errors.New("locations must not be empty")
+	}
+	r.locations = toSet(r.Locations)
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *LocationRule) Name() string {
+	return r.name
+}
+
+// Evaluate checks whether the transaction location is one of the configured ones.
+func (r *LocationRule) Evaluate(t *transaction.Transaction) *Finding {
+	if _, ok := r.locations[t.Location]; !ok {
+		return nil
+	}
+	return &Finding{
+		Rule:   r.name,
+		Detail: fmt.Sprintf("location is %s", t.Location),
+	}
+}
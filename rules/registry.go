@@ -0,0 +1,58 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory creates a Rule with the given name from its raw parameters.
+// Stateful rules may use the external services available in deps.
+type Factory func(name string, params json.RawMessage, deps Dependencies) (Rule, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a rule kind available to rule set definitions.
+// If Register is called twice with the same kind or if factory is nil,
+// it panics.
+func Register(kind string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if factory == nil {
+		panic("rules: Register factory is nil")
+	}
+	if _, dup := factories[kind]; dup {
+		panic("rules: Register called twice for kind " + kind)
+	}
+	factories[kind] = factory
+}
+
+// Kinds returns a sorted list of the names of the registered rule kinds.
+func Kinds() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	kinds := make([]string, 0, len(factories))
+	for kind := range factories {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// build creates a Rule from its definition using the registered factory.
+func build(def Definition, deps Dependencies) (Rule, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[def.Kind]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown rule kind %q", def.Kind)
+	}
+	return factory(def.Name, def.Params, deps)
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	require.Panics(t, func() { Register(AmountKind, newAmountRule) })
+	require.Panics(t, func() { Register("nil", nil) })
+	require.Equal(t, []string{AllKind, AmountKind, ImpossibleTravelKind, LocationKind, StructuringKind, TimeOfDayKind, TransactionTypeKind, VelocityKind, ZScoreKind}, Kinds())
+}
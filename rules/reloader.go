@@ -0,0 +1,125 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// For ease of unit testing.
+var statFile = os.Stat
+
+// Reloader holds the current RuleSet of a rules file and swaps it
+// atomically when the file changes, so workers can keep running
+// while thresholds and rule definitions are updated.
+//
+// An invalid file is rejected and the last good RuleSet is kept.
+type Reloader struct {
+	path     string
+	opts     []Option
+	onReload func(err error)
+	current  atomic.Pointer[RuleSet]
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	sum     [sha256.Size]byte
+}
+
+// NewReloader loads the rules file and creates a new Reloader.
+// onReload, if not nil, is called after every reload attempt triggered
+// by Watch, with a nil error when the new rules were swapped in.
+func NewReloader(path string, onReload func(err error), opts ...Option) (*Reloader, error) {
+	r := &Reloader{path: path, opts: opts, onReload: onReload}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// RuleSet returns the current RuleSet.
+func (r *Reloader) RuleSet() *RuleSet {
+	return r.current.Load()
+}
+
+// Reload reads the rules file and, if its content changed and is valid,
+// swaps the current RuleSet. It returns whether the RuleSet was swapped.
+func (r *Reloader) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, err := statFile(r.path)
+	if err != nil {
+		return false, errors.Wrapf(err, "reading rules file %s", r.path)
+	}
+	data, err := readFile(r.path)
+	if err != nil {
+		return false, errors.Wrapf(err, "reading rules file %s", r.path)
+	}
+	r.modTime, r.size = info.ModTime(), info.Size()
+	sum := sha256.Sum256(data)
+	previous := r.current.Load()
+	if previous != nil && bytes.Equal(sum[:], r.sum[:]) {
+		return false, nil
+	}
+	opts := append([]Option{WithPrevious(previous)}, r.opts...)
+	rs, err := Parse(data, opts...)
+	if err != nil {
+		return false, errors.Wrapf(err, "parsing rules file %s", r.path)
+	}
+	r.sum = sum
+	r.current.Store(rs)
+	return true, nil
+}
+
+// changed tells whether the modification time or the size of the rules
+// file differ from the ones seen on the last reload.
+func (r *Reloader) changed() bool {
+	info, err := statFile(r.path)
+	if err != nil {
+		// Let Reload report it.
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// Watch polls the rules file every interval and reloads it when it
+// changes, until the context is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastErr string
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			swapped, err := r.Reload()
+			if err != nil {
+				// Report a broken file once, not on every tick.
+				if err.Error() == lastErr {
+					continue
+				}
+				lastErr = err.Error()
+			} else {
+				lastErr = ""
+			}
+			if (swapped || err != nil) && r.onReload != nil {
+				r.onReload(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestReloader(t *testing.T) {
+	readFile = os.ReadFile
+	statFile = os.Stat
+	path := filepath.Join(t.TempDir(), "rules.json")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write(`{"rules":[
+		{"name":"big","kind":"amount","params":{"greater_than":10000}},
+		{"name":"velocity","kind":"velocity","params":{"window":"1h","max_count":1}}
+	]}`)
+
+	_, err := NewReloader(filepath.Join(t.TempDir(), "missing.json"), nil)
+	require.Error(t, err)
+
+	r, err := NewReloader(path, nil)
+	require.NoError(t, err)
+	first := r.RuleSet()
+	require.Equal(t, []string{"big", "velocity"}, ruleNames(first))
+
+	// Same content: nothing is swapped.
+	swapped, err := r.Reload()
+	require.NoError(t, err)
+	require.False(t, swapped)
+
+	// Threshold changed: the velocity rule and its state are kept.
+	write(`{"rules":[
+		{"name":"big","kind":"amount","params":{"greater_than":5000}},
+		{"name":"velocity","kind":"velocity","params":{ "window": "1h", "max_count": 1 }}
+	]}`)
+	swapped, err = r.Reload()
+	require.NoError(t, err)
+	require.True(t, swapped)
+	second := r.RuleSet()
+	require.NotSame(t, first.Rules()[0], second.Rules()[0])
+	require.Same(t, first.Rules()[1], second.Rules()[1])
+	require.Len(t, second.Evaluate(&transaction.Transaction{TransactionAmount: 6000}), 1)
+
+	// Invalid content: rejected, the last good rule set is kept.
+	write(`{"rules":[{"name":"big","kind":"amount","params":{"greater_than":"a lot"}}]}`)
+	swapped, err = r.Reload()
+	require.Error(t, err)
+	require.False(t, swapped)
+	require.Same(t, second, r.RuleSet())
+}
+
+func TestReloaderWatch(t *testing.T) {
+	readFile = os.ReadFile
+	statFile = os.Stat
+	path := filepath.Join(t.TempDir(), "rules.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"name":"a","kind":"amount","params":{"greater_than":1}}]}`), 0644))
+
+	var (
+		mu      sync.Mutex
+		reloads []error
+	)
+	r, err := NewReloader(path, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reloads = append(reloads, err)
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Watch(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[{"name":"bb","kind":"amount","params":{"greater_than":1}}]}`), 0644))
+	require.Eventually(t, func() bool {
+		return ruleNames(r.RuleSet())[0] == "bb"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte(`invalid json`), 0644))
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reloads) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "bb", ruleNames(r.RuleSet())[0])
+
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	require.NoError(t, reloads[0])
+	require.Error(t, reloads[1])
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"context"
+
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// Rule must be implemented by types that want to take part
+// in the detection of suspicious transactions.
+type Rule interface {
+	// Name returns the name of the rule, unique within a rule set.
+	Name() string
+	// Evaluate returns a Finding if the transaction matches the rule,
+	// or nil otherwise.
+	Evaluate(t *transaction.Transaction) *Finding
+}
+
+// ContextRule is a Rule whose evaluation needs the context of the
+// caller, like one that reaches a store; RuleSet.AssessContext passes
+// its context to EvaluateContext instead of calling Evaluate.
+type ContextRule interface {
+	Rule
+	EvaluateContext(ctx context.Context, t *transaction.Transaction) *Finding
+}
+
+// evaluate evaluates the rule against the transaction, passing it the
+// context if it is a ContextRule.
+func evaluate(ctx context.Context, r Rule, t *transaction.Transaction) *Finding {
+	if cr, ok := r.(ContextRule); ok {
+		return cr.EvaluateContext(ctx, t)
+	}
+	return r.Evaluate(t)
+}
+
+// Finding describes a rule that fired for a given transaction.
+// Attributes optionally hold structured data about why it fired.
+type Finding struct {
+	Rule       string
+	Detail     string
+	Attributes map[string]any
+}
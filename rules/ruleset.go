@@ -0,0 +1,245 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// For ease of unit testing.
+var readFile = os.ReadFile
+
+// Definition holds the configuration of a single rule.
+type Definition struct {
+	Name   string          `json:"name"`
+	Kind   string          `json:"kind"`
+	Params json.RawMessage `json:"params"`
+}
+
+// Config represents the content of a rule set configuration file.
+type Config struct {
+	Rules   []Definition   `json:"rules"`
+	Scoring *ScoringConfig `json:"scoring,omitempty"`
+}
+
+// Dependencies holds the external services that stateful rules may need.
+type Dependencies struct {
+	// BaselineStore persists per-account baselines. If nil, baselines
+	// are only kept in memory.
+	BaselineStore BaselineStore
+	// OnError is called with errors that happen while evaluating rules,
+	// like failing to reach the BaselineStore. If nil, they are ignored.
+	OnError func(err error)
+}
+
+// Option configures how a RuleSet is built.
+type Option func(o *options)
+
+// options holds the settings used to build a RuleSet.
+type options struct {
+	deps     Dependencies
+	previous *RuleSet
+}
+
+// WithBaselineStore sets the store used to persist per-account baselines.
+func WithBaselineStore(store BaselineStore) Option {
+	return func(o *options) {
+		o.deps.BaselineStore = store
+	}
+}
+
+// WithErrorHandler sets the function called with errors that happen
+// while evaluating rules.
+func WithErrorHandler(onError func(err error)) Option {
+	return func(o *options) {
+		o.deps.OnError = onError
+	}
+}
+
+// WithPrevious makes the new RuleSet reuse the rules and the scorer of
+// previous whose definitions did not change, so their per-account state
+// survives a reload.
+func WithPrevious(previous *RuleSet) Option {
+	return func(o *options) {
+		o.previous = previous
+	}
+}
+
+// RuleSet is an ordered collection of rules that are evaluated
+// against every transaction, optionally combined with a Scorer.
+type RuleSet struct {
+	rules   []Rule
+	defs    []Definition
+	scorer  *Scorer
+	scoring *ScoringConfig
+}
+
+// Verdict is the result of assessing a transaction.
+type Verdict struct {
+	Findings []Finding
+	// Score is nil when scoring is not configured.
+	Score  *Score
+	cutoff float64
+}
+
+// Suspicious tells whether the transaction is suspicious. When scoring is
+// configured, that is when the score reaches the cutoff; otherwise, when
+// any rule fired.
+func (v Verdict) Suspicious() bool {
+	if v.Score != nil {
+		return v.Score.Value >= v.cutoff
+	}
+	return len(v.Findings) > 0
+}
+
+// New creates a new RuleSet with the given rules.
+func New(rules ...Rule) *RuleSet {
+	return &RuleSet{rules: rules}
+}
+
+// Default returns the rule set that mirrors the historical behavior
+// of flagging transactions with an amount greater than 10,000.
+func Default() *RuleSet {
+	const (
+		name             = "amount_over_10000"
+		suspiciousAmount = float32(10_000)
+	)
+	return New(&AmountRule{name: name, GreaterThan: suspiciousAmount})
+}
+
+// Load reads a rule set configuration file and builds the RuleSet.
+func Load(path string, opts ...Option) (*RuleSet, error) {
+	data, err := readFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading rules file %s", path)
+	}
+	rs, err := Parse(data, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing rules file %s", path)
+	}
+	return rs, nil
+}
+
+// Parse builds a RuleSet from a JSON rule set configuration.
+func Parse(data []byte, opts ...Option) (*RuleSet, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling rules config")
+	}
+	if len(cfg.Rules) == 0 && cfg.Scoring == nil {
+		return nil, errors.New("no rules defined")
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	rules, err := buildAll(cfg.Rules, o.deps, o.previous)
+	if err != nil {
+		return nil, err
+	}
+	rs := &RuleSet{rules: rules, defs: cfg.Rules, scoring: cfg.Scoring}
+	if cfg.Scoring != nil {
+		if o.previous != nil && o.previous.scorer != nil && reflect.DeepEqual(o.previous.scoring, cfg.Scoring) {
+			rs.scorer = o.previous.scorer
+		} else if rs.scorer, err = NewScorer(*cfg.Scoring); err != nil {
+			return nil, errors.Wrap(err, "scoring")
+		}
+	}
+	return rs, nil
+}
+
+// buildAll builds every rule definition, making sure names are unique.
+// Rules of previous with the same definition are reused instead.
+func buildAll(defs []Definition, deps Dependencies, previous *RuleSet) ([]Rule, error) {
+	rules := make([]Rule, 0, len(defs))
+	names := make(map[string]struct{}, len(defs))
+	for i, def := range defs {
+		if def.Name == "" {
+			return nil, errors.Errorf("rule #%d: missing name", i)
+		}
+		if _, dup := names[def.Name]; dup {
+			return nil, errors.Errorf("rule %s: duplicate name", def.Name)
+		}
+		names[def.Name] = struct{}{}
+		if rule := previous.reusable(def); rule != nil {
+			rules = append(rules, rule)
+			continue
+		}
+		rule, err := build(def, deps)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %s", def.Name)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// reusable returns the rule built from the same definition, if any.
+func (rs *RuleSet) reusable(def Definition) Rule {
+	if rs == nil {
+		return nil
+	}
+	for i, prev := range rs.defs {
+		if prev.Name == def.Name && prev.Kind == def.Kind && sameParams(prev.Params, def.Params) {
+			return rs.rules[i]
+		}
+	}
+	return nil
+}
+
+// sameParams tells whether two raw parameters are equal, ignoring formatting.
+func sameParams(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
+
+// Rules returns the rules of the rule set, in evaluation order.
+func (rs *RuleSet) Rules() []Rule {
+	return rs.rules
+}
+
+// Evaluate runs every rule against the transaction and returns
+// the findings of the rules that fired.
+func (rs *RuleSet) Evaluate(t *transaction.Transaction) []Finding {
+	return rs.EvaluateContext(context.Background(), t)
+}
+
+// EvaluateContext is like Evaluate, passing the context to the rules
+// that need it.
+func (rs *RuleSet) EvaluateContext(ctx context.Context, t *transaction.Transaction) []Finding {
+	var findings []Finding
+	for _, r := range rs.rules {
+		if f := evaluate(ctx, r, t); f != nil {
+			findings = append(findings, *f)
+		}
+	}
+	return findings
+}
+
+// Assess evaluates every rule against the transaction and, if scoring
+// is configured, computes its risk score.
+func (rs *RuleSet) Assess(t *transaction.Transaction) Verdict {
+	return rs.AssessContext(context.Background(), t)
+}
+
+// AssessContext is like Assess, passing the context to the rules that
+// need it.
+func (rs *RuleSet) AssessContext(ctx context.Context, t *transaction.Transaction) Verdict {
+	v := Verdict{Findings: rs.EvaluateContext(ctx, t)}
+	if rs.scorer != nil {
+		v.Score = rs.scorer.Score(t, v.Findings)
+		v.cutoff = rs.scorer.Cutoff()
+	}
+	return v
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mockReadFile  func(name string) ([]byte, error)
+		expectedRules []string
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			mockReadFile: func(name string) ([]byte, error) {
+				return []byte(`{"rules":[{"name":"big","kind":"amount","params":{"greater_than":10000}}]}`), nil
+			},
+			expectedRules: []string{"big"},
+		},
+		{
+			name: "error reading file",
+			mockReadFile: func(name string) ([]byte, error) {
+				return nil, errors.New("random error")
+			},
+			expectedError: errors.New("reading rules file rules.json: random error"),
+		},
+		{
+			name: "error parsing file",
+			mockReadFile: func(name string) ([]byte, error) {
+				return []byte(`{"rules":[]}`), nil
+			},
+			expectedError: errors.New("parsing rules file rules.json: no rules defined"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			readFile = tc.mockReadFile
+			rs, err := Load("rules.json")
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedRules, ruleNames(rs))
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedRules []string
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			input: `{"rules":[
+				{"name":"big","kind":"amount","params":{"greater_than":10000}},
+				{"name":"deposit","kind":"transaction_type","params":{"types":["deposit"]}},
+				{"name":"nyc","kind":"location","params":{"locations":["New York, NY"]}},
+				{"name":"night","kind":"time_of_day","params":{"from":"22:00","to":"06:00"}}
+			]}`,
+			expectedRules: []string{"big", "deposit", "nyc", "night"},
+		},
+		{
+			name:          "invalid json",
+			input:         `invalid`,
+			expectedError: errors.New("unmarshalling rules config: invalid character 'i' looking for beginning of value"),
+		},
+		{
+			name:          "no rules",
+			input:         `{}`,
+			expectedError: errors.New("no rules defined"),
+		},
+		{
+			name:          "missing name",
+			input:         `{"rules":[{"kind":"amount","params":{"greater_than":1}}]}`,
+			expectedError: errors.New("rule #0: missing name"),
+		},
+		{
+			name: "duplicate name",
+			input: `{"rules":[
+				{"name":"big","kind":"amount","params":{"greater_than":1}},
+				{"name":"big","kind":"amount","params":{"greater_than":2}}
+			]}`,
+			expectedError: errors.New("rule big: duplicate name"),
+		},
+		{
+			name:          "unknown kind",
+			input:         `{"rules":[{"name":"x","kind":"unknown"}]}`,
+			expectedError: errors.New(`rule x: unknown rule kind "unknown"`),
+		},
+		{
+			name:          "missing params",
+			input:         `{"rules":[{"name":"x","kind":"amount"}]}`,
+			expectedError: errors.New("rule x: missing params"),
+		},
+		{
+			name:          "unknown param",
+			input:         `{"rules":[{"name":"x","kind":"amount","params":{"greater":1}}]}`,
+			expectedError: errors.New(`rule x: decoding params: json: unknown field "greater"`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rs, err := Parse([]byte(tc.input))
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedRules, ruleNames(rs))
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rs, err := Parse([]byte(`{"rules":[
+		{"name":"big","kind":"amount","params":{"greater_than":10000}},
+		{"name":"nyc","kind":"location","params":{"locations":["New York, NY"]}}
+	]}`))
+	require.NoError(t, err)
+	testCases := []struct {
+		name             string
+		input            *transaction.Transaction
+		expectedFindings []Finding
+	}{
+		{
+			name:  "no rule fires",
+			input: &transaction.Transaction{TransactionAmount: 100, Location: "Austin, TX"},
+		},
+		{
+			name:  "one rule fires",
+			input: &transaction.Transaction{TransactionAmount: 100, Location: "New York, NY"},
+			expectedFindings: []Finding{
+				{Rule: "nyc", Detail: "location is New York, NY"},
+			},
+		},
+		{
+			name:  "all rules fire",
+			input: &transaction.Transaction{TransactionAmount: 11308.58, Location: "New York, NY"},
+			expectedFindings: []Finding{
+				{Rule: "big", Detail: "amount 11308.58 is greater than 10000.00"},
+				{Rule: "nyc", Detail: "location is New York, NY"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			findings := rs.Evaluate(tc.input)
+			require.Equal(t, tc.expectedFindings, findings)
+		})
+	}
+}
+
+func TestExampleRulesFile(t *testing.T) {
+	readFile = os.ReadFile
+	_, err := Load("../rules.json")
+	require.NoError(t, err)
+}
+
+func TestDefault(t *testing.T) {
+	rs := Default()
+	require.Nil(t, rs.Evaluate(&transaction.Transaction{TransactionAmount: 10_000}))
+	require.Len(t, rs.Evaluate(&transaction.Transaction{TransactionAmount: 10_000.01}), 1)
+}
+
+func ruleNames(rs *RuleSet) []string {
+	names := make([]string, len(rs.Rules()))
+	for i, r := range rs.Rules() {
+		names[i] = r.Name()
+	}
+	return names
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// Signals combined by the Scorer.
+const (
+	AmountSignal         = "amount"
+	LocationRaritySignal = "location_rarity"
+	HourOfDaySignal      = "hour_of_day"
+	VelocitySignal       = "velocity"
+	AccountAgeSignal     = "account_age"
+	RulesSignal          = "rules"
+)
+
+// signals is the list of known signals, in the order they are reported.
+var signals = []string{
+	AmountSignal,
+	LocationRaritySignal,
+	HourOfDaySignal,
+	VelocitySignal,
+	AccountAgeSignal,
+	RulesSignal,
+}
+
+// Defaults of ScoringConfig.
+const (
+	defaultAmountCeiling   = float32(20_000)
+	defaultVelocityWindow  = time.Hour
+	defaultVelocityCeiling = 10
+	defaultNightFrom       = "00:00"
+	defaultNightTo         = "06:00"
+	defaultNewAccountAge   = 30 * 24 * time.Hour
+	defaultLocationWarmUp  = 5
+	maxTrackedLocations    = 32
+)
+
+// ScoringConfig is the "scoring" section of a rule set configuration.
+// Every signal is normalized to [0, 1] and the score is their weighted
+// average, from 0 to 100. Signals without a weight are not computed.
+type ScoringConfig struct {
+	// Cutoff is the score from which a transaction is suspicious.
+	Cutoff float64 `json:"cutoff"`
+	// Weights maps signal names to their weights.
+	Weights map[string]float64 `json:"weights"`
+	// AmountCeiling is the amount from which the amount signal is 1.
+	AmountCeiling float32 `json:"amount_ceiling,omitempty"`
+	// VelocityWindow is the period in which transactions of the account are counted.
+	VelocityWindow Duration `json:"velocity_window,omitempty"`
+	// VelocityCeiling is the count from which the velocity signal is 1.
+	VelocityCeiling int `json:"velocity_ceiling,omitempty"`
+	// NightFrom and NightTo bound the hours of the day considered risky.
+	NightFrom string `json:"night_from,omitempty"`
+	NightTo   string `json:"night_to,omitempty"`
+	// NewAccountAge is the age from which an account is no longer considered new.
+	NewAccountAge Duration `json:"new_account_age,omitempty"`
+	// LocationWarmUp is the number of transactions of the account that
+	// must be in its history before their locations are compared.
+	LocationWarmUp int `json:"location_warm_up,omitempty"`
+	// MaxAccounts is the number of accounts whose history is tracked.
+	MaxAccounts int `json:"max_accounts,omitempty"`
+}
+
+// Score is the risk score of a transaction.
+type Score struct {
+	// Value goes from 0 to 100.
+	Value float64
+	// Factors holds the contribution of each signal to Value.
+	Factors []Factor
+}
+
+// Factor is the contribution of a signal to a Score.
+type Factor struct {
+	Signal string
+	// Value is the normalized signal, from 0 to 1.
+	Value  float64
+	Weight float64
+	// Contribution is the number of points the signal added to the score.
+	Contribution float64
+}
+
+// Scorer combines several weighted signals into a Score.
+//
+// The history of the accounts is only kept in memory, so it starts over
+// after a restart, and for accounts evicted from it. The signals based
+// on it are held at 0 until it has warmed up: location_rarity until the
+// account has LocationWarmUp transactions in it, and account_age for
+// accounts first seen less than NewAccountAge after it started, which
+// may be older than it.
+type Scorer struct {
+	cfg         ScoringConfig
+	weightTotal float64
+	night       *TimeOfDayRule
+	states      *accountStates[scoringState]
+
+	mu sync.Mutex
+	// since is the time of the earliest transaction in the history.
+	since time.Time
+}
+
+// scoringState is the history of an account used by the Scorer.
+type scoringState struct {
+	firstSeen time.Time
+	locations map[string]int
+	total     int
+	window    slidingWindow
+}
+
+// NewScorer validates the configuration and creates a new Scorer.
+func NewScorer(cfg ScoringConfig) (*Scorer, error) {
+	if cfg.Cutoff <= 0 || cfg.Cutoff > 100 {
+		return nil, errors.New("cutoff must be greater than 0 and up to 100")
+	}
+	if len(cfg.Weights) == 0 {
+		return nil, errors.New("weights must not be empty")
+	}
+	s := &Scorer{}
+	for name, w := range cfg.Weights {
+		if !isSignal(name) {
+			return nil, errors.Errorf("unknown signal %q", name)
+		}
+		if w < 0 {
+			return nil, errors.Errorf("weight of %s must not be negative", name)
+		}
+		s.weightTotal += w
+	}
+	if s.weightTotal == 0 {
+		return nil, errors.New("at least one weight must be greater than zero")
+	}
+	if cfg.AmountCeiling < 0 || cfg.VelocityWindow < 0 || cfg.VelocityCeiling < 0 ||
+		cfg.NewAccountAge < 0 || cfg.LocationWarmUp < 0 || cfg.MaxAccounts < 0 {
+		return nil, errors.New("scoring parameters must not be negative")
+	}
+	if cfg.AmountCeiling == 0 {
+		cfg.AmountCeiling = defaultAmountCeiling
+	}
+	if cfg.VelocityWindow == 0 {
+		cfg.VelocityWindow = Duration(defaultVelocityWindow)
+	}
+	if cfg.VelocityCeiling == 0 {
+		cfg.VelocityCeiling = defaultVelocityCeiling
+	}
+	if cfg.NightFrom == "" {
+		cfg.NightFrom = defaultNightFrom
+	}
+	if cfg.NightTo == "" {
+		cfg.NightTo = defaultNightTo
+	}
+	if cfg.NewAccountAge == 0 {
+		cfg.NewAccountAge = Duration(defaultNewAccountAge)
+	}
+	if cfg.LocationWarmUp == 0 {
+		cfg.LocationWarmUp = defaultLocationWarmUp
+	}
+	if cfg.MaxAccounts == 0 {
+		cfg.MaxAccounts = defaultMaxAccounts
+	}
+	night, err := NewTimeOfDayRule(HourOfDaySignal, cfg.NightFrom, cfg.NightTo)
+	if err != nil {
+		return nil, errors.Wrap(err, "night window")
+	}
+	s.cfg = cfg
+	s.night = night
+	s.states = newAccountStates[scoringState](cfg.MaxAccounts)
+	return s, nil
+}
+
+// isSignal tells whether name is a known signal.
+func isSignal(name string) bool {
+	for _, s := range signals {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Cutoff returns the score from which a transaction is suspicious.
+func (s *Scorer) Cutoff() float64 {
+	return s.cfg.Cutoff
+}
+
+// Score computes the risk score of the transaction, given the findings
+// of the rules, and adds the transaction to the history of its account.
+func (s *Scorer) Score(t *transaction.Transaction, findings []Finding) *Score {
+	values := make(map[string]float64, len(signals))
+	values[AmountSignal] = clamp(float64(t.TransactionAmount / s.cfg.AmountCeiling))
+	if s.night.Evaluate(t) != nil {
+		values[HourOfDaySignal] = 1
+	}
+	if len(findings) > 0 {
+		values[RulesSignal] = 1
+	}
+	since := s.historySince(t.TransactionTime)
+	s.states.update(t.AccountNumber, func(st *scoringState) {
+		if st.firstSeen.IsZero() || t.TransactionTime.Before(st.firstSeen) {
+			st.firstSeen = t.TransactionTime
+		}
+		if st.firstSeen.Sub(since) >= time.Duration(s.cfg.NewAccountAge) {
+			age := t.TransactionTime.Sub(st.firstSeen)
+			values[AccountAgeSignal] = clamp(1 - float64(age)/float64(s.cfg.NewAccountAge))
+		}
+
+		if st.total >= s.cfg.LocationWarmUp {
+			values[LocationRaritySignal] = 1 - float64(st.locations[t.Location])/float64(st.total)
+		}
+		if st.locations == nil {
+			st.locations = make(map[string]int)
+		}
+		if _, ok := st.locations[t.Location]; ok || len(st.locations) < maxTrackedLocations {
+			st.locations[t.Location]++
+			st.total++
+		}
+
+		st.window.add(windowEvent{at: t.TransactionTime, amount: t.TransactionAmount}, time.Duration(s.cfg.VelocityWindow))
+		count, _ := st.window.totals()
+		values[VelocitySignal] = clamp(float64(count-1) / float64(s.cfg.VelocityCeiling))
+	})
+	score := &Score{}
+	for _, name := range signals {
+		w, ok := s.cfg.Weights[name]
+		if !ok {
+			continue
+		}
+		contribution := 100 * w * values[name] / s.weightTotal
+		score.Value += contribution
+		score.Factors = append(score.Factors, Factor{
+			Signal:       name,
+			Value:        round2(values[name]),
+			Weight:       w,
+			Contribution: round2(contribution),
+		})
+	}
+	score.Value = round2(score.Value)
+	sort.SliceStable(score.Factors, func(i, j int) bool {
+		return score.Factors[i].Contribution > score.Factors[j].Contribution
+	})
+	return score
+}
+
+// historySince adds the time of a transaction to the history and
+// returns the time of the earliest one.
+func (s *Scorer) historySince(t time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.since.IsZero() || t.Before(s.since) {
+		s.since = t
+	}
+	return s.since
+}
+
+// clamp limits v to [0, 1].
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestNewScorer(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cfg           ScoringConfig
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			cfg:  ScoringConfig{Cutoff: 60, Weights: map[string]float64{AmountSignal: 1}},
+		},
+		{
+			name:          "invalid cutoff",
+			cfg:           ScoringConfig{Cutoff: 101, Weights: map[string]float64{AmountSignal: 1}},
+			expectedError: errors.New("cutoff must be greater than 0 and up to 100"),
+		},
+		{
+			name:          "no weights",
+			cfg:           ScoringConfig{Cutoff: 60},
+			expectedError: errors.New("weights must not be empty"),
+		},
+		{
+			name:          "unknown signal",
+			cfg:           ScoringConfig{Cutoff: 60, Weights: map[string]float64{"moon_phase": 1}},
+			expectedError: errors.New(`unknown signal "moon_phase"`),
+		},
+		{
+			name:          "negative weight",
+			cfg:           ScoringConfig{Cutoff: 60, Weights: map[string]float64{AmountSignal: -1}},
+			expectedError: errors.New("weight of amount must not be negative"),
+		},
+		{
+			name:          "zero weights",
+			cfg:           ScoringConfig{Cutoff: 60, Weights: map[string]float64{AmountSignal: 0}},
+			expectedError: errors.New("at least one weight must be greater than zero"),
+		},
+		{
+			name:          "negative parameter",
+			cfg:           ScoringConfig{Cutoff: 60, Weights: map[string]float64{AmountSignal: 1}, VelocityCeiling: -1},
+			expectedError: errors.New("scoring parameters must not be negative"),
+		},
+		{
+			name:          "invalid night window",
+			cfg:           ScoringConfig{Cutoff: 60, Weights: map[string]float64{AmountSignal: 1}, NightFrom: "midnight"},
+			expectedError: errors.New(`night window: from: parsing clock "midnight": parsing time "midnight" as "15:04": cannot parse "midnight" as "15"`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewScorer(tc.cfg)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.NotNil(t, s)
+			}
+		})
+	}
+}
+
+func TestScorerScore(t *testing.T) {
+	s, err := NewScorer(ScoringConfig{
+		Cutoff: 60,
+		Weights: map[string]float64{
+			AmountSignal:         2,
+			LocationRaritySignal: 1,
+			HourOfDaySignal:      1,
+			VelocitySignal:       1,
+			AccountAgeSignal:     1,
+			RulesSignal:          2,
+		},
+		AmountCeiling:   10_000,
+		VelocityCeiling: 2,
+		NewAccountAge:   Duration(10 * time.Hour),
+		LocationWarmUp:  1,
+	})
+	require.NoError(t, err)
+	start := time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC)
+	// The history starts early enough to tell new accounts apart.
+	s.Score(&transaction.Transaction{AccountNumber: 2, TransactionTime: start.Add(-10 * time.Hour)}, nil)
+
+	// First transaction of a new account: only its age and amount count.
+	score := s.Score(&transaction.Transaction{
+		AccountNumber:     1,
+		TransactionAmount: 5000,
+		TransactionTime:   start,
+		Location:          "Austin, TX",
+	}, nil)
+	require.Equal(t, 25.0, score.Value)
+	require.Equal(t, []Factor{
+		{Signal: AmountSignal, Value: 0.5, Weight: 2, Contribution: 12.5},
+		{Signal: AccountAgeSignal, Value: 1, Weight: 1, Contribution: 12.5},
+		{Signal: LocationRaritySignal, Value: 0, Weight: 1, Contribution: 0},
+		{Signal: HourOfDaySignal, Value: 0, Weight: 1, Contribution: 0},
+		{Signal: VelocitySignal, Value: 0, Weight: 1, Contribution: 0},
+		{Signal: RulesSignal, Value: 0, Weight: 2, Contribution: 0},
+	}, score.Factors)
+
+	// Fifteen hours later, at night, somewhere else, with a rule firing.
+	score = s.Score(&transaction.Transaction{
+		AccountNumber:     1,
+		TransactionAmount: 20000,
+		TransactionTime:   start.Add(15 * time.Hour),
+		Location:          "Seattle, WA",
+	}, []Finding{{Rule: "big"}})
+	require.Equal(t, 75.0, score.Value)
+	require.Equal(t, []Factor{
+		{Signal: AmountSignal, Value: 1, Weight: 2, Contribution: 25},
+		{Signal: RulesSignal, Value: 1, Weight: 2, Contribution: 25},
+		{Signal: LocationRaritySignal, Value: 1, Weight: 1, Contribution: 12.5},
+		{Signal: HourOfDaySignal, Value: 1, Weight: 1, Contribution: 12.5},
+		{Signal: VelocitySignal, Value: 0, Weight: 1, Contribution: 0},
+		{Signal: AccountAgeSignal, Value: 0, Weight: 1, Contribution: 0},
+	}, score.Factors)
+
+	// Right after, still at night, back in the first location.
+	score = s.Score(&transaction.Transaction{
+		AccountNumber:     1,
+		TransactionAmount: 0,
+		TransactionTime:   start.Add(15*time.Hour + time.Minute),
+		Location:          "Austin, TX",
+	}, nil)
+	require.Equal(t, 25.0, score.Value)
+	require.Equal(t, Factor{Signal: LocationRaritySignal, Value: 0.5, Weight: 1, Contribution: 6.25}, score.Factors[1])
+	require.Equal(t, Factor{Signal: VelocitySignal, Value: 0.5, Weight: 1, Contribution: 6.25}, score.Factors[2])
+}
+
+func TestScorerWarmUp(t *testing.T) {
+	s, err := NewScorer(ScoringConfig{
+		Cutoff: 50,
+		Weights: map[string]float64{
+			LocationRaritySignal: 1,
+			AccountAgeSignal:     1,
+		},
+		NewAccountAge:  Duration(10 * time.Hour),
+		LocationWarmUp: 2,
+	})
+	require.NoError(t, err)
+	start := time.Date(2023, 6, 5, 12, 0, 0, 0, time.UTC)
+	signal := func(score *Score, name string) float64 {
+		for _, f := range score.Factors {
+			if f.Signal == name {
+				return f.Value
+			}
+		}
+		t.Fatalf("no %s factor", name)
+		return 0
+	}
+
+	// An account first seen when the history starts may be older than it.
+	score := s.Score(&transaction.Transaction{AccountNumber: 1, TransactionTime: start, Location: "Austin, TX"}, nil)
+	require.Equal(t, 0.0, signal(score, AccountAgeSignal))
+	// Too few transactions to compare locations with.
+	score = s.Score(&transaction.Transaction{AccountNumber: 1, TransactionTime: start.Add(time.Hour), Location: "Seattle, WA"}, nil)
+	require.Equal(t, 0.0, signal(score, LocationRaritySignal))
+	score = s.Score(&transaction.Transaction{AccountNumber: 1, TransactionTime: start.Add(2 * time.Hour), Location: "Denver, CO"}, nil)
+	require.Equal(t, 1.0, signal(score, LocationRaritySignal))
+
+	// Once the history is old enough, a new account is told apart.
+	score = s.Score(&transaction.Transaction{AccountNumber: 2, TransactionTime: start.Add(10 * time.Hour), Location: "Austin, TX"}, nil)
+	require.Equal(t, 1.0, signal(score, AccountAgeSignal))
+}
+
+func TestAssess(t *testing.T) {
+	rs, err := Parse([]byte(`{
+		"rules": [{"name":"big","kind":"amount","params":{"greater_than":10000}}],
+		"scoring": {"cutoff": 50, "weights": {"amount": 1, "rules": 1}}
+	}`))
+	require.NoError(t, err)
+	v := rs.Assess(&transaction.Transaction{TransactionAmount: 5000})
+	require.False(t, v.Suspicious())
+	require.Nil(t, v.Findings)
+	require.Equal(t, 12.5, v.Score.Value)
+
+	v = rs.Assess(&transaction.Transaction{TransactionAmount: 10001})
+	require.True(t, v.Suspicious())
+	require.Len(t, v.Findings, 1)
+
+	v = Default().Assess(&transaction.Transaction{TransactionAmount: 10001})
+	require.True(t, v.Suspicious())
+	require.Nil(t, v.Score)
+
+	_, err = Parse([]byte(`{"scoring": {"cutoff": 50}}`))
+	require.Equal(t, "scoring: weights must not be empty", err.Error())
+}
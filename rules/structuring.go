@@ -0,0 +1,133 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// StructuringKind is the kind name of StructuringRule.
+const StructuringKind = "structuring"
+
+// Defaults of StructuringRule.
+const (
+	defaultStructuringThreshold = float32(10_000)
+	defaultStructuringMinCount  = 3
+)
+
+func init() {
+	Register(StructuringKind, newStructuringRule)
+}
+
+// StructuringRule watches each account for repeated amounts just below
+// the reporting threshold, that is, inside [Threshold-Band, Threshold],
+// and fires when MinCount of them happen within Period.
+// Amounts outside the band are ignored, so a single account moving both
+// small and large sums is not flagged.
+//
+// Like VelocityRule, the account is flagged once when it reaches MinCount,
+// and again only after the period has dropped back under it.
+type StructuringRule struct {
+	name        string
+	Threshold   float32  `json:"threshold,omitempty"`
+	Band        float32  `json:"band"`
+	MinCount    int      `json:"min_count,omitempty"`
+	Period      Duration `json:"period"`
+	Types       []string `json:"types,omitempty"`
+	MaxAccounts int      `json:"max_accounts,omitempty"`
+	types       map[string]struct{}
+	states      *accountStates[structuringState]
+}
+
+// structuringState holds the in-band transactions of an account.
+type structuringState struct {
+	window  slidingWindow
+	reached bool
+}
+
+// newStructuringRule is the Factory of StructuringRule.
+func newStructuringRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &StructuringRule{name: name}
+	if err := decodeParams(params, r); err != nil {
+		return nil, err
+	}
+	if r.Threshold < 0 || r.MinCount < 0 || r.MaxAccounts < 0 {
+		return nil, errors.New("threshold, min_count and max_accounts must not be negative")
+	}
+	if r.Threshold == 0 {
+		r.Threshold = defaultStructuringThreshold
+	}
+	if r.Band <= 0 || r.Band >= r.Threshold {
+		return nil, errors.New("band must be greater than zero and lower than threshold")
+	}
+	if r.MinCount == 0 {
+		r.MinCount = defaultStructuringMinCount
+	}
+	if r.MinCount < 2 {
+		return nil, errors.New("min_count must be at least 2")
+	}
+	if r.Period <= 0 {
+		return nil, errors.New("period must be greater than zero")
+	}
+	if r.MaxAccounts == 0 {
+		r.MaxAccounts = defaultMaxAccounts
+	}
+	if len(r.Types) > 0 {
+		r.types = toSet(r.Types)
+	}
+	r.states = newAccountStates[structuringState](r.MaxAccounts)
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *StructuringRule) Name() string {
+	return r.name
+}
+
+// Evaluate adds in-band transactions to the window of their account and
+// checks whether the account reached MinCount of them.
+func (r *StructuringRule) Evaluate(t *transaction.Transaction) *Finding {
+	if r.types != nil {
+		if _, ok := r.types[t.TransactionType]; !ok {
+			return nil
+		}
+	}
+	lower := r.Threshold - r.Band
+	if t.TransactionAmount < lower || t.TransactionAmount > r.Threshold {
+		return nil
+	}
+	var (
+		count  int
+		amount float32
+		fire   bool
+	)
+	r.states.update(t.AccountNumber, func(s *structuringState) {
+		if !s.window.add(windowEvent{at: t.TransactionTime, amount: t.TransactionAmount}, time.Duration(r.Period)) {
+			return
+		}
+		count, amount = s.window.totals()
+		reached := count >= r.MinCount
+		fire = reached && !s.reached
+		s.reached = reached
+	})
+	if !fire {
+		return nil
+	}
+	return &Finding{
+		Rule: r.name,
+		Detail: fmt.Sprintf("%d amounts between %.2f and %.2f totalling %.2f within %s",
+			count, lower, r.Threshold, amount, time.Duration(r.Period)),
+		Attributes: map[string]any{
+			"count":     count,
+			"total":     amount,
+			"threshold": r.Threshold,
+			"band":      r.Band,
+		},
+	}
+}
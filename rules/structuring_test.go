@@ -0,0 +1,185 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestNewStructuringRule(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        string
+		expectedError error
+	}{
+		{
+			name:   "happy path",
+			params: `{"band":1000,"period":"24h"}`,
+		},
+		{
+			name:          "missing band",
+			params:        `{"period":"24h"}`,
+			expectedError: errors.New("band must be greater than zero and lower than threshold"),
+		},
+		{
+			name:          "band wider than threshold",
+			params:        `{"threshold":500,"band":1000,"period":"24h"}`,
+			expectedError: errors.New("band must be greater than zero and lower than threshold"),
+		},
+		{
+			name:          "min count too low",
+			params:        `{"band":1000,"period":"24h","min_count":1}`,
+			expectedError: errors.New("min_count must be at least 2"),
+		},
+		{
+			name:          "negative value",
+			params:        `{"band":1000,"period":"24h","min_count":-1}`,
+			expectedError: errors.New("threshold, min_count and max_accounts must not be negative"),
+		},
+		{
+			name:          "missing period",
+			params:        `{"band":1000}`,
+			expectedError: errors.New("period must be greater than zero"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newStructuringRule("x", []byte(tc.params), Dependencies{})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.NotNil(t, r)
+			}
+		})
+	}
+}
+
+func TestStructuringRuleEvaluate(t *testing.T) {
+	start := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	withdrawal := func(account int, offset time.Duration, amount float32) *transaction.Transaction {
+		return &transaction.Transaction{
+			AccountNumber:     account,
+			TransactionType:   "withdrawal",
+			TransactionAmount: amount,
+			TransactionTime:   start.Add(offset),
+		}
+	}
+	type step struct {
+		input         *transaction.Transaction
+		expectedFired bool
+	}
+	testCases := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "repeated amounts below the threshold",
+			steps: []step{
+				{input: withdrawal(1, 0, 9500)},
+				{input: withdrawal(1, time.Hour, 9900)},
+				{input: withdrawal(1, 2*time.Hour, 9999.99), expectedFired: true},
+				{input: withdrawal(1, 3*time.Hour, 9800)},
+			},
+		},
+		{
+			name: "amounts outside the band are ignored",
+			steps: []step{
+				{input: withdrawal(1, 0, 9500)},
+				{input: withdrawal(1, time.Hour, 500)},
+				{input: withdrawal(1, 2*time.Hour, 15000)},
+				{input: withdrawal(1, 3*time.Hour, 9500)},
+				{input: withdrawal(1, 4*time.Hour, 9500), expectedFired: true},
+			},
+		},
+		{
+			name: "spread over more than the period",
+			steps: []step{
+				{input: withdrawal(1, 0, 9500)},
+				{input: withdrawal(1, 20*time.Hour, 9500)},
+				{input: withdrawal(1, 40*time.Hour, 9500)},
+			},
+		},
+		{
+			name: "accounts are independent",
+			steps: []step{
+				{input: withdrawal(1, 0, 9500)},
+				{input: withdrawal(2, 0, 9500)},
+				{input: withdrawal(3, 0, 9500)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newStructuringRule("structuring", []byte(`{"band":1000,"period":"24h","types":["withdrawal"]}`), Dependencies{})
+			require.NoError(t, err)
+			for i, s := range tc.steps {
+				f := r.Evaluate(s.input)
+				require.Equal(t, s.expectedFired, f != nil, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestStructuringRuleFinding(t *testing.T) {
+	start := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	r, err := newStructuringRule("structuring", []byte(`{"band":1000,"period":"24h","min_count":2}`), Dependencies{})
+	require.NoError(t, err)
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 9500, TransactionTime: start}))
+	f := r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 9900, TransactionTime: start})
+	require.Equal(t, &Finding{
+		Rule:   "structuring",
+		Detail: "2 amounts between 9000.00 and 10000.00 totalling 19400.00 within 24h0m0s",
+		Attributes: map[string]any{
+			"count":     2,
+			"total":     float32(19400),
+			"threshold": float32(10000),
+			"band":      float32(1000),
+		},
+	}, f)
+}
+
+// TestStructuringRuleMixedDistribution mimics the files written by jsongenerator,
+// where every transaction has a random account and its amount comes from one of
+// two ranges, and makes sure only the account that is structuring is flagged.
+func TestStructuringRuleMixedDistribution(t *testing.T) {
+	r, err := newStructuringRule("structuring", []byte(`{"band":1000,"period":"24h"}`), Dependencies{})
+	require.NoError(t, err)
+	rnd := rand.New(rand.NewSource(1))
+	start := time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+	const structuringAccount = 1
+	var fired []int
+	for i := 0; i < 10_000; i++ {
+		tx := &transaction.Transaction{
+			AccountNumber:   rnd.Intn(999999999-111111111+1) + 111111111,
+			TransactionTime: start.Add(time.Duration(rnd.Intn(86400)) * time.Second),
+		}
+		// Lower limit overlapping the band, like --llmin 5000 --llmax 30000,
+		// and upper limit just below it, like --ulmin 100 --ulmax 8999.
+		if rnd.Float32() < 0.7 {
+			tx.TransactionAmount = rnd.Float32()*(30000-5000) + 5000
+		} else {
+			tx.TransactionAmount = rnd.Float32()*(8999-100) + 100
+		}
+		if i%1000 == 0 {
+			tx.AccountNumber = structuringAccount
+			tx.TransactionAmount = 9000 + rnd.Float32()*999
+		}
+		if f := r.Evaluate(tx); f != nil {
+			fired = append(fired, tx.AccountNumber)
+		}
+	}
+	require.Equal(t, []int{structuringAccount}, fired)
+}
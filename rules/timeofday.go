@@ -0,0 +1,106 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// TimeOfDayKind is the kind name of TimeOfDayRule.
+const TimeOfDayKind = "time_of_day"
+
+func init() {
+	Register(TimeOfDayKind, newTimeOfDayRule)
+}
+
+// clockLayout is the layout used for the boundaries of a time-of-day window.
+const clockLayout = "15:04"
+
+// TimeOfDayRule fires when the transaction happens inside the [From, To)
+// window, using the wall clock of the transaction time. Windows where
+// From is after To wrap around midnight, like "22:00" to "06:00".
+type TimeOfDayRule struct {
+	name string
+	From string `json:"from"`
+	To   string `json:"to"`
+	from time.Duration
+	to   time.Duration
+}
+
+// NewTimeOfDayRule creates a new TimeOfDayRule for the [from, to) window,
+// both in the "hh:mm" format.
+func NewTimeOfDayRule(name, from, to string) (*TimeOfDayRule, error) {
+	r := &TimeOfDayRule{name: name, From: from, To: to}
+	if err := r.parse(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newTimeOfDayRule is the Factory of TimeOfDayRule.
+func newTimeOfDayRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &TimeOfDayRule{name: name}
+	if err := decodeParams(params, r); err != nil {
+		return nil, err
+	}
+	if err := r.parse(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parse parses the boundaries of the window.
+func (r *TimeOfDayRule) parse() error {
+	var err error
+	if r.from, err = parseClock(r.From); err != nil {
+		return errors.Wrap(err, "from")
+	}
+	if r.to, err = parseClock(r.To); err != nil {
+		return errors.Wrap(err, "to")
+	}
+	if r.from == r.to {
+		return errors.New("from and to must be different")
+	}
+	return nil
+}
+
+// parseClock parses a "hh:mm" string into the duration since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse(clockLayout, s)
+	if err != nil {
+		return 0, errors.Wrapf(err, "parsing clock %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Name returns the name of the rule.
+func (r *TimeOfDayRule) Name() string {
+	return r.name
+}
+
+// Evaluate checks whether the transaction time falls inside the window.
+func (r *TimeOfDayRule) Evaluate(t *transaction.Transaction) *Finding {
+	tt := t.TransactionTime
+	sinceMidnight := time.Duration(tt.Hour())*time.Hour +
+		time.Duration(tt.Minute())*time.Minute +
+		time.Duration(tt.Second())*time.Second
+	var inside bool
+	if r.from < r.to {
+		inside = sinceMidnight >= r.from && sinceMidnight < r.to
+	} else {
+		inside = sinceMidnight >= r.from || sinceMidnight < r.to
+	}
+	if !inside {
+		return nil
+	}
+	return &Finding{
+		Rule:   r.name,
+		Detail: fmt.Sprintf("time %s is between %s and %s", tt.Format(clockLayout), r.From, r.To),
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestNewTimeOfDayRule(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        string
+		expectedError error
+	}{
+		{
+			name:   "happy path",
+			params: `{"from":"22:00","to":"06:00"}`,
+		},
+		{
+			name:          "invalid from",
+			params:        `{"from":"25:00","to":"06:00"}`,
+			expectedError: errors.New(`from: parsing clock "25:00": parsing time "25:00": hour out of range`),
+		},
+		{
+			name:          "invalid to",
+			params:        `{"from":"22:00","to":"six"}`,
+			expectedError: errors.New(`to: parsing clock "six": parsing time "six" as "15:04": cannot parse "six" as "15"`),
+		},
+		{
+			name:          "empty window",
+			params:        `{"from":"22:00","to":"22:00"}`,
+			expectedError: errors.New("from and to must be different"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newTimeOfDayRule("x", []byte(tc.params), Dependencies{})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.NotNil(t, r)
+			}
+		})
+	}
+}
+
+func TestTimeOfDayRuleEvaluate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        string
+		hour, minute  int
+		expectedFired bool
+	}{
+		{name: "inside window", params: `{"from":"09:00","to":"17:00"}`, hour: 12, expectedFired: true},
+		{name: "at window start", params: `{"from":"09:00","to":"17:00"}`, hour: 9, expectedFired: true},
+		{name: "at window end", params: `{"from":"09:00","to":"17:00"}`, hour: 17},
+		{name: "outside window", params: `{"from":"09:00","to":"17:00"}`, hour: 20},
+		{name: "wrapping window before midnight", params: `{"from":"22:00","to":"06:00"}`, hour: 23, minute: 30, expectedFired: true},
+		{name: "wrapping window after midnight", params: `{"from":"22:00","to":"06:00"}`, hour: 2, expectedFired: true},
+		{name: "outside wrapping window", params: `{"from":"22:00","to":"06:00"}`, hour: 12},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newTimeOfDayRule("x", []byte(tc.params), Dependencies{})
+			require.NoError(t, err)
+			tt := time.Date(2023, 6, 5, tc.hour, tc.minute, 0, 0, time.UTC)
+			f := r.Evaluate(&transaction.Transaction{TransactionTime: tt})
+			require.Equal(t, tc.expectedFired, f != nil)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// TransactionTypeKind is the kind name of TransactionTypeRule.
+const TransactionTypeKind = "transaction_type"
+
+func init() {
+	Register(TransactionTypeKind, newTransactionTypeRule)
+}
+
+// TransactionTypeRule fires when the transaction type is one of Types.
+type TransactionTypeRule struct {
+	name  string
+	Types []string `json:"types"`
+	types map[string]struct{}
+}
+
+// newTransactionTypeRule is the Factory of TransactionTypeRule.
+func newTransactionTypeRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &TransactionTypeRule{name: name}
+	if err := decodeParams(params, r); err != nil {
+		return nil, err
+	}
+	if len(r.Types) == 0 {
+		return nil, errors.New("types must not be empty")
+	}
+	r.types = toSet(r.Types)
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *TransactionTypeRule) Name() string {
+	return r.name
+}
+
+// Evaluate checks whether the transaction type is one of the configured ones.
+func (r *TransactionTypeRule) Evaluate(t *transaction.Transaction) *Finding {
+	if _, ok := r.types[t.TransactionType]; !ok {
+		return nil
+	}
+	return &Finding{
+		Rule:   r.name,
+		Detail: fmt.Sprintf("transaction type is %s", t.TransactionType),
+	}
+}
+
+// toSet converts a slice of strings into a set.
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[v] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// VelocityKind is the kind name of VelocityRule.
+const VelocityKind = "velocity"
+
+func init() {
+	Register(VelocityKind, newVelocityRule)
+}
+
+// VelocityRule keeps a sliding window per account and fires when the number
+// of transactions or their summed amount inside the window goes over the limit.
+// The window is based on the transaction time, so replaying historical data
+// gives the same results as processing it live.
+//
+// The account is flagged once when it goes over the limit, and again only
+// after the window has dropped back under it.
+type VelocityRule struct {
+	name        string
+	Window      Duration `json:"window"`
+	MaxCount    int      `json:"max_count,omitempty"`
+	MaxAmount   float32  `json:"max_amount,omitempty"`
+	Types       []string `json:"types,omitempty"`
+	MaxAccounts int      `json:"max_accounts,omitempty"`
+	types       map[string]struct{}
+	states      *accountStates[velocityState]
+}
+
+// velocityState is the sliding window of an account.
+type velocityState struct {
+	window slidingWindow
+	over   bool
+}
+
+// newVelocityRule is the Factory of VelocityRule.
+func newVelocityRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &VelocityRule{name: name}
+	if err := decodeParams(params, r); err != nil {
+		return nil, err
+	}
+	if r.Window <= 0 {
+		return nil, errors.New("window must be greater than zero")
+	}
+	if r.MaxCount < 0 || r.MaxAmount < 0 {
+		return nil, errors.New("max_count and max_amount must not be negative")
+	}
+	if r.MaxCount == 0 && r.MaxAmount == 0 {
+		return nil, errors.New("either max_count or max_amount must be set")
+	}
+	if r.MaxAccounts < 0 {
+		return nil, errors.New("max_accounts must not be negative")
+	}
+	if r.MaxAccounts == 0 {
+		r.MaxAccounts = defaultMaxAccounts
+	}
+	if len(r.Types) > 0 {
+		r.types = toSet(r.Types)
+	}
+	r.states = newAccountStates[velocityState](r.MaxAccounts)
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *VelocityRule) Name() string {
+	return r.name
+}
+
+// Evaluate adds the transaction to the window of its account and checks
+// whether the account went over the limit.
+func (r *VelocityRule) Evaluate(t *transaction.Transaction) *Finding {
+	if r.types != nil {
+		if _, ok := r.types[t.TransactionType]; !ok {
+			return nil
+		}
+	}
+	var (
+		count  int
+		amount float32
+		fire   bool
+	)
+	r.states.update(t.AccountNumber, func(s *velocityState) {
+		if !s.window.add(windowEvent{at: t.TransactionTime, amount: t.TransactionAmount}, time.Duration(r.Window)) {
+			return
+		}
+		count, amount = s.window.totals()
+		over := (r.MaxCount > 0 && count > r.MaxCount) || (r.MaxAmount > 0 && amount > r.MaxAmount)
+		fire = over && !s.over
+		s.over = over
+	})
+	if !fire {
+		return nil
+	}
+	return &Finding{
+		Rule:   r.name,
+		Detail: fmt.Sprintf("%d transactions totalling %.2f within %s", count, amount, time.Duration(r.Window)),
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestNewVelocityRule(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        string
+		expectedError error
+	}{
+		{
+			name:   "happy path",
+			params: `{"window":"1m","max_count":5}`,
+		},
+		{
+			name:          "invalid window",
+			params:        `{"window":"one minute","max_count":5}`,
+			expectedError: errors.New(`decoding params: time: invalid duration "one minute"`),
+		},
+		{
+			name:          "missing window",
+			params:        `{"max_count":5}`,
+			expectedError: errors.New("window must be greater than zero"),
+		},
+		{
+			name:          "missing limits",
+			params:        `{"window":"1m"}`,
+			expectedError: errors.New("either max_count or max_amount must be set"),
+		},
+		{
+			name:          "negative limit",
+			params:        `{"window":"1m","max_count":-1}`,
+			expectedError: errors.New("max_count and max_amount must not be negative"),
+		},
+		{
+			name:          "negative max accounts",
+			params:        `{"window":"1m","max_count":1,"max_accounts":-1}`,
+			expectedError: errors.New("max_accounts must not be negative"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newVelocityRule("x", []byte(tc.params), Dependencies{})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.NotNil(t, r)
+			}
+		})
+	}
+}
+
+func TestVelocityRuleEvaluate(t *testing.T) {
+	start := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	withdrawal := func(account int, offset time.Duration, amount float32) *transaction.Transaction {
+		return &transaction.Transaction{
+			AccountNumber:     account,
+			TransactionType:   "withdrawal",
+			TransactionAmount: amount,
+			TransactionTime:   start.Add(offset),
+		}
+	}
+	type step struct {
+		input         *transaction.Transaction
+		expectedFired bool
+	}
+	testCases := []struct {
+		name   string
+		params string
+		steps  []step
+	}{
+		{
+			name:   "count over the limit",
+			params: `{"window":"1m","max_count":2}`,
+			steps: []step{
+				{input: withdrawal(1, 0, 9999)},
+				{input: withdrawal(1, 10*time.Second, 9999)},
+				{input: withdrawal(1, 20*time.Second, 9999), expectedFired: true},
+				{input: withdrawal(1, 30*time.Second, 9999)},
+			},
+		},
+		{
+			name:   "amount over the limit",
+			params: `{"window":"1m","max_amount":15000}`,
+			steps: []step{
+				{input: withdrawal(1, 0, 9999)},
+				{input: withdrawal(1, 10*time.Second, 9999), expectedFired: true},
+			},
+		},
+		{
+			name:   "accounts are independent",
+			params: `{"window":"1m","max_count":1}`,
+			steps: []step{
+				{input: withdrawal(1, 0, 10)},
+				{input: withdrawal(2, 0, 10)},
+				{input: withdrawal(1, time.Second, 10), expectedFired: true},
+			},
+		},
+		{
+			name:   "old transactions leave the window",
+			params: `{"window":"1m","max_count":1}`,
+			steps: []step{
+				{input: withdrawal(1, 0, 10)},
+				{input: withdrawal(1, 2*time.Minute, 10)},
+				{input: withdrawal(1, 4*time.Minute, 10)},
+			},
+		},
+		{
+			name:   "fires again after going back under the limit",
+			params: `{"window":"1m","max_count":1}`,
+			steps: []step{
+				{input: withdrawal(1, 0, 10)},
+				{input: withdrawal(1, time.Second, 10), expectedFired: true},
+				{input: withdrawal(1, 5*time.Minute, 10)},
+				{input: withdrawal(1, 5*time.Minute+time.Second, 10), expectedFired: true},
+			},
+		},
+		{
+			name:   "out of order transaction inside the window",
+			params: `{"window":"1m","max_count":1}`,
+			steps: []step{
+				{input: withdrawal(1, 30*time.Second, 10)},
+				{input: withdrawal(1, 0, 10), expectedFired: true},
+			},
+		},
+		{
+			name:   "out of order transaction outside the window",
+			params: `{"window":"1m","max_count":1}`,
+			steps: []step{
+				{input: withdrawal(1, 5*time.Minute, 10)},
+				{input: withdrawal(1, 0, 10)},
+			},
+		},
+		{
+			name:   "other transaction types are ignored",
+			params: `{"window":"1m","max_count":1,"types":["deposit"]}`,
+			steps: []step{
+				{input: withdrawal(1, 0, 10)},
+				{input: withdrawal(1, time.Second, 10)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newVelocityRule("velocity", []byte(tc.params), Dependencies{})
+			require.NoError(t, err)
+			for i, s := range tc.steps {
+				f := r.Evaluate(s.input)
+				require.Equal(t, s.expectedFired, f != nil, "step %d", i)
+			}
+		})
+	}
+}
+
+func TestVelocityRuleDetail(t *testing.T) {
+	r, err := newVelocityRule("velocity", []byte(`{"window":"1m","max_count":1}`), Dependencies{})
+	require.NoError(t, err)
+	tt := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 9999, TransactionTime: tt}))
+	f := r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 9999, TransactionTime: tt})
+	require.Equal(t, &Finding{Rule: "velocity", Detail: "2 transactions totalling 19998.00 within 1m0s"}, f)
+}
+
+func TestVelocityRuleConcurrency(t *testing.T) {
+	r, err := newVelocityRule("velocity", []byte(`{"window":"1h","max_count":99}`), Dependencies{})
+	require.NoError(t, err)
+	tt := time.Date(2023, 6, 5, 10, 0, 0, 0, time.UTC)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		fired int
+	)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f := r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionTime: tt.Add(time.Duration(i) * time.Second)})
+			if f != nil {
+				mu.Lock()
+				fired++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, 1, fired)
+}
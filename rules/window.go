@@ -0,0 +1,54 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"sort"
+	"time"
+)
+
+// maxWindowEvents is the maximum number of transactions kept per account
+// inside a sliding window, so a single busy account can't exhaust memory.
+const maxWindowEvents = 1_000
+
+// slidingWindow holds the transactions of an account that happened
+// within a period before the most recent one, ordered by time.
+type slidingWindow struct {
+	events []windowEvent
+}
+
+// windowEvent is a transaction inside a sliding window.
+type windowEvent struct {
+	at     time.Time
+	amount float32
+}
+
+// add inserts the event in time order and evicts the events that fell out
+// of the period. It returns false if the event itself is already out of it.
+func (w *slidingWindow) add(e windowEvent, period time.Duration) bool {
+	i := sort.Search(len(w.events), func(i int) bool {
+		return w.events[i].at.After(e.at)
+	})
+	w.events = append(w.events, windowEvent{})
+	copy(w.events[i+1:], w.events[i:])
+	w.events[i] = e
+	newest := w.events[len(w.events)-1].at
+	start := sort.Search(len(w.events), func(i int) bool {
+		return w.events[i].at.After(newest.Add(-period))
+	})
+	if len(w.events)-start > maxWindowEvents {
+		start = len(w.events) - maxWindowEvents
+	}
+	inWindow := !e.at.Before(w.events[start].at)
+	w.events = append(w.events[:0], w.events[start:]...)
+	return inWindow
+}
+
+// totals returns the number of transactions inside the window and their summed amount.
+func (w *slidingWindow) totals() (count int, amount float32) {
+	for _, e := range w.events {
+		amount += e.amount
+	}
+	return len(w.events), amount
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// ZScoreKind is the kind name of ZScoreRule.
+const ZScoreKind = "zscore"
+
+// Defaults of ZScoreRule.
+const (
+	defaultZScoreK      = 3
+	defaultZScoreWarmUp = 10
+	defaultMinStdDev    = 1
+	baselineTimeout     = 5 * time.Second
+)
+
+func init() {
+	Register(ZScoreKind, newZScoreRule)
+}
+
+// ZScoreRule keeps an online mean and variance of the amounts of each
+// account and fires when a transaction amount is more than K standard
+// deviations away from the mean of its account.
+// Accounts with less than WarmUp transactions are never flagged, and
+// MinStdDev keeps accounts that always move the same amount from being
+// flagged for a cent of difference.
+//
+// Baselines are cached in memory and, if a BaselineStore is available,
+// loaded from and saved to it so they survive restarts. A store that
+// buffers saves, like a batched one, keeps evaluations from waiting
+// on every write.
+type ZScoreRule struct {
+	name        string
+	K           float64 `json:"k,omitempty"`
+	WarmUp      int64   `json:"warm_up,omitempty"`
+	MinStdDev   float64 `json:"min_stddev,omitempty"`
+	MaxAccounts int     `json:"max_accounts,omitempty"`
+	store       BaselineStore
+	onError     func(err error)
+	states      *accountStates[zscoreState]
+}
+
+// zscoreState is the cached baseline of an account.
+type zscoreState struct {
+	baseline Baseline
+	loaded   bool
+}
+
+// newZScoreRule is the Factory of ZScoreRule.
+func newZScoreRule(name string, params json.RawMessage, deps Dependencies) (Rule, error) {
+	r := &ZScoreRule{name: name, store: deps.BaselineStore, onError: deps.OnError}
+	if len(params) > 0 {
+		if err := decodeParams(params, r); err != nil {
+			return nil, err
+		}
+	}
+	if r.K < 0 || r.WarmUp < 0 || r.MinStdDev < 0 || r.MaxAccounts < 0 {
+		return nil, errors.New("k, warm_up, min_stddev and max_accounts must not be negative")
+	}
+	if r.K == 0 {
+		r.K = defaultZScoreK
+	}
+	if r.WarmUp == 0 {
+		r.WarmUp = defaultZScoreWarmUp
+	}
+	if r.WarmUp < 2 {
+		return nil, errors.New("warm_up must be at least 2")
+	}
+	if r.MinStdDev == 0 {
+		r.MinStdDev = defaultMinStdDev
+	}
+	if r.MaxAccounts == 0 {
+		r.MaxAccounts = defaultMaxAccounts
+	}
+	r.states = newAccountStates[zscoreState](r.MaxAccounts)
+	return r, nil
+}
+
+// Name returns the name of the rule.
+func (r *ZScoreRule) Name() string {
+	return r.name
+}
+
+// Evaluate scores the transaction amount against the baseline of its
+// account, and then updates the baseline with it.
+func (r *ZScoreRule) Evaluate(t *transaction.Transaction) *Finding {
+	return r.EvaluateContext(context.Background(), t)
+}
+
+// EvaluateContext is like Evaluate, loading and saving the baseline
+// with the context. The store is only reached outside the lock of the
+// account states, so other accounts do not wait on it. If the baseline
+// of the account cannot be loaded, the transaction is neither scored
+// nor added to it, so the stored baseline is not overwritten.
+func (r *ZScoreRule) EvaluateContext(ctx context.Context, t *transaction.Transaction) *Finding {
+	amount := float64(t.TransactionAmount)
+	var loaded bool
+	r.states.update(t.AccountNumber, func(s *zscoreState) {
+		loaded = s.loaded
+	})
+	var stored Baseline
+	if !loaded {
+		var ok bool
+		if stored, ok = r.load(ctx, t.AccountNumber); !ok {
+			return nil
+		}
+	}
+	var (
+		before, after Baseline
+		scored        bool
+	)
+	r.states.update(t.AccountNumber, func(s *zscoreState) {
+		// Unless a concurrent evaluation of the account loaded it first.
+		if !s.loaded {
+			s.baseline = stored
+			s.loaded = true
+		}
+		before = s.baseline
+		scored = before.Count >= r.WarmUp
+		s.baseline.Add(amount)
+		after = s.baseline
+	})
+	r.save(ctx, &after)
+	if !scored {
+		return nil
+	}
+	stdDev := math.Max(before.StdDev(), r.MinStdDev)
+	z := (amount - before.Mean) / stdDev
+	if math.Abs(z) <= r.K {
+		return nil
+	}
+	return &Finding{
+		Rule: r.name,
+		Detail: fmt.Sprintf("amount %.2f is %.1f standard deviations from the account mean %.2f",
+			amount, z, before.Mean),
+		Attributes: map[string]any{
+			"z_score": round2(z),
+			"mean":    round2(before.Mean),
+			"stddev":  round2(stdDev),
+			"samples": before.Count,
+		},
+	}
+}
+
+// load returns the stored baseline of the account, or an empty one.
+// It fails if the store cannot be reached.
+func (r *ZScoreRule) load(ctx context.Context, accountNumber int) (Baseline, bool) {
+	empty := Baseline{AccountNumber: accountNumber}
+	if r.store == nil {
+		return empty, true
+	}
+	ctx, cancel := context.WithTimeout(ctx, baselineTimeout)
+	defer cancel()
+	b, err := r.store.Load(ctx, accountNumber)
+	if err != nil {
+		r.reportError(errors.Wrapf(err, "loading baseline of account %d", accountNumber))
+		return empty, false
+	}
+	if b == nil {
+		return empty, true
+	}
+	return *b, true
+}
+
+// save persists the baseline, if there is a store.
+func (r *ZScoreRule) save(ctx context.Context, b *Baseline) {
+	if r.store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, baselineTimeout)
+	defer cancel()
+	if err := r.store.Save(ctx, b); err != nil {
+		r.reportError(errors.Wrapf(err, "saving baseline of account %d", b.AccountNumber))
+	}
+}
+
+// reportError calls the error handler, if any.
+func (r *ZScoreRule) reportError(err error) {
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+// round2 rounds a value to two decimal places.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
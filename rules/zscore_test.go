@@ -0,0 +1,169 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package rules
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+type mockBaselineStore struct {
+	loadErr error
+	saveErr error
+	*MemoryBaselineStore
+}
+
+func (m *mockBaselineStore) Load(ctx context.Context, accountNumber int) (*Baseline, error) {
+	if m.loadErr != nil {
+		return nil, m.loadErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.MemoryBaselineStore.Load(ctx, accountNumber)
+}
+
+func (m *mockBaselineStore) Save(ctx context.Context, b *Baseline) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	return m.MemoryBaselineStore.Save(ctx, b)
+}
+
+func TestNewZScoreRule(t *testing.T) {
+	testCases := []struct {
+		name          string
+		params        string
+		expectedError error
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name:   "happy path",
+			params: `{"k":4,"warm_up":20,"min_stddev":10}`,
+		},
+		{
+			name:          "negative value",
+			params:        `{"k":-1}`,
+			expectedError: errors.New("k, warm_up, min_stddev and max_accounts must not be negative"),
+		},
+		{
+			name:          "warm up too short",
+			params:        `{"warm_up":1}`,
+			expectedError: errors.New("warm_up must be at least 2"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var params []byte
+			if tc.params != "" {
+				params = []byte(tc.params)
+			}
+			r, err := newZScoreRule("x", params, Dependencies{})
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.NotNil(t, r)
+			}
+		})
+	}
+}
+
+func TestZScoreRuleEvaluate(t *testing.T) {
+	r, err := newZScoreRule("zscore", []byte(`{"k":3,"warm_up":5}`), Dependencies{})
+	require.NoError(t, err)
+	for _, amount := range []float32{100, 110, 90, 105, 95} {
+		require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: amount}))
+	}
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 115}))
+	f := r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 5000})
+	require.NotNil(t, f)
+	require.Equal(t, "zscore", f.Rule)
+	require.Equal(t, int64(6), f.Attributes["samples"])
+	require.Equal(t, 102.5, f.Attributes["mean"])
+	require.Greater(t, f.Attributes["z_score"], 3.0)
+
+	// Warm-up of another account.
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 2, TransactionAmount: 1}))
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 2, TransactionAmount: 1_000_000}))
+}
+
+func TestZScoreRuleMinStdDev(t *testing.T) {
+	r, err := newZScoreRule("zscore", []byte(`{"k":3,"warm_up":3,"min_stddev":10}`), Dependencies{})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 100}))
+	}
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 101}))
+	require.NotNil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 200}))
+}
+
+func TestZScoreRuleStore(t *testing.T) {
+	store := &mockBaselineStore{MemoryBaselineStore: NewMemoryBaselineStore()}
+	require.NoError(t, store.Save(context.TODO(), &Baseline{AccountNumber: 1, Count: 10, Mean: 100, M2: 900}))
+	r, err := newZScoreRule("zscore", nil, Dependencies{BaselineStore: store})
+	require.NoError(t, err)
+
+	// The stored baseline is already warmed up.
+	require.NotNil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 1000}))
+	b, err := store.Load(context.TODO(), 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(11), b.Count)
+
+	var reported []string
+	store.loadErr = errors.New("random error")
+	store.saveErr = errors.New("random error")
+	r, err = newZScoreRule("zscore", nil, Dependencies{
+		BaselineStore: store,
+		OnError: func(err error) {
+			reported = append(reported, err.Error())
+		},
+	})
+	require.NoError(t, err)
+	// Without its baseline, the transaction is skipped.
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 1000}))
+	require.Equal(t, []string{
+		"loading baseline of account 1: random error",
+	}, reported)
+	store.loadErr = nil
+	require.Nil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 2, TransactionAmount: 1000}))
+	require.Equal(t, []string{
+		"loading baseline of account 1: random error",
+		"saving baseline of account 2: random error",
+	}, reported)
+
+	// Once it can be loaded, the account is scored against it.
+	store.saveErr = nil
+	require.NotNil(t, r.Evaluate(&transaction.Transaction{AccountNumber: 1, TransactionAmount: 1000}))
+}
+
+func TestZScoreRuleEvaluateContext(t *testing.T) {
+	store := &mockBaselineStore{MemoryBaselineStore: NewMemoryBaselineStore()}
+	require.NoError(t, store.Save(context.TODO(), &Baseline{AccountNumber: 1, Count: 10, Mean: 100, M2: 900}))
+	var reported []string
+	r, err := newZScoreRule("zscore", nil, Dependencies{
+		BaselineStore: store,
+		OnError: func(err error) {
+			reported = append(reported, err.Error())
+		},
+	})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	rs := New(r)
+	require.False(t, rs.AssessContext(ctx, &transaction.Transaction{AccountNumber: 1, TransactionAmount: 1000}).Suspicious())
+	require.Equal(t, []string{"loading baseline of account 1: context canceled"}, reported)
+	require.True(t, rs.AssessContext(context.TODO(), &transaction.Transaction{AccountNumber: 1, TransactionAmount: 1000}).Suspicious())
+}
@@ -81,7 +81,17 @@ func (s *KafkaConsumerScreen) UpdateContent(finalUpdate bool) error {
 		template("Total processed transactions", fmt.Sprintf("%d", s.stats.TotalTransactions())),
 		template("Suspicous transactions", fmt.Sprintf("%d", s.stats.TotalSuspiciousTransactions())),
 		template("Invalid kafka messages", fmt.Sprintf("%d", s.stats.TotalUnmarshallingMsgErrors())),
+		template("Duplicate transactions", fmt.Sprintf("%d", s.stats.TotalDuplicateTransactions())),
 		template("Total DB errors", fmt.Sprintf("%d", s.stats.TotalInsertSuspiciousTransactionErrors())),
+		template("DB bulk writes", fmt.Sprintf("%d", s.stats.TotalBulkWrites())),
+		template("DB insert retries", fmt.Sprintf("%d", s.stats.TotalInsertRetries())),
+		template("DB circuit breaker", s.stats.DbBreakerState()),
+		template("Dead-lettered messages", fmt.Sprintf("%d", s.stats.TotalDeadLetteredMessages())),
+		template("Dead-letter errors", fmt.Sprintf("%d", s.stats.TotalDeadLetterErrors())),
+		template("Worker pool size", fmt.Sprintf("%d", s.stats.Workers())),
+		template("Busy workers", fmt.Sprintf("%d", s.stats.BusyWorkers())),
+		template("Average queue wait", s.stats.QueueWait().Round(time.Microsecond).String()),
+		template("Worker panics", fmt.Sprintf("%d", s.stats.TotalWorkerPanics())),
 		template("Elapsed Time", formatDuration(s.stats.ElapsedTime())),
 	}
 	banner := ptermDefaultCenterSprint(string(kafkaConsumerBanner))
@@ -112,6 +122,9 @@ func (s *KafkaProducerScreen) UpdateContent(finalUpdate bool) error {
 	out := []string{
 		template("Total published messages", fmt.Sprintf("%d", s.stats.TotalPublishedMessages())),
 		template("Total message delivery errors", fmt.Sprintf("%d", s.stats.TotalFailedMessageDeliveries())),
+		template("Throughput", fmt.Sprintf("%.0f msg/s", s.stats.Throughput())),
+		template("Messages in flight", fmt.Sprintf("%d", s.stats.InFlightMessages())),
+		template("Rejected lines", fmt.Sprintf("%d", s.stats.TotalRejectedLines())),
 		template("Elapsed Time", formatDuration(s.stats.ElapsedTime())),
 	}
 	banner := ptermDefaultCenterSprint(string(kafkaProducerBanner))
@@ -4,8 +4,11 @@
 package stats
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/tiagomelo/realtime-data-kafka/latency"
 )
 
 // KafkaConsumerStats represents the statistics for Kafka consumer operations.
@@ -14,6 +17,16 @@ type KafkaConsumerStats struct {
 	totalSuspiciousTransactions            int64
 	totalUnmarshallingMsgErrors            int64
 	totalInsertSuspiciousTransactionErrors int64
+	totalDeadLetteredMessages              int64
+	totalDeadLetterErrors                  int64
+	totalInsertRetries                     int64
+	totalBulkWrites                        int64
+	totalDuplicateTransactions             int64
+	totalWorkerPanics                      int64
+	busyWorkers                            int64
+	workers                                int64
+	queueWait                              int64
+	dbBreakerState                         atomic.Value
 	elapsedTime                            time.Duration
 }
 
@@ -21,6 +34,12 @@ type KafkaConsumerStats struct {
 type KafkaProducerStats struct {
 	totalPublishedMessages       int64
 	totalFailedMessageDeliveries int64
+	inFlightMessages             int64
+	totalRejectedLines           int64
+	throughput                   atomic.Value
+	deliveryLatency              latency.Histogram
+	mu                           sync.Mutex
+	failuresByCode               map[string]int64
 	elapsedTime                  time.Duration
 }
 
@@ -31,7 +50,7 @@ func (stats *KafkaConsumerStats) IncrTotalTransactions() {
 
 // TotalTransactions returns the total number of transactions.
 func (stats *KafkaConsumerStats) TotalTransactions() int64 {
-	return stats.totalTransactions
+	return atomic.LoadInt64(&stats.totalTransactions)
 }
 
 // IncrTotalSuspiciousTransactions increments the total number of suspicious transactions.
@@ -41,7 +60,7 @@ func (stats *KafkaConsumerStats) IncrTotalSuspiciousTransactions() {
 
 // TotalSuspiciousTransactions returns the total number of suspicious transactions.
 func (stats *KafkaConsumerStats) TotalSuspiciousTransactions() int64 {
-	return stats.totalSuspiciousTransactions
+	return atomic.LoadInt64(&stats.totalSuspiciousTransactions)
 }
 
 // IncrTotalUnmarshallingMsgErrors increments the total number of unmarshalling message errors.
@@ -51,7 +70,7 @@ func (stats *KafkaConsumerStats) IncrTotalUnmarshallingMsgErrors() {
 
 // TotalUnmarshallingMsgErrors returns the total number of unmarshalling message errors.
 func (stats *KafkaConsumerStats) TotalUnmarshallingMsgErrors() int64 {
-	return stats.totalUnmarshallingMsgErrors
+	return atomic.LoadInt64(&stats.totalUnmarshallingMsgErrors)
 }
 
 // IncrTotalInsertSuspiciousTransactionErrors increments the total number of insert suspicious transaction errors.
@@ -61,7 +80,101 @@ func (stats *KafkaConsumerStats) IncrTotalInsertSuspiciousTransactionErrors() {
 
 // TotalInsertSuspiciousTransactionErrors returns the total number of insert suspicious transaction errors.
 func (stats *KafkaConsumerStats) TotalInsertSuspiciousTransactionErrors() int64 {
-	return stats.totalInsertSuspiciousTransactionErrors
+	return atomic.LoadInt64(&stats.totalInsertSuspiciousTransactionErrors)
+}
+
+// IncrTotalDeadLetteredMessages increments the total number of messages published to the dead-letter topic.
+func (stats *KafkaConsumerStats) IncrTotalDeadLetteredMessages() {
+	atomic.AddInt64(&stats.totalDeadLetteredMessages, 1)
+}
+
+// TotalDeadLetteredMessages returns the total number of messages published to the dead-letter topic.
+func (stats *KafkaConsumerStats) TotalDeadLetteredMessages() int64 {
+	return atomic.LoadInt64(&stats.totalDeadLetteredMessages)
+}
+
+// IncrTotalDeadLetterErrors increments the total number of errors when publishing to the dead-letter topic.
+func (stats *KafkaConsumerStats) IncrTotalDeadLetterErrors() {
+	atomic.AddInt64(&stats.totalDeadLetterErrors, 1)
+}
+
+// TotalDeadLetterErrors returns the total number of errors when publishing to the dead-letter topic.
+func (stats *KafkaConsumerStats) TotalDeadLetterErrors() int64 {
+	return atomic.LoadInt64(&stats.totalDeadLetterErrors)
+}
+
+// IncrTotalInsertRetries increments the total number of retried suspicious transaction inserts.
+func (stats *KafkaConsumerStats) IncrTotalInsertRetries() {
+	atomic.AddInt64(&stats.totalInsertRetries, 1)
+}
+
+// TotalInsertRetries returns the total number of retried suspicious transaction inserts.
+func (stats *KafkaConsumerStats) TotalInsertRetries() int64 {
+	return atomic.LoadInt64(&stats.totalInsertRetries)
+}
+
+// IncrTotalBulkWrites increments the total number of bulk writes of suspicious transactions.
+func (stats *KafkaConsumerStats) IncrTotalBulkWrites() {
+	atomic.AddInt64(&stats.totalBulkWrites, 1)
+}
+
+// TotalBulkWrites returns the total number of bulk writes of suspicious transactions.
+func (stats *KafkaConsumerStats) TotalBulkWrites() int64 {
+	return atomic.LoadInt64(&stats.totalBulkWrites)
+}
+
+// IncrTotalDuplicateTransactions increments the total number of suspicious transactions that were already stored.
+func (stats *KafkaConsumerStats) IncrTotalDuplicateTransactions() {
+	atomic.AddInt64(&stats.totalDuplicateTransactions, 1)
+}
+
+// TotalDuplicateTransactions returns the total number of suspicious transactions that were already stored.
+func (stats *KafkaConsumerStats) TotalDuplicateTransactions() int64 {
+	return atomic.LoadInt64(&stats.totalDuplicateTransactions)
+}
+
+// IncrTotalWorkerPanics increments the total number of workers that panicked.
+func (stats *KafkaConsumerStats) IncrTotalWorkerPanics() {
+	atomic.AddInt64(&stats.totalWorkerPanics, 1)
+}
+
+// TotalWorkerPanics returns the total number of workers that panicked.
+func (stats *KafkaConsumerStats) TotalWorkerPanics() int64 {
+	return atomic.LoadInt64(&stats.totalWorkerPanics)
+}
+
+// UpdatePool updates the number of busy workers, the size of the worker
+// pool and the average time messages wait for a worker.
+func (stats *KafkaConsumerStats) UpdatePool(busyWorkers, workers int, queueWait time.Duration) {
+	atomic.StoreInt64(&stats.busyWorkers, int64(busyWorkers))
+	atomic.StoreInt64(&stats.workers, int64(workers))
+	atomic.StoreInt64(&stats.queueWait, int64(queueWait))
+}
+
+// BusyWorkers returns the number of busy workers.
+func (stats *KafkaConsumerStats) BusyWorkers() int {
+	return int(atomic.LoadInt64(&stats.busyWorkers))
+}
+
+// Workers returns the size of the worker pool.
+func (stats *KafkaConsumerStats) Workers() int {
+	return int(atomic.LoadInt64(&stats.workers))
+}
+
+// QueueWait returns the average time messages wait for a worker.
+func (stats *KafkaConsumerStats) QueueWait() time.Duration {
+	return time.Duration(atomic.LoadInt64(&stats.queueWait))
+}
+
+// UpdateDbBreakerState updates the state of the MongoDB circuit breaker.
+func (stats *KafkaConsumerStats) UpdateDbBreakerState(state string) {
+	stats.dbBreakerState.Store(state)
+}
+
+// DbBreakerState returns the state of the MongoDB circuit breaker.
+func (stats *KafkaConsumerStats) DbBreakerState() string {
+	state, _ := stats.dbBreakerState.Load().(string)
+	return state
 }
 
 // UpdateElapsedTime updates the elapsed time for Kafka consumer operations.
@@ -81,7 +194,7 @@ func (stats *KafkaProducerStats) IncrTotalPublishedMessages() {
 
 // TotalPublishedMessages returns the total number of published messages.
 func (stats *KafkaProducerStats) TotalPublishedMessages() int64 {
-	return stats.totalPublishedMessages
+	return atomic.LoadInt64(&stats.totalPublishedMessages)
 }
 
 // IncrTotalFailedMessageDeliveries increments the total number of failed message deliveries.
@@ -91,7 +204,69 @@ func (stats *KafkaProducerStats) IncrTotalFailedMessageDeliveries() {
 
 // TotalFailedMessageDeliveries returns the total number of failed message deliveries.
 func (stats *KafkaProducerStats) TotalFailedMessageDeliveries() int64 {
-	return stats.totalFailedMessageDeliveries
+	return atomic.LoadInt64(&stats.totalFailedMessageDeliveries)
+}
+
+// IncrFailedMessageDeliveriesByCode increments the number of failed message deliveries with the given error code.
+func (stats *KafkaProducerStats) IncrFailedMessageDeliveriesByCode(code string) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.failuresByCode == nil {
+		stats.failuresByCode = make(map[string]int64)
+	}
+	stats.failuresByCode[code]++
+}
+
+// FailedMessageDeliveriesByCode returns the number of failed message deliveries by error code.
+func (stats *KafkaProducerStats) FailedMessageDeliveriesByCode() map[string]int64 {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	failures := make(map[string]int64, len(stats.failuresByCode))
+	for code, n := range stats.failuresByCode {
+		failures[code] = n
+	}
+	return failures
+}
+
+// RecordDeliveryLatency records the time between producing a message and its delivery.
+func (stats *KafkaProducerStats) RecordDeliveryLatency(d time.Duration) {
+	stats.deliveryLatency.Record(d)
+}
+
+// DeliveryLatency returns the q quantile, between 0 and 1, of the delivery latencies.
+func (stats *KafkaProducerStats) DeliveryLatency(q float64) time.Duration {
+	return stats.deliveryLatency.Quantile(q)
+}
+
+// UpdateInFlightMessages updates the number of messages produced whose delivery was not reported yet.
+func (stats *KafkaProducerStats) UpdateInFlightMessages(inFlight int) {
+	atomic.StoreInt64(&stats.inFlightMessages, int64(inFlight))
+}
+
+// InFlightMessages returns the number of messages produced whose delivery was not reported yet.
+func (stats *KafkaProducerStats) InFlightMessages() int64 {
+	return atomic.LoadInt64(&stats.inFlightMessages)
+}
+
+// IncrTotalRejectedLines increments the total number of lines rejected for being too long or having no key.
+func (stats *KafkaProducerStats) IncrTotalRejectedLines() {
+	atomic.AddInt64(&stats.totalRejectedLines, 1)
+}
+
+// TotalRejectedLines returns the total number of lines rejected for being too long or having no key.
+func (stats *KafkaProducerStats) TotalRejectedLines() int64 {
+	return atomic.LoadInt64(&stats.totalRejectedLines)
+}
+
+// UpdateThroughput updates the number of messages delivered per second.
+func (stats *KafkaProducerStats) UpdateThroughput(throughput float64) {
+	stats.throughput.Store(throughput)
+}
+
+// Throughput returns the number of messages delivered per second.
+func (stats *KafkaProducerStats) Throughput() float64 {
+	throughput, _ := stats.throughput.Load().(float64)
+	return throughput
 }
 
 // UpdateElapsedTime updates the elapsed time for Kafka producer operations.
@@ -0,0 +1,111 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Busy ratios between which the size of the pool is kept.
+const (
+	highBusyRatio = 0.8
+	lowBusyRatio  = 0.3
+)
+
+// Autoscaler resizes a pool within bounds. It grows the pool when its
+// goroutines are nearly always busy and work piles up, and shrinks it
+// when they are mostly idle and there is no backlog.
+type Autoscaler struct {
+	Pool *Task
+	Min  int
+	Max  int
+	// Lag returns how much work is waiting, like the consumer lag.
+	Lag func() (int64, error)
+	// MaxLag is the lag above which the pool is falling behind.
+	MaxLag   int64
+	Interval time.Duration
+	// OnResize, if not nil, is called after every resize, with its error.
+	OnResize func(from, to int, err error)
+	// OnError, if not nil, is called when the lag cannot be read.
+	OnError func(err error)
+}
+
+// Validate checks the bounds of the pool, the interval and the maximum
+// lag, which must be set before Run is called.
+func (a *Autoscaler) Validate() error {
+	switch {
+	case a.Min < 1:
+		return errors.Errorf("minimum pool size %d must be at least 1", a.Min)
+	case a.Max < a.Min:
+		return errors.Errorf("maximum pool size %d must not be less than the minimum %d", a.Max, a.Min)
+	case a.Interval <= 0:
+		return errors.Errorf("interval %v must be positive", a.Interval)
+	case a.MaxLag < 0:
+		return errors.Errorf("maximum lag %d must not be negative", a.MaxLag)
+	}
+	return nil
+}
+
+// Run resizes the pool every interval, until the context is done.
+func (a *Autoscaler) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+	last, lastAt := a.Pool.Metrics(), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m := a.Pool.Metrics()
+			ratio := busyRatio(last.BusyTime, m.BusyTime, now.Sub(lastAt), m.Workers)
+			last, lastAt = m, now
+			lag, err := a.Lag()
+			if err != nil {
+				if a.OnError != nil {
+					a.OnError(err)
+				}
+				continue
+			}
+			to := a.next(m.Workers, ratio, lag)
+			if to == m.Workers {
+				continue
+			}
+			err = a.Pool.Resize(to)
+			if a.OnResize != nil {
+				a.OnResize(m.Workers, to, err)
+			}
+		}
+	}
+}
+
+// next returns the size the pool should have, given its current size,
+// its busy ratio and the lag.
+func (a *Autoscaler) next(size int, busyRatio float64, lag int64) int {
+	switch {
+	case busyRatio >= highBusyRatio && lag > a.MaxLag:
+		size *= 2
+	case busyRatio <= lowBusyRatio && lag <= a.MaxLag:
+		// Shrinking by a quarter, but by one at least.
+		size -= (size + 3) / 4
+	}
+	if size > a.Max {
+		size = a.Max
+	}
+	if size < a.Min {
+		size = a.Min
+	}
+	return size
+}
+
+// busyRatio returns the share of the time the goroutines of the pool
+// spent running workers during the elapsed time.
+func busyRatio(from, to, elapsed time.Duration, workers int) float64 {
+	if elapsed <= 0 || workers == 0 {
+		return 0
+	}
+	return float64(to-from) / (float64(elapsed) * float64(workers))
+}
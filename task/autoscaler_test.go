@@ -0,0 +1,182 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoscalerNext(t *testing.T) {
+	testCases := []struct {
+		name         string
+		size         int
+		busyRatio    float64
+		lag          int64
+		expectedSize int
+	}{
+		{
+			name:         "saturated and behind",
+			size:         4,
+			busyRatio:    0.9,
+			lag:          5000,
+			expectedSize: 8,
+		},
+		{
+			name:         "saturated and behind, at the maximum",
+			size:         12,
+			busyRatio:    0.9,
+			lag:          5000,
+			expectedSize: 16,
+		},
+		{
+			name:         "saturated but keeping up",
+			size:         4,
+			busyRatio:    0.9,
+			lag:          10,
+			expectedSize: 4,
+		},
+		{
+			name:         "behind but not saturated",
+			size:         4,
+			busyRatio:    0.5,
+			lag:          5000,
+			expectedSize: 4,
+		},
+		{
+			name:         "idle",
+			size:         8,
+			busyRatio:    0.1,
+			lag:          0,
+			expectedSize: 6,
+		},
+		{
+			name:         "idle, small pool",
+			size:         3,
+			busyRatio:    0.1,
+			lag:          0,
+			expectedSize: 2,
+		},
+		{
+			name:         "idle, at the minimum",
+			size:         2,
+			busyRatio:    0,
+			lag:          0,
+			expectedSize: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &Autoscaler{Min: 2, Max: 16, MaxLag: 1000}
+			require.Equal(t, tc.expectedSize, a.next(tc.size, tc.busyRatio, tc.lag))
+		})
+	}
+}
+
+func TestAutoscalerValidate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		autoscaler    Autoscaler
+		expectedError string
+	}{
+		{
+			name:       "valid",
+			autoscaler: Autoscaler{Min: 2, Max: 2, Interval: time.Second},
+		},
+		{
+			name:          "min below 1",
+			autoscaler:    Autoscaler{Min: 0, Max: 8, Interval: time.Second},
+			expectedError: "minimum pool size 0 must be at least 1",
+		},
+		{
+			name:          "max below min",
+			autoscaler:    Autoscaler{Min: 4, Max: 2, Interval: time.Second},
+			expectedError: "maximum pool size 2 must not be less than the minimum 4",
+		},
+		{
+			name:          "no interval",
+			autoscaler:    Autoscaler{Min: 1, Max: 2},
+			expectedError: "interval 0s must be positive",
+		},
+		{
+			name:          "negative max lag",
+			autoscaler:    Autoscaler{Min: 1, Max: 2, Interval: time.Second, MaxLag: -1},
+			expectedError: "maximum lag -1 must not be negative",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.autoscaler.Validate()
+			if tc.expectedError == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestBusyRatio(t *testing.T) {
+	require.Equal(t, 0.5, busyRatio(time.Second, 5*time.Second, 2*time.Second, 4))
+	require.Equal(t, float64(0), busyRatio(0, time.Second, 0, 4))
+}
+
+func TestAutoscalerRun(t *testing.T) {
+	pool := New(context.TODO(), 4)
+	defer pool.Shutdown()
+	resized := make(chan [2]int, 1)
+	a := &Autoscaler{
+		Pool:     pool,
+		Min:      2,
+		Max:      8,
+		MaxLag:   1000,
+		Interval: time.Millisecond,
+		Lag: func() (int64, error) {
+			return 0, nil
+		},
+		OnResize: func(from, to int, err error) {
+			require.NoError(t, err)
+			select {
+			case resized <- [2]int{from, to}:
+			default:
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+	require.Equal(t, [2]int{4, 3}, <-resized)
+}
+
+func TestAutoscalerRunLagError(t *testing.T) {
+	pool := New(context.TODO(), 4)
+	defer pool.Shutdown()
+	errs := make(chan error, 1)
+	a := &Autoscaler{
+		Pool:     pool,
+		Min:      2,
+		Max:      8,
+		Interval: time.Millisecond,
+		Lag: func() (int64, error) {
+			return 0, errors.New("random error")
+		},
+		OnResize: func(from, to int, err error) {
+			t.Error("unexpected resize")
+		},
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx)
+	require.EqualError(t, <-errs, "random error")
+}
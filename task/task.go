@@ -5,57 +5,370 @@ package task
 
 import (
 	"context"
+	"hash/fnv"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
+// ErrClosed is returned when submitting work to a pool that was shut
+// down, or whose context is done.
+var ErrClosed = errors.New("task pool is closed")
+
 // Worker must be implemented by types that want to use
 // the run pool.
 type Worker interface {
 	Work(ctx context.Context)
 }
 
+// Option configures a Task.
+type Option func(t *Task)
+
+// WithJobTimeout bounds the time every Work call can take, through
+// the context it receives.
+func WithJobTimeout(timeout time.Duration) Option {
+	return func(t *Task) {
+		t.jobTimeout = timeout
+	}
+}
+
+// WithPanicHandler sets the function called with the worker whose
+// Work panicked and the panic, along with its stack trace. The pool
+// keeps running either way.
+func WithPanicHandler(onPanic func(w Worker, err error)) Option {
+	return func(t *Task) {
+		t.onPanic = onPanic
+	}
+}
+
+// WithLaneBuffer sets how many workers submitted with DoKey can wait
+// in the lane of a goroutine while it is busy. Lanes are unbuffered
+// by default.
+func WithLaneBuffer(size int) Option {
+	return func(t *Task) {
+		t.laneBuffer = size
+	}
+}
+
+// Metrics are the metrics of a pool.
+type Metrics struct {
+	// Workers is the number of goroutines of the pool.
+	Workers int
+	// Busy is the number of goroutines running a Worker.
+	Busy int
+	// BusyTime is the time spent running Workers, summed over all the
+	// goroutines, since the pool was created.
+	BusyTime time.Duration
+	// Completed is the number of Work calls that returned or panicked.
+	Completed int64
+	Panics    int64
+	// QueueWait is the average time between the submission of a Worker
+	// and the start of its Work.
+	QueueWait time.Duration
+}
+
+// job is a submitted Worker along with when it was submitted.
+type job struct {
+	worker    Worker
+	submitted time.Time
+}
+
 // Task provides a pool of goroutines that can execute any Worker
-// tasks that are submitted.
+// tasks that are submitted. Workers submitted with Do run on any free
+// goroutine; workers submitted with DoKey run on the goroutine the key
+// hashes to, its lane, so workers with the same key run one at a time,
+// in the order they were submitted.
 type Task struct {
-	ctx  context.Context
-	work chan Worker
-	wg   sync.WaitGroup
+	ctx        context.Context
+	work       chan job
+	laneBuffer int
+	quit       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+	jobTimeout time.Duration
+	onPanic    func(w Worker, err error)
+	busy       int64
+	busyTime   int64
+	completed  int64
+	panics     int64
+	queueWait  int64
+	workers    int64
+
+	// mu guards the current generation of goroutines: submitting work
+	// to a lane holds it for reading, swapping generations for writing.
+	mu    sync.RWMutex
+	lanes []chan job
+	stop  chan struct{}
+	gen   *sync.WaitGroup
+	// resizing, while not nil, is closed once the next generation of
+	// goroutines is started; resizeMu lets one Resize run at a time.
+	resizing chan struct{}
+	resizeMu sync.Mutex
 }
 
-// New creates a new work pool.
-func New(ctx context.Context, maxGoroutines int) *Task {
+// New creates a new work pool. Its goroutines stop once the context
+// is done, leaving any work not started yet undone.
+func New(ctx context.Context, maxGoroutines int, opts ...Option) *Task {
 	t := Task{
 
 		// Using an unbuffered channel because we want the
 		// guarantee of knowing the work being submitted is
 		// actually being worked on after the call to Run returns.
-		work: make(chan Worker),
-		ctx:  ctx,
+		work:    make(chan job),
+		quit:    make(chan struct{}),
+		ctx:     ctx,
+		onPanic: func(w Worker, err error) {},
 	}
+	for _, opt := range opts {
+		opt(&t)
+	}
+
+	// The goroutines are the pool; Resize changes its size.
+	t.start(maxGoroutines)
+
+	return &t
+}
 
-	// The goroutines are the pool. So we could add code
-	// to change the size of the pool later on.
+// start starts a new generation of n goroutines, each with its lane.
+// It must be called with the lock held.
+func (t *Task) start(n int) {
+	t.lanes = make([]chan job, n)
+	t.stop = make(chan struct{})
+	t.gen = new(sync.WaitGroup)
+	atomic.StoreInt64(&t.workers, int64(n))
+	t.wg.Add(n)
+	t.gen.Add(n)
+	for i := 0; i < n; i++ {
+		t.lanes[i] = make(chan job, t.laneBuffer)
+		go t.loop(t.lanes[i], t.stop, t.gen)
+	}
+}
 
-	t.wg.Add(maxGoroutines)
-	for i := 0; i < maxGoroutines; i++ {
-		go func() {
-			for w := range t.work {
-				w.Work(ctx)
-			}
-			t.wg.Done()
-		}()
+// loop runs the work submitted to the pool or to the lane, until the
+// pool is shut down or resized, or its context is done.
+func (t *Task) loop(lane chan job, stop chan struct{}, gen *sync.WaitGroup) {
+	defer t.wg.Done()
+	defer gen.Done()
+	for {
+		select {
+		case j := <-t.work:
+			t.run(j)
+		case j := <-lane:
+			t.run(j)
+		case <-stop:
+			t.drain(lane)
+			return
+		case <-t.quit:
+			t.drain(lane)
+			return
+		case <-t.ctx.Done():
+			return
+		}
 	}
+}
 
-	return &t
+// drain runs the work already queued in the lane.
+func (t *Task) drain(lane chan job) {
+	for {
+		select {
+		case j := <-lane:
+			t.run(j)
+		default:
+			return
+		}
+	}
+}
+
+// Resize changes the number of goroutines of the pool. To keep the
+// order of the workers of every key, which hash to different lanes
+// once resized, it waits for the work already submitted to be done
+// before starting the new goroutines. Meanwhile, submissions to a lane
+// wait for the new lanes, or for their context to be done.
+func (t *Task) Resize(n int) error {
+	if n < 1 {
+		return errors.Errorf("invalid pool size %d", n)
+	}
+	t.resizeMu.Lock()
+	defer t.resizeMu.Unlock()
+	t.mu.Lock()
+	select {
+	case <-t.quit:
+		t.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	if n == len(t.lanes) {
+		t.mu.Unlock()
+		return nil
+	}
+	resizing, gen := make(chan struct{}), t.gen
+	t.resizing = resizing
+	close(t.stop)
+	t.mu.Unlock()
+
+	// Draining the lanes without the lock, which submissions need.
+	gen.Wait()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resizing = nil
+	close(resizing)
+	select {
+	case <-t.quit:
+		return ErrClosed
+	default:
+	}
+	t.start(n)
+	return nil
+}
+
+// run calls the Work of the job, recovering from a panic.
+func (t *Task) run(j job) {
+	atomic.AddInt64(&t.queueWait, int64(time.Since(j.submitted)))
+	atomic.AddInt64(&t.busy, 1)
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddInt64(&t.panics, 1)
+			t.onPanic(j.worker, errors.Errorf("worker panicked: %v\n%s", r, debug.Stack()))
+		}
+		atomic.AddInt64(&t.busyTime, int64(time.Since(start)))
+		atomic.AddInt64(&t.busy, -1)
+		atomic.AddInt64(&t.completed, 1)
+	}()
+	ctx := t.ctx
+	if t.jobTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.jobTimeout)
+		defer cancel()
+	}
+	j.worker.Work(ctx)
 }
 
 // Shutdown waits for all the goroutines to shutdown.
 func (t *Task) Shutdown() {
-	close(t.work)
+	t.closeOnce.Do(func() {
+		// Not while resizing, which could start new goroutines.
+		t.mu.Lock()
+		close(t.quit)
+		t.mu.Unlock()
+	})
 	t.wg.Wait()
 }
 
-// Do submits work to the pool.
+// ShutdownContext waits for all the goroutines to shutdown, like
+// Shutdown, or for the context to be done, whichever comes first.
+// It returns the context error if the work was not drained in time.
+func (t *Task) ShutdownContext(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		t.Shutdown()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Do submits work to the pool. It returns without doing anything if
+// the pool is closed.
 func (t *Task) Do(w Worker) {
-	t.work <- w
+	t.DoContext(context.Background(), w)
+}
+
+// DoContext submits work to the pool, waiting for a goroutine to pick
+// it up. It returns the context error if the context is done first,
+// or ErrClosed if the pool is closed.
+func (t *Task) DoContext(ctx context.Context, w Worker) error {
+	// Any goroutine can take the work, so it needs no lock: while
+	// resizing, it waits for the next generation to be started.
+	j := job{worker: w, submitted: time.Now()}
+	select {
+	case t.work <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.quit:
+		return ErrClosed
+	case <-t.ctx.Done():
+		return ErrClosed
+	}
+}
+
+// DoKey submits work to the lane the key hashes to. It returns without
+// doing anything if the pool is closed.
+func (t *Task) DoKey(key string, w Worker) {
+	t.DoKeyContext(context.Background(), key, w)
+}
+
+// DoKeyContext submits work to the lane the key hashes to, waiting for
+// room in the lane. It returns the context error if the context is
+// done first, or ErrClosed if the pool is closed.
+func (t *Task) DoKeyContext(ctx context.Context, key string, w Worker) error {
+	for {
+		t.mu.RLock()
+		resizing := t.resizing
+		if resizing == nil {
+			break
+		}
+		t.mu.RUnlock()
+		select {
+		case <-resizing:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.quit:
+			return ErrClosed
+		case <-t.ctx.Done():
+			return ErrClosed
+		}
+	}
+	defer t.mu.RUnlock()
+	// A buffered lane would take the work even with nobody left to do it.
+	select {
+	case <-t.quit:
+		return ErrClosed
+	case <-t.ctx.Done():
+		return ErrClosed
+	default:
+	}
+	j := job{worker: w, submitted: time.Now()}
+	select {
+	case t.lanes[t.lane(key)] <- j:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.quit:
+		return ErrClosed
+	case <-t.ctx.Done():
+		return ErrClosed
+	}
+}
+
+// lane returns the index of the lane of the key. It must be called
+// with the lock held.
+func (t *Task) lane(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(t.lanes)))
+}
+
+// Metrics returns the current metrics of the pool.
+func (t *Task) Metrics() Metrics {
+	m := Metrics{
+		Workers:   int(atomic.LoadInt64(&t.workers)),
+		Busy:      int(atomic.LoadInt64(&t.busy)),
+		BusyTime:  time.Duration(atomic.LoadInt64(&t.busyTime)),
+		Completed: atomic.LoadInt64(&t.completed),
+		Panics:    atomic.LoadInt64(&t.panics),
+	}
+	if m.Completed > 0 || m.Busy > 0 {
+		m.QueueWait = time.Duration(atomic.LoadInt64(&t.queueWait) / (m.Completed + int64(m.Busy)))
+	}
+	return m
 }
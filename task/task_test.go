@@ -5,10 +5,12 @@ package task
 
 import (
 	"context"
+	"errors"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -46,3 +48,341 @@ func TestWorker(t *testing.T) {
 	wg.Wait()
 	require.GreaterOrEqual(t, int32(100), count)
 }
+
+type blockingWorker struct {
+	release chan struct{}
+}
+
+func (w *blockingWorker) Work(ctx context.Context) {
+	<-w.release
+}
+
+func TestShutdownContext(t *testing.T) {
+	testCases := []struct {
+		name          string
+		release       bool
+		expectedError error
+	}{
+		{
+			name:    "drained",
+			release: true,
+		},
+		{
+			name:          "deadline exceeded",
+			expectedError: context.DeadlineExceeded,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := &blockingWorker{release: make(chan struct{})}
+			if tc.release {
+				close(w.release)
+			}
+			task := New(context.TODO(), 1)
+			task.Do(w)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			err := task.ShutdownContext(ctx)
+			require.Equal(t, tc.expectedError, err)
+			if !tc.release {
+				close(w.release)
+			}
+		})
+	}
+}
+
+type panickingWorker struct{}
+
+func (w *panickingWorker) Work(ctx context.Context) {
+	panic("random panic")
+}
+
+type deadlineWorker struct {
+	deadline chan bool
+}
+
+func (w *deadlineWorker) Work(ctx context.Context) {
+	_, ok := ctx.Deadline()
+	w.deadline <- ok
+}
+
+func TestDoContext(t *testing.T) {
+	testCases := []struct {
+		name          string
+		setup         func(t *testing.T) (*Task, context.Context)
+		expectedError error
+	}{
+		{
+			name: "happy path",
+			setup: func(t *testing.T) (*Task, context.Context) {
+				return New(context.TODO(), 1), context.TODO()
+			},
+		},
+		{
+			name: "context done",
+			setup: func(t *testing.T) (*Task, context.Context) {
+				task := New(context.TODO(), 1)
+				w := &blockingWorker{release: make(chan struct{})}
+				t.Cleanup(func() { close(w.release) })
+				require.NoError(t, task.DoContext(context.TODO(), w))
+				ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+				t.Cleanup(cancel)
+				return task, ctx
+			},
+			expectedError: context.DeadlineExceeded,
+		},
+		{
+			name: "pool shut down",
+			setup: func(t *testing.T) (*Task, context.Context) {
+				task := New(context.TODO(), 1)
+				task.Shutdown()
+				return task, context.TODO()
+			},
+			expectedError: ErrClosed,
+		},
+		{
+			name: "pool context done",
+			setup: func(t *testing.T) (*Task, context.Context) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return New(ctx, 1), context.TODO()
+			},
+			expectedError: ErrClosed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task, ctx := tc.setup(t)
+			var count int32
+			err := task.DoContext(ctx, &worker{&count})
+			require.Equal(t, tc.expectedError, err)
+		})
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	panics := make(chan error, 1)
+	task := New(context.TODO(), 1, WithPanicHandler(func(w Worker, err error) {
+		panics <- err
+	}))
+	require.NoError(t, task.DoContext(context.TODO(), &panickingWorker{}))
+	err := <-panics
+	require.Contains(t, err.Error(), "worker panicked: random panic")
+	var count int32
+	require.NoError(t, task.DoContext(context.TODO(), &worker{&count}))
+	task.Shutdown()
+	require.Equal(t, int32(1), count)
+	m := task.Metrics()
+	require.Equal(t, int64(2), m.Completed)
+	require.Equal(t, int64(1), m.Panics)
+	require.Equal(t, 0, m.Busy)
+	require.Equal(t, 1, m.Workers)
+}
+
+func TestJobTimeout(t *testing.T) {
+	testCases := []struct {
+		name             string
+		opts             []Option
+		expectedDeadline bool
+	}{
+		{
+			name: "no timeout",
+		},
+		{
+			name:             "with timeout",
+			opts:             []Option{WithJobTimeout(time.Minute)},
+			expectedDeadline: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := New(context.TODO(), 1, tc.opts...)
+			w := &deadlineWorker{deadline: make(chan bool, 1)}
+			require.NoError(t, task.DoContext(context.TODO(), w))
+			require.Equal(t, tc.expectedDeadline, <-w.deadline)
+			task.Shutdown()
+		})
+	}
+}
+
+type orderedWorker struct {
+	mu    *sync.Mutex
+	seen  map[string][]int
+	key   string
+	index int
+}
+
+func (w *orderedWorker) Work(ctx context.Context) {
+	// Gives the other goroutines the chance to jump ahead.
+	time.Sleep(time.Duration(w.index%3) * time.Millisecond)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seen[w.key] = append(w.seen[w.key], w.index)
+}
+
+func TestDoKey(t *testing.T) {
+	testCases := []struct {
+		name       string
+		laneBuffer int
+	}{
+		{
+			name: "unbuffered lanes",
+		},
+		{
+			name:       "buffered lanes",
+			laneBuffer: 10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			const (
+				keys       = 5
+				jobsPerKey = 20
+			)
+			task := New(context.TODO(), 4, WithLaneBuffer(tc.laneBuffer))
+			var mu sync.Mutex
+			seen := make(map[string][]int)
+			for i := 0; i < jobsPerKey; i++ {
+				for k := 0; k < keys; k++ {
+					key := string(rune('a' + k))
+					w := &orderedWorker{mu: &mu, seen: seen, key: key, index: i}
+					require.NoError(t, task.DoKeyContext(context.TODO(), key, w))
+				}
+			}
+			task.Shutdown()
+			require.Len(t, seen, keys)
+			for key, indexes := range seen {
+				require.Len(t, indexes, jobsPerKey, key)
+				for i, index := range indexes {
+					require.Equal(t, i, index, key)
+				}
+			}
+			require.Equal(t, int64(keys*jobsPerKey), task.Metrics().Completed)
+		})
+	}
+}
+
+func TestDoKeyClosed(t *testing.T) {
+	task := New(context.TODO(), 2, WithLaneBuffer(10))
+	require.Equal(t, task.lane("account"), task.lane("account"))
+	task.Shutdown()
+	var count int32
+	require.Equal(t, ErrClosed, task.DoKeyContext(context.TODO(), "account", &worker{&count}))
+}
+
+func TestResize(t *testing.T) {
+	testCases := []struct {
+		name            string
+		size            int
+		shutdown        bool
+		expectedWorkers int
+		expectedError   error
+	}{
+		{
+			name:            "grow",
+			size:            8,
+			expectedWorkers: 8,
+		},
+		{
+			name:            "shrink",
+			size:            1,
+			expectedWorkers: 1,
+		},
+		{
+			name:            "same size",
+			size:            2,
+			expectedWorkers: 2,
+		},
+		{
+			name:            "invalid size",
+			size:            0,
+			expectedWorkers: 2,
+			expectedError:   errors.New("invalid pool size 0"),
+		},
+		{
+			name:            "shut down",
+			size:            4,
+			shutdown:        true,
+			expectedWorkers: 2,
+			expectedError:   ErrClosed,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			task := New(context.TODO(), 2, WithLaneBuffer(10))
+			var mu sync.Mutex
+			seen := make(map[string][]int)
+			submit := func(from, to int) {
+				for i := from; i < to; i++ {
+					for _, key := range []string{"a", "b", "c"} {
+						w := &orderedWorker{mu: &mu, seen: seen, key: key, index: i}
+						require.NoError(t, task.DoKeyContext(context.TODO(), key, w))
+					}
+				}
+			}
+			if tc.shutdown {
+				task.Shutdown()
+			} else {
+				submit(0, 10)
+			}
+			err := task.Resize(tc.size)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+			}
+			require.Equal(t, tc.expectedWorkers, task.Metrics().Workers)
+			if tc.shutdown {
+				return
+			}
+			submit(10, 20)
+			task.Shutdown()
+			for key, indexes := range seen {
+				require.Len(t, indexes, 20, key)
+				for i, index := range indexes {
+					require.Equal(t, i, index, key)
+				}
+			}
+		})
+	}
+}
+
+func TestDoKeyContextWhileResizing(t *testing.T) {
+	task := New(context.TODO(), 2, WithLaneBuffer(10))
+	release := make(chan struct{})
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, task.DoKeyContext(context.TODO(), key, &blockingWorker{release}))
+	}
+	resized := make(chan error, 1)
+	go func() {
+		resized <- task.Resize(4)
+	}()
+	require.Eventually(t, func() bool {
+		task.mu.RLock()
+		defer task.mu.RUnlock()
+		return task.resizing != nil
+	}, time.Second, time.Millisecond)
+
+	// Submitting does not wait for the lanes to be drained.
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+	var count int32
+	require.Equal(t, context.DeadlineExceeded, task.DoKeyContext(ctx, "a", &worker{&count}))
+
+	// Once drained, the pending submissions go to the new lanes.
+	submitted := make(chan error, 1)
+	go func() {
+		submitted <- task.DoKeyContext(context.TODO(), "a", &worker{&count})
+	}()
+	close(release)
+	require.NoError(t, <-resized)
+	require.NoError(t, <-submitted)
+	require.Equal(t, 4, task.Metrics().Workers)
+	task.Shutdown()
+	require.Equal(t, int32(1), count)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+)
+
+// Dispatch keys, telling which messages are processed in order.
+const (
+	// AccountDispatchKey keeps the order of the transactions of every account.
+	AccountDispatchKey = "account"
+	// PartitionDispatchKey keeps the order of the messages of every partition.
+	PartitionDispatchKey = "partition"
+	// NoDispatchKey processes the messages in any order.
+	NoDispatchKey = "none"
+)
+
+// KeyFunc returns the key a message is dispatched with, or false if
+// it can be processed in any order.
+type KeyFunc func(msg *kafka.Message) (string, bool)
+
+// DispatchKeyFunc returns the KeyFunc of the given dispatch key.
+func DispatchKeyFunc(by string) (KeyFunc, error) {
+	switch by {
+	case AccountDispatchKey:
+		return accountKey, nil
+	case PartitionDispatchKey:
+		return partitionKey, nil
+	case NoDispatchKey:
+		return func(msg *kafka.Message) (string, bool) { return "", false }, nil
+	}
+	return nil, errors.Errorf("unknown dispatch key %q: expected %s, %s or %s", by, AccountDispatchKey, PartitionDispatchKey, NoDispatchKey)
+}
+
+// accountKey keys the message by the account number of its transaction.
+// A message that cannot be read is keyed by its partition instead.
+func accountKey(msg *kafka.Message) (string, bool) {
+	var t struct {
+		AccountNumber *json.Number `json:"account_number"`
+	}
+	if err := json.Unmarshal(msg.Value, &t); err != nil || t.AccountNumber == nil {
+		return partitionKey(msg)
+	}
+	return "account:" + t.AccountNumber.String(), true
+}
+
+// partitionKey keys the message by its partition.
+func partitionKey(msg *kafka.Message) (string, bool) {
+	var topic string
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+	return fmt.Sprintf("partition:%s/%d", topic, msg.TopicPartition.Partition), true
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchKeyFunc(t *testing.T) {
+	topic := "transactions"
+	testCases := []struct {
+		name          string
+		by            string
+		msg           string
+		expectedKey   string
+		expectedKeyed bool
+		expectedError error
+	}{
+		{
+			name:          "account",
+			by:            AccountDispatchKey,
+			msg:           `{"transaction_id":5699757367,"account_number":215489034,"transaction_amount":1308.58}`,
+			expectedKey:   "account:215489034",
+			expectedKeyed: true,
+		},
+		{
+			name:          "account of invalid message",
+			by:            AccountDispatchKey,
+			msg:           "blabla",
+			expectedKey:   "partition:transactions/3",
+			expectedKeyed: true,
+		},
+		{
+			name:          "account of message without account number",
+			by:            AccountDispatchKey,
+			msg:           `{"transaction_id":5699757367}`,
+			expectedKey:   "partition:transactions/3",
+			expectedKeyed: true,
+		},
+		{
+			name:          "partition",
+			by:            PartitionDispatchKey,
+			msg:           `{"account_number":215489034}`,
+			expectedKey:   "partition:transactions/3",
+			expectedKeyed: true,
+		},
+		{
+			name: "none",
+			by:   NoDispatchKey,
+			msg:  `{"account_number":215489034}`,
+		},
+		{
+			name:          "unknown",
+			by:            "random",
+			expectedError: errors.New(`unknown dispatch key "random": expected account, partition or none`),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			keyFunc, err := DispatchKeyFunc(tc.by)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				key, keyed := keyFunc(&kafka.Message{
+					TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 3},
+					Value:          []byte(tc.msg),
+				})
+				require.Equal(t, tc.expectedKey, key)
+				require.Equal(t, tc.expectedKeyed, keyed)
+			}
+		})
+	}
+}
@@ -9,9 +9,15 @@ import (
 	"log"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/breaker"
+	"github.com/tiagomelo/realtime-data-kafka/deadletter"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction/models"
+	"github.com/tiagomelo/realtime-data-kafka/offset"
+	"github.com/tiagomelo/realtime-data-kafka/retry"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
 	"github.com/tiagomelo/realtime-data-kafka/stats"
 	"github.com/tiagomelo/realtime-data-kafka/transaction"
 )
@@ -21,21 +27,48 @@ var (
 	printToLog = func(log *log.Logger, v ...any) {
 		log.Println(v...)
 	}
-	stInsert = func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) error {
+	stInsert = func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
 		return suspicioustransaction.Insert(ctx, db, sp)
 	}
+	dlqPublish = func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+		return p.Publish(msg, stage, err)
+	}
 )
 
+// ErrShutdown is the cause the context of the workers is canceled with
+// when the consumer shuts down without waiting for them.
+var ErrShutdown = errors.New("consumer is shutting down")
+
 // Worker represents a Kafka consumer worker.
 type Worker struct {
 	Msg   *kafka.Message
 	Stats *stats.KafkaConsumerStats
 	Db    *mongodb.MongoDb
+	Rules *rules.RuleSet
+	// Offsets, if not nil, is told when the processing of Msg completed,
+	// so its offset can be committed.
+	Offsets *offset.Tracker
+	// DeadLetter, if not nil, receives the messages that fail to be
+	// processed. Publishing to it is retried according to Retry.
+	DeadLetter *deadletter.Publisher
+	// OnStuck, if not nil, is called when Msg failed and could not be
+	// dead-lettered either, so its offset, and the ones after it in its
+	// partition, cannot be committed until it is consumed again.
+	OnStuck func(tp kafka.TopicPartition, err error)
+	// Retry is the retry policy of MongoDB inserts.
+	Retry retry.Policy
+	// Breaker, if not nil, is the circuit breaker of MongoDB inserts.
+	Breaker *breaker.Breaker
+	// Batch, if not nil, writes the suspicious transactions in bulk.
+	// Msg is then only completed once its transaction is written.
+	Batch *suspicioustransaction.BatchWriter
 	Log   *log.Logger
 }
 
-// insertSuspiciousTransaction inserts a suspicious transaction into MongoDB.
-func (c *Worker) insertSuspiciousTransaction(ctx context.Context, sp *transaction.Transaction) error {
+// insertSuspiciousTransaction inserts a suspicious transaction into MongoDB,
+// through the batch writer if any, and calls done with the outcome and
+// the context it was inserted under.
+func (c *Worker) insertSuspiciousTransaction(ctx context.Context, sp *transaction.Transaction, verdict rules.Verdict, done func(ctx context.Context, inserted bool, err error)) {
 	spDb := &models.SuspiciousTransaction{
 		TransactionId:     sp.TransactionID,
 		AccountNumber:     sp.AccountNumber,
@@ -43,25 +76,166 @@ func (c *Worker) insertSuspiciousTransaction(ctx context.Context, sp *transactio
 		TransactionAmount: sp.TransactionAmount,
 		TransactionTime:   sp.TransactionTime,
 		Location:          sp.Location,
+		Findings:          make([]models.Finding, len(verdict.Findings)),
+	}
+	for i, f := range verdict.Findings {
+		spDb.Findings[i] = models.Finding{Rule: f.Rule, Detail: f.Detail, Attributes: f.Attributes}
+	}
+	if verdict.Score != nil {
+		spDb.Score = verdict.Score.Value
+		for _, f := range verdict.Score.Factors {
+			spDb.ScoreFactors = append(spDb.ScoreFactors, models.Factor{
+				Signal:       f.Signal,
+				Value:        f.Value,
+				Weight:       f.Weight,
+				Contribution: f.Contribution,
+			})
+		}
+	}
+	if c.Batch != nil {
+		c.Batch.Add(spDb, done)
+		return
+	}
+	inserted, err := c.persist(ctx, spDb)
+	done(ctx, inserted, err)
+}
+
+// persist inserts the suspicious transaction into MongoDB, unless it
+// is already stored. It returns whether it was inserted.
+func (c *Worker) persist(ctx context.Context, sp *models.SuspiciousTransaction) (bool, error) {
+	var inserted bool
+	err := guarded(ctx, c.Retry, c.Breaker, c.Stats, c.Log, fmt.Sprintf("insert of suspicious transaction %d", sp.TransactionId), func(ctx context.Context) error {
+		var err error
+		inserted, err = stInsert(ctx, c.Db, sp)
+		return err
+	})
+	return inserted, err
+}
+
+// BulkWriteGuard returns a wrapper of the bulk writes of what, like
+// the ones of a BatchWriter, that retries them according to the retry
+// policy and makes them go through the circuit breaker, if any.
+func BulkWriteGuard(what string, policy retry.Policy, b *breaker.Breaker, stats *stats.KafkaConsumerStats, log *log.Logger) func(ctx context.Context, write func(ctx context.Context) error) error {
+	return func(ctx context.Context, write func(ctx context.Context) error) error {
+		return guarded(ctx, policy, b, stats, log, "bulk write of "+what, write)
 	}
-	return stInsert(ctx, c.Db, spDb)
+}
+
+// guarded calls fn, which writes to MongoDB, retrying according to the
+// retry policy and going through the circuit breaker, if any, which
+// holds the attempts back while MongoDB is down. An attempt cut short
+// by the context tells nothing about MongoDB, so the breaker does not
+// record it.
+func guarded(ctx context.Context, policy retry.Policy, b *breaker.Breaker, stats *stats.KafkaConsumerStats, log *log.Logger, what string, fn func(ctx context.Context) error) error {
+	return retry.Do(ctx, policy, func(ctx context.Context) error {
+		if b == nil {
+			return fn(ctx)
+		}
+		call, err := b.Wait(ctx)
+		if err != nil {
+			return err
+		}
+		err = fn(ctx)
+		if err != nil && (ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			b.Release(call)
+			return err
+		}
+		b.Record(call, err)
+		return err
+	}, func(retry int, err error) {
+		stats.IncrTotalInsertRetries()
+		printToLog(log, fmt.Sprintf("retrying %s (retry %d): %v", what, retry, err))
+	})
 }
 
 // Work processes the Kafka message and performs the necessary operations.
+// A message that fails to be processed is published to the dead-letter
+// topic, if any. Its offset is not committed if that fails too, or if
+// it failed because the context was canceled with ErrShutdown, so it
+// is consumed again after a restart.
 func (c *Worker) Work(ctx context.Context) {
 	c.Stats.IncrTotalTransactions()
+	c.process(ctx, c.complete)
+}
+
+// complete marks the message as processed, once it failed at the given
+// stage with err, or succeeded if err is nil. A message written in bulk
+// is completed under the context of the batch writer rather than the
+// one of its job, whose timeout may be over by then.
+func (c *Worker) complete(ctx context.Context, stage string, err error) {
+	if err != nil && (errors.Is(err, ErrShutdown) || errors.Is(context.Cause(ctx), ErrShutdown)) {
+		printToLog(c.Log, fmt.Sprintf("leaving message at %v to be consumed again: %v", c.Msg.TopicPartition, err))
+		return
+	}
+	if err != nil && !c.deadLetter(ctx, stage, err) {
+		return
+	}
+	if c.Offsets != nil {
+		c.Offsets.Done(c.Msg.TopicPartition)
+	}
+}
+
+// Fail completes the message as failed at the panic stage, when its
+// Work panicked with err.
+func (c *Worker) Fail(err error) {
+	c.complete(context.Background(), deadletter.PanicStage, err)
+}
+
+// process evaluates the transaction of the message and saves it if it
+// is suspicious. It calls complete once done, which may be after it
+// returns if the transaction is written in bulk.
+func (c *Worker) process(ctx context.Context, complete func(ctx context.Context, stage string, err error)) {
 	transaction, err := transaction.New(string(c.Msg.Value))
 	if err != nil {
 		c.Stats.IncrTotalUnmarshallingMsgErrors()
 		printToLog(c.Log, fmt.Errorf("checking if transaction is suspicious: %v", err))
+		complete(ctx, deadletter.UnmarshalStage, err)
+		return
+	}
+	verdict := c.Rules.AssessContext(ctx, transaction)
+	if !verdict.Suspicious() {
+		complete(ctx, "", nil)
 		return
 	}
-	if transaction.IsSuspicious() {
-		c.Stats.IncrTotalSuspiciousTransactions()
-		printToLog(c.Log, "suspicious transaction: %+v\n", transaction)
-		if err := c.insertSuspiciousTransaction(ctx, transaction); err != nil {
+	c.Stats.IncrTotalSuspiciousTransactions()
+	printToLog(c.Log, fmt.Sprintf("suspicious transaction: %+v verdict: %+v", transaction, verdict))
+	c.insertSuspiciousTransaction(ctx, transaction, verdict, func(ctx context.Context, inserted bool, err error) {
+		if err != nil {
 			c.Stats.IncrTotalInsertSuspiciousTransactionErrors()
-			printToLog(c.Log, "error when inserting suspicious transaction in mongodb %+v: %v\n", transaction, err)
+			printToLog(c.Log, fmt.Sprintf("error when inserting suspicious transaction in mongodb %+v: %v", transaction, err))
+			complete(ctx, deadletter.PersistStage, err)
+			return
+		}
+		// A redelivered message, or a message published twice.
+		if !inserted {
+			c.Stats.IncrTotalDuplicateTransactions()
+			printToLog(c.Log, fmt.Sprintf("suspicious transaction %d is already stored", transaction.TransactionID))
+		}
+		complete(ctx, "", nil)
+	})
+}
+
+// deadLetter publishes the message to the dead-letter topic, if any,
+// retrying according to the retry policy. It returns whether the
+// message can be considered handled; if not, OnStuck is called.
+func (c *Worker) deadLetter(ctx context.Context, stage string, cause error) bool {
+	if c.DeadLetter == nil {
+		return true
+	}
+	err := retry.Do(ctx, c.Retry, func(ctx context.Context) error {
+		return dlqPublish(c.DeadLetter, c.Msg, stage, cause)
+	}, func(retry int, err error) {
+		c.Stats.IncrTotalDeadLetterErrors()
+		printToLog(c.Log, fmt.Sprintf("retrying to publish message at %v to dead-letter topic (retry %d): %v", c.Msg.TopicPartition, retry, err))
+	})
+	if err != nil {
+		c.Stats.IncrTotalDeadLetterErrors()
+		printToLog(c.Log, fmt.Sprintf("error when publishing message at %v to dead-letter topic: %v", c.Msg.TopicPartition, err))
+		if c.OnStuck != nil {
+			c.OnStuck(c.Msg.TopicPartition, err)
 		}
+		return false
 	}
+	c.Stats.IncrTotalDeadLetteredMessages()
+	return true
 }
@@ -6,16 +6,25 @@ package kafka
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/breaker"
+	"github.com/tiagomelo/realtime-data-kafka/deadletter"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb"
+	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction"
 	"github.com/tiagomelo/realtime-data-kafka/mongodb/suspicioustransaction/models"
+	"github.com/tiagomelo/realtime-data-kafka/offset"
+	"github.com/tiagomelo/realtime-data-kafka/retry"
+	"github.com/tiagomelo/realtime-data-kafka/rules"
 	"github.com/tiagomelo/realtime-data-kafka/stats"
 	"github.com/tiagomelo/realtime-data-kafka/stringify"
+	"github.com/tiagomelo/realtime-data-kafka/task"
 )
 
 func TestWork(t *testing.T) {
@@ -23,11 +32,12 @@ func TestWork(t *testing.T) {
 		name                                           string
 		msg                                            string
 		mockPrintToLog                                 func(log *log.Logger, v ...any)
-		mockStInsert                                   func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) error
+		mockStInsert                                   func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error)
 		expectedTotalTransactions                      int64
 		expectedTotalUnmarshallingMsgErrors            int64
 		expectedTotalSuspiciousTransactions            int64
 		expectedTotalInsertSuspiciousTransactionErrors int64
+		expectedTotalDuplicateTransactions             int64
 	}{
 		{
 			name:                      "no suspicious transactions",
@@ -48,11 +58,26 @@ func TestWork(t *testing.T) {
 				}
 				require.True(t, contains)
 			},
-			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) error {
-				return nil
+			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				expectedFindings := []models.Finding{
+					{Rule: "amount_over_10000", Detail: "amount 11308.58 is greater than 10000.00"},
+				}
+				require.Equal(t, expectedFindings, sp.Findings)
+				return true, nil
+			},
+			expectedTotalTransactions:           int64(1),
+			expectedTotalSuspiciousTransactions: int64(1),
+		},
+		{
+			name:           "suspicious transaction already stored",
+			msg:            `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`,
+			mockPrintToLog: func(log *log.Logger, v ...any) {},
+			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				return false, nil
 			},
 			expectedTotalTransactions:           int64(1),
 			expectedTotalSuspiciousTransactions: int64(1),
+			expectedTotalDuplicateTransactions:  int64(1),
 		},
 		{
 			name: "invalid message",
@@ -80,8 +105,8 @@ func TestWork(t *testing.T) {
 					}
 				}
 			},
-			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) error {
-				return errors.New("random error")
+			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				return false, errors.New("random error")
 			},
 			expectedTotalTransactions:                      int64(1),
 			expectedTotalSuspiciousTransactions:            int64(1),
@@ -93,16 +118,483 @@ func TestWork(t *testing.T) {
 			stats := new(stats.KafkaConsumerStats)
 			printToLog = tc.mockPrintToLog
 			stInsert = tc.mockStInsert
+			topic := "transactions"
+			tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+			offsets := offset.NewTracker()
+			offsets.Track(tp)
+			worker := &Worker{
+				Stats:   stats,
+				Rules:   rules.Default(),
+				Offsets: offsets,
+				Msg: &kafka.Message{
+					TopicPartition: tp,
+					Value:          []byte(tc.msg),
+				},
+			}
+			worker.Work(context.TODO())
+			tp.Offset++
+			require.Equal(t, []kafka.TopicPartition{tp}, offsets.Committable())
+			require.Equal(t, tc.expectedTotalTransactions, stats.TotalTransactions())
+			require.Equal(t, tc.expectedTotalSuspiciousTransactions, stats.TotalSuspiciousTransactions())
+			require.Equal(t, tc.expectedTotalInsertSuspiciousTransactionErrors, stats.TotalInsertSuspiciousTransactionErrors())
+			require.Equal(t, tc.expectedTotalDuplicateTransactions, stats.TotalDuplicateTransactions())
+		})
+	}
+}
+
+func TestWorkWithScoring(t *testing.T) {
+	ruleSet, err := rules.Parse([]byte(`{
+		"rules": [{"name":"big","kind":"amount","params":{"greater_than":10000}}],
+		"scoring": {"cutoff": 50, "weights": {"amount": 1, "rules": 1}}
+	}`))
+	require.NoError(t, err)
+	testCases := []struct {
+		name                                string
+		msg                                 string
+		expectedTotalSuspiciousTransactions int64
+	}{
+		{
+			name: "score below cutoff",
+			msg:  `{"transaction_id":1,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":1308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`,
+		},
+		{
+			name:                                "score above cutoff",
+			msg:                                 `{"transaction_id":2,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`,
+			expectedTotalSuspiciousTransactions: int64(1),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := new(stats.KafkaConsumerStats)
+			printToLog = func(log *log.Logger, v ...any) {}
+			stInsert = func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				require.Equal(t, 78.27, sp.Score)
+				require.Equal(t, []models.Factor{
+					{Signal: "rules", Value: 1, Weight: 1, Contribution: 50},
+					{Signal: "amount", Value: 0.57, Weight: 1, Contribution: 28.27},
+				}, sp.ScoreFactors)
+				return true, nil
+			}
 			worker := &Worker{
 				Stats: stats,
+				Rules: ruleSet,
 				Msg: &kafka.Message{
 					Value: []byte(tc.msg),
 				},
 			}
 			worker.Work(context.TODO())
-			require.Equal(t, tc.expectedTotalTransactions, stats.TotalTransactions())
 			require.Equal(t, tc.expectedTotalSuspiciousTransactions, stats.TotalSuspiciousTransactions())
+		})
+	}
+}
+
+func TestWorkDeadLetter(t *testing.T) {
+	const suspicious = `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`
+	testCases := []struct {
+		name                      string
+		msg                       string
+		mockStInsert              func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error)
+		mockDlqPublish            func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error
+		expectedDeadLettered      int64
+		expectedDeadLetterErrors  int64
+		expectedOffsetCommittable bool
+	}{
+		{
+			name: "invalid message",
+			msg:  "blabla",
+			mockDlqPublish: func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				require.Equal(t, deadletter.UnmarshalStage, stage)
+				require.Equal(t, "unmarshalling transaction: invalid character 'b' looking for beginning of value", err.Error())
+				return nil
+			},
+			expectedDeadLettered:      1,
+			expectedOffsetCommittable: true,
+		},
+		{
+			name: "error when saving suspicious transaction to db",
+			msg:  suspicious,
+			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				return false, errors.New("random error")
+			},
+			mockDlqPublish: func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				require.Equal(t, deadletter.PersistStage, stage)
+				require.Equal(t, "random error", err.Error())
+				return nil
+			},
+			expectedDeadLettered:      1,
+			expectedOffsetCommittable: true,
+		},
+		{
+			name: "error when publishing to dead-letter topic",
+			msg:  "blabla",
+			mockDlqPublish: func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				return errors.New("random error")
+			},
+			expectedDeadLetterErrors: 1,
+		},
+		{
+			name: "no failure",
+			msg:  suspicious,
+			mockStInsert: func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				return true, nil
+			},
+			mockDlqPublish: func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				t.Fatal("unexpected dead-letter")
+				return nil
+			},
+			expectedOffsetCommittable: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := new(stats.KafkaConsumerStats)
+			printToLog = func(log *log.Logger, v ...any) {}
+			stInsert = tc.mockStInsert
+			dlqPublish = tc.mockDlqPublish
+			topic := "transactions"
+			tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+			offsets := offset.NewTracker()
+			offsets.Track(tp)
+			worker := &Worker{
+				Stats:      stats,
+				Rules:      rules.Default(),
+				Offsets:    offsets,
+				DeadLetter: &deadletter.Publisher{Topic: "transactions-dlq"},
+				Msg: &kafka.Message{
+					TopicPartition: tp,
+					Value:          []byte(tc.msg),
+				},
+			}
+			worker.Work(context.TODO())
+			require.Equal(t, tc.expectedDeadLettered, stats.TotalDeadLetteredMessages())
+			require.Equal(t, tc.expectedDeadLetterErrors, stats.TotalDeadLetterErrors())
+			require.Equal(t, tc.expectedOffsetCommittable, len(offsets.Committable()) == 1)
+		})
+	}
+}
+
+func TestWorkDeadLetterRetry(t *testing.T) {
+	testCases := []struct {
+		name                      string
+		failures                  int
+		expectedDeadLettered      int64
+		expectedDeadLetterErrors  int64
+		expectedStuck             bool
+		expectedOffsetCommittable bool
+	}{
+		{
+			name:                      "published after retrying",
+			failures:                  2,
+			expectedDeadLettered:      1,
+			expectedDeadLetterErrors:  2,
+			expectedOffsetCommittable: true,
+		},
+		{
+			name:                     "attempts exhausted",
+			failures:                 3,
+			expectedDeadLetterErrors: 3,
+			expectedStuck:            true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := new(stats.KafkaConsumerStats)
+			printToLog = func(log *log.Logger, v ...any) {}
+			attempts := 0
+			dlqPublish = func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				attempts++
+				if attempts <= tc.failures {
+					return errors.New("random error")
+				}
+				return nil
+			}
+			topic := "transactions"
+			tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+			offsets := offset.NewTracker()
+			offsets.Track(tp)
+			var stuck []string
+			worker := &Worker{
+				Stats:      stats,
+				Rules:      rules.Default(),
+				Offsets:    offsets,
+				DeadLetter: &deadletter.Publisher{Topic: "transactions-dlq"},
+				Retry:      retry.Policy{MaxAttempts: 3},
+				OnStuck: func(tp kafka.TopicPartition, err error) {
+					stuck = append(stuck, fmt.Sprintf("%v: %v", tp, err))
+				},
+				Msg: &kafka.Message{
+					TopicPartition: tp,
+					Value:          []byte("blabla"),
+				},
+			}
+			worker.Work(context.TODO())
+			require.Equal(t, tc.expectedDeadLettered, stats.TotalDeadLetteredMessages())
+			require.Equal(t, tc.expectedDeadLetterErrors, stats.TotalDeadLetterErrors())
+			if tc.expectedStuck {
+				require.Equal(t, []string{"transactions[0]@7: random error"}, stuck)
+			} else {
+				require.Empty(t, stuck)
+			}
+			require.Equal(t, tc.expectedOffsetCommittable, len(offsets.Committable()) == 1)
+		})
+	}
+}
+
+func TestWorkRetry(t *testing.T) {
+	const suspicious = `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`
+	testCases := []struct {
+		name                                           string
+		failures                                       int
+		expectedAttempts                               int
+		expectedTotalInsertRetries                     int64
+		expectedTotalInsertSuspiciousTransactionErrors int64
+		expectedBreakerState                           breaker.State
+	}{
+		{
+			name:                       "succeeds after retries",
+			failures:                   2,
+			expectedAttempts:           3,
+			expectedTotalInsertRetries: 2,
+			expectedBreakerState:       breaker.Closed,
+		},
+		{
+			name:                       "attempts exhausted",
+			failures:                   5,
+			expectedAttempts:           3,
+			expectedTotalInsertRetries: 2,
+			expectedTotalInsertSuspiciousTransactionErrors: 1,
+			expectedBreakerState:                           breaker.Open,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := new(stats.KafkaConsumerStats)
+			printToLog = func(log *log.Logger, v ...any) {}
+			var attempts int
+			stInsert = func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				attempts++
+				if attempts <= tc.failures {
+					return false, errors.New("random error")
+				}
+				return true, nil
+			}
+			worker := &Worker{
+				Stats:   stats,
+				Rules:   rules.Default(),
+				Retry:   retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+				Breaker: breaker.New(3, time.Hour, nil),
+				Msg: &kafka.Message{
+					Value: []byte(suspicious),
+				},
+			}
+			worker.Work(context.TODO())
+			require.Equal(t, tc.expectedAttempts, attempts)
+			require.Equal(t, tc.expectedTotalInsertRetries, stats.TotalInsertRetries())
 			require.Equal(t, tc.expectedTotalInsertSuspiciousTransactionErrors, stats.TotalInsertSuspiciousTransactionErrors())
+			require.Equal(t, tc.expectedBreakerState, worker.Breaker.State())
 		})
 	}
 }
+
+func TestWorkBatch(t *testing.T) {
+	const suspicious = `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`
+	testCases := []struct {
+		name                                           string
+		mockBulkWrite                                  func(ctx context.Context, write func(ctx context.Context) error) error
+		mockDlqPublish                                 func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error
+		expectedTotalInsertSuspiciousTransactionErrors int64
+		expectedDeadLettered                           int64
+	}{
+		{
+			name: "written",
+			mockBulkWrite: func(ctx context.Context, write func(ctx context.Context) error) error {
+				return nil
+			},
+			mockDlqPublish: func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				t.Fatal("unexpected dead-letter")
+				return nil
+			},
+		},
+		{
+			name: "bulk write fails",
+			mockBulkWrite: func(ctx context.Context, write func(ctx context.Context) error) error {
+				return errors.New("random error")
+			},
+			mockDlqPublish: func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				require.Equal(t, deadletter.PersistStage, stage)
+				require.Equal(t, "bulk inserting 1 suspicious transactions: random error", err.Error())
+				return nil
+			},
+			expectedTotalInsertSuspiciousTransactionErrors: 1,
+			expectedDeadLettered:                           1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := new(stats.KafkaConsumerStats)
+			printToLog = func(log *log.Logger, v ...any) {}
+			stInsert = func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				t.Fatal("unexpected single insert")
+				return true, nil
+			}
+			dlqPublish = tc.mockDlqPublish
+			topic := "transactions"
+			tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+			offsets := offset.NewTracker()
+			offsets.Track(tp)
+			batch := suspicioustransaction.NewBatchWriter(new(mongodb.MongoDb), 100, time.Hour,
+				suspicioustransaction.WithBulkWriteWrapper(tc.mockBulkWrite))
+			worker := &Worker{
+				Stats:      stats,
+				Rules:      rules.Default(),
+				Offsets:    offsets,
+				DeadLetter: &deadletter.Publisher{Topic: "transactions-dlq"},
+				Batch:      batch,
+				Msg: &kafka.Message{
+					TopicPartition: tp,
+					Value:          []byte(suspicious),
+				},
+			}
+			worker.Work(context.TODO())
+			require.Empty(t, offsets.Committable())
+			batch.Flush(context.TODO())
+			require.Len(t, offsets.Committable(), 1)
+			require.Equal(t, tc.expectedTotalInsertSuspiciousTransactionErrors, stats.TotalInsertSuspiciousTransactionErrors())
+			require.Equal(t, tc.expectedDeadLettered, stats.TotalDeadLetteredMessages())
+		})
+	}
+}
+
+func TestWorkBatchJobTimeout(t *testing.T) {
+	const suspicious = `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`
+	stats := new(stats.KafkaConsumerStats)
+	printToLog = func(log *log.Logger, v ...any) {}
+	attempts := 0
+	dlqPublish = func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("random error")
+		}
+		return nil
+	}
+	topic := "transactions"
+	tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+	offsets := offset.NewTracker()
+	offsets.Track(tp)
+	batch := suspicioustransaction.NewBatchWriter(new(mongodb.MongoDb), 100, time.Hour,
+		suspicioustransaction.WithBulkWriteWrapper(func(ctx context.Context, write func(ctx context.Context) error) error {
+			return errors.New("random error")
+		}))
+	var stuck []kafka.TopicPartition
+	worker := &Worker{
+		Stats:      stats,
+		Rules:      rules.Default(),
+		Offsets:    offsets,
+		DeadLetter: &deadletter.Publisher{Topic: "transactions-dlq"},
+		Retry:      retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+		OnStuck: func(tp kafka.TopicPartition, err error) {
+			stuck = append(stuck, tp)
+		},
+		Batch: batch,
+		Msg: &kafka.Message{
+			TopicPartition: tp,
+			Value:          []byte(suspicious),
+		},
+	}
+	pool := task.New(context.Background(), 1, task.WithJobTimeout(time.Hour))
+	pool.Do(worker)
+	pool.Shutdown()
+	require.Empty(t, offsets.Committable())
+	// The job, and so its context, is over by the time the batch is written.
+	batch.Flush(context.Background())
+	require.Equal(t, 3, attempts)
+	require.Empty(t, stuck)
+	require.Equal(t, int64(1), stats.TotalDeadLetteredMessages())
+	require.Equal(t, int64(2), stats.TotalDeadLetterErrors())
+	require.Len(t, offsets.Committable(), 1)
+}
+
+func TestWorkCanceled(t *testing.T) {
+	const suspicious = `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":11308.58,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX"}`
+	testCases := []struct {
+		name                      string
+		cancel                    func(ctx context.Context) context.Context
+		expectedDeadLettered      int64
+		expectedOffsetCommittable bool
+	}{
+		{
+			name: "shutdown",
+			cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithCancelCause(ctx)
+				cancel(ErrShutdown)
+				return ctx
+			},
+		},
+		{
+			name: "job timeout",
+			cancel: func(ctx context.Context) context.Context {
+				ctx, cancel := context.WithTimeout(ctx, 0)
+				defer cancel()
+				return ctx
+			},
+			expectedDeadLettered:      1,
+			expectedOffsetCommittable: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stats := new(stats.KafkaConsumerStats)
+			printToLog = func(log *log.Logger, v ...any) {}
+			stInsert = func(ctx context.Context, db *mongodb.MongoDb, sp *models.SuspiciousTransaction) (bool, error) {
+				return false, errors.New("random error")
+			}
+			dlqPublish = func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+				return nil
+			}
+			topic := "transactions"
+			tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+			offsets := offset.NewTracker()
+			offsets.Track(tp)
+			worker := &Worker{
+				Stats:      stats,
+				Rules:      rules.Default(),
+				Offsets:    offsets,
+				DeadLetter: &deadletter.Publisher{Topic: "transactions-dlq"},
+				Retry:      retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+				Breaker:    breaker.New(1, time.Hour, nil),
+				Msg: &kafka.Message{
+					TopicPartition: tp,
+					Value:          []byte(suspicious),
+				},
+			}
+			worker.Work(tc.cancel(context.Background()))
+			require.Equal(t, int64(1), stats.TotalInsertSuspiciousTransactionErrors())
+			require.Equal(t, tc.expectedDeadLettered, stats.TotalDeadLetteredMessages())
+			require.Equal(t, tc.expectedOffsetCommittable, len(offsets.Committable()) == 1)
+			// Failing because of the context tells nothing about MongoDB.
+			require.Equal(t, breaker.Closed, worker.Breaker.State())
+		})
+	}
+}
+
+func TestFail(t *testing.T) {
+	stats := new(stats.KafkaConsumerStats)
+	dlqPublish = func(p *deadletter.Publisher, msg *kafka.Message, stage string, err error) error {
+		require.Equal(t, deadletter.PanicStage, stage)
+		require.Equal(t, "worker panicked", err.Error())
+		return nil
+	}
+	topic := "transactions"
+	tp := kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}
+	offsets := offset.NewTracker()
+	offsets.Track(tp)
+	worker := &Worker{
+		Stats:      stats,
+		Offsets:    offsets,
+		DeadLetter: &deadletter.Publisher{Topic: "transactions-dlq"},
+		Msg:        &kafka.Message{TopicPartition: tp},
+	}
+	worker.Fail(errors.New("worker panicked"))
+	require.Equal(t, int64(1), stats.TotalDeadLetteredMessages())
+	require.Len(t, offsets.Committable(), 1)
+}
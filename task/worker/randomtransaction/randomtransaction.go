@@ -27,42 +27,55 @@ var (
 
 // Worker generates random transaction data.
 type Worker struct {
-	FilePath  string
+	// Out is where the transaction is written, at position Seq.
+	Out       *Writer
+	Seq       int
+	Gen       *randomdata.Generator
 	MinAmount float32
 	MaxAmount float32
-	Log       *log.Logger
+	// Labeled writes the transaction with a ground-truth label
+	// telling it is not a fraud.
+	Labeled bool
+	Log     *log.Logger
 }
 
 // Work generates a random transaction and writes it to a file.
 func (w *Worker) Work(ctx context.Context) {
-	t := generateRandomTransaction(w.MinAmount, w.MaxAmount)
-	file, err := openFile(w.FilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		printToLog(w.Log, "error opening file:", err)
+	t := generateRandomTransaction(w.Gen, w.MinAmount, w.MaxAmount)
+	if !w.Labeled {
+		writeLines(w.Out, w.Seq, w.Log, t)
 		return
 	}
-	defer file.Close()
-	jsonData, err := jsonMarshal(t)
-	if err != nil {
-		printToLog(w.Log, "error marshalling json:", err)
-		return
-	}
-	_, err = fileWriteString(file, string(jsonData)+"\n")
-	if err != nil {
-		printToLog(w.Log, "error writing to file:", err)
+	writeLines(w.Out, w.Seq, w.Log, &transaction.Labeled{Transaction: *t, Scenario: transaction.NormalScenario})
+}
+
+// writeLines writes the JSON of every record, one per line, at the given
+// position of the writer. Nothing but the position is written on error,
+// so the following positions are not held back.
+func writeLines(out *Writer, seq int, log *log.Logger, records ...any) {
+	var lines []byte
+	for _, r := range records {
+		jsonData, err := jsonMarshal(r)
+		if err != nil {
+			printToLog(log, "error marshalling json:", err)
+			out.Write(seq, "")
+			return
+		}
+		lines = append(lines, jsonData...)
+		lines = append(lines, '\n')
 	}
+	out.Write(seq, string(lines))
 }
 
 // generateRandomTransaction generates a random transaction with the given minimum and maximum amounts.
-func generateRandomTransaction(minAmount, maxAmount float32) *transaction.Transaction {
-	const withdrawal = "withdrawal"
+func generateRandomTransaction(gen *randomdata.Generator, minAmount, maxAmount float32) *transaction.Transaction {
 	t := &transaction.Transaction{
-		TransactionID:     randomdata.TransactionID(),
-		AccountNumber:     randomdata.AccountNumber(),
+		TransactionID:     gen.TransactionID(),
+		AccountNumber:     gen.AccountNumber(),
 		TransactionType:   withdrawal,
-		TransactionAmount: randomdata.TransactionAmount(minAmount, maxAmount),
-		TransactionTime:   randomdata.TransactionTime(),
-		Location:          randomdata.Location(),
+		TransactionAmount: gen.TransactionAmount(minAmount, maxAmount),
+		TransactionTime:   gen.TransactionTime(),
+		Location:          gen.Location(),
 	}
 	return t
 }
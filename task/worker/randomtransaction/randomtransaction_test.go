@@ -5,53 +5,43 @@ package randomtransaction
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/randomdata"
 	"github.com/tiagomelo/realtime-data-kafka/stringify"
 )
 
 func TestWork(t *testing.T) {
 	testCases := []struct {
-		name                string
-		mockPrintToLog      func(log *log.Logger, v ...any)
-		mockOpenFile        func(name string, flag int, perm fs.FileMode) (*os.File, error)
-		mockJsonMarshal     func(v any) ([]byte, error)
-		mockFileWriteString func(file *os.File, s string) (n int, err error)
+		name            string
+		labeled         bool
+		mockPrintToLog  func(log *log.Logger, v ...any)
+		mockJsonMarshal func(v any) ([]byte, error)
+		expectedOutput  string
 	}{
 		{
-			name:           "happy path",
-			mockPrintToLog: func(log *log.Logger, v ...any) {},
-			mockOpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
-				return new(os.File), nil
-			},
-			mockJsonMarshal: func(v any) ([]byte, error) {
-				return []byte(""), nil
-			},
-			mockFileWriteString: func(file *os.File, s string) (n int, err error) {
-				return 0, nil
-			},
+			name:            "happy path",
+			mockPrintToLog:  func(log *log.Logger, v ...any) {},
+			mockJsonMarshal: json.Marshal,
+			expectedOutput:  `{"transaction_id":1409609192,"account_number":649354069,"transaction_type":"withdrawal","transaction_amount":49.39,"transaction_time":"2023-06-04T13:51:59Z","location":"Denver, CO"}` + "\n",
 		},
 		{
-			name: "error when opening file",
-			mockOpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
-				return nil, errors.New("random error")
-			},
-			mockPrintToLog: func(log *log.Logger, v ...any) {
-				expectedMsg := []string{"[error opening file: random error]"}
-				c := stringify.VariadicToStringArray(v)
-				require.Equal(t, expectedMsg, c)
-			},
+			name:            "labeled",
+			labeled:         true,
+			mockPrintToLog:  func(log *log.Logger, v ...any) {},
+			mockJsonMarshal: json.Marshal,
+			expectedOutput:  `{"transaction_id":1409609192,"account_number":649354069,"transaction_type":"withdrawal","transaction_amount":49.39,"transaction_time":"2023-06-04T13:51:59Z","location":"Denver, CO","is_fraud":false,"scenario":"normal"}` + "\n",
 		},
 		{
 			name: "error when marshaling",
-			mockOpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
-				return new(os.File), nil
-			},
 			mockJsonMarshal: func(v any) ([]byte, error) {
 				return nil, errors.New("random error")
 			},
@@ -61,14 +51,80 @@ func TestWork(t *testing.T) {
 				require.Equal(t, expectedMsg, c)
 			},
 		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			printToLog = tc.mockPrintToLog
+			openFile = os.OpenFile
+			jsonMarshal = tc.mockJsonMarshal
+			fileWriteString = func(file *os.File, s string) (n int, err error) {
+				return file.WriteString(s)
+			}
+			path := filepath.Join(t.TempDir(), "data.json")
+			out, err := NewWriter(path, nil)
+			require.NoError(t, err)
+			worker := &Worker{
+				Out:       out,
+				Gen:       randomdata.NewGenerator(1, time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)),
+				MinAmount: 10,
+				MaxAmount: 100,
+				Labeled:   tc.labeled,
+			}
+			worker.Work(context.TODO())
+			require.NoError(t, out.Close())
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedOutput, string(data))
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	printToLog = func(log *log.Logger, v ...any) {
+		t.Fatalf("unexpected log: %v", v)
+	}
+	openFile = os.OpenFile
+	fileWriteString = func(file *os.File, s string) (n int, err error) {
+		return file.WriteString(s)
+	}
+	path := filepath.Join(t.TempDir(), "data.json")
+	out, err := NewWriter(path, nil)
+	require.NoError(t, err)
+	out.Write(2, "c\n")
+	out.Write(1, "")
+	out.Write(0, "a\n")
+	out.Write(3, "d\n")
+	require.NoError(t, out.Close())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "a\nc\nd\n", string(data))
+
+	out, err = NewWriter(path, nil)
+	require.NoError(t, err)
+	out.Write(1, "b\n")
+	require.EqualError(t, out.Close(), "1 sequence numbers were not written, starting from 0")
+}
+
+func TestWriterErrors(t *testing.T) {
+	testCases := []struct {
+		name                string
+		mockPrintToLog      func(log *log.Logger, v ...any)
+		mockOpenFile        func(name string, flag int, perm fs.FileMode) (*os.File, error)
+		mockFileWriteString func(file *os.File, s string) (n int, err error)
+		expectedError       error
+	}{
+		{
+			name: "error when opening file",
+			mockOpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
+				return nil, errors.New("random error")
+			},
+			expectedError: errors.New("opening file: random error"),
+		},
 		{
 			name: "error when writing to file",
 			mockOpenFile: func(name string, flag int, perm fs.FileMode) (*os.File, error) {
 				return new(os.File), nil
 			},
-			mockJsonMarshal: func(v any) ([]byte, error) {
-				return []byte(""), nil
-			},
 			mockFileWriteString: func(file *os.File, s string) (n int, err error) {
 				return 0, errors.New("random error")
 			},
@@ -83,14 +139,19 @@ func TestWork(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			printToLog = tc.mockPrintToLog
 			openFile = tc.mockOpenFile
-			jsonMarshal = tc.mockJsonMarshal
 			fileWriteString = tc.mockFileWriteString
-			worker := &Worker{
-				MinAmount: 10,
-				MaxAmount: 100,
-				FilePath:  "filepath",
+			out, err := NewWriter("filepath", nil)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+				return
 			}
-			worker.Work(context.TODO())
+			if tc.expectedError != nil {
+				t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+			}
+			out.Write(0, "line\n")
 		})
 	}
 }
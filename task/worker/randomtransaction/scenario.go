@@ -0,0 +1,180 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package randomtransaction
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tiagomelo/realtime-data-kafka/geo"
+	"github.com/tiagomelo/realtime-data-kafka/randomdata"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+// Fraud scenarios.
+const (
+	VelocityBurstScenario    = "velocity_burst"
+	StructuringScenario      = "structuring"
+	ImpossibleTravelScenario = "impossible_travel"
+	AccountTakeoverScenario  = "account_takeover"
+)
+
+const (
+	withdrawal = "withdrawal"
+	// minTravelDistanceKm is the minimum distance between the locations
+	// of an impossible travel.
+	minTravelDistanceKm = 1500
+)
+
+// step is a transaction of a scenario, relative to the start of the scenario.
+type step struct {
+	offset   time.Duration
+	amount   float32
+	location string
+	isFraud  bool
+}
+
+// scenarios maps the scenario names to the functions generating their steps.
+var scenarios = map[string]func(gen *randomdata.Generator) []step{
+	VelocityBurstScenario:    velocityBurst,
+	StructuringScenario:      structuring,
+	ImpossibleTravelScenario: impossibleTravel,
+	AccountTakeoverScenario:  accountTakeover,
+}
+
+// Scenarios returns the names of the fraud scenarios, sorted.
+func Scenarios() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScenarioWorker generates the transactions of a fraud scenario,
+// labeled with the scenario, and writes them to a file.
+type ScenarioWorker struct {
+	// Out is where the transactions are written, at position Seq.
+	Out      *Writer
+	Seq      int
+	Gen      *randomdata.Generator
+	Scenario string
+	Log      *log.Logger
+}
+
+// Work generates the transactions of the scenario and writes them to a file.
+func (w *ScenarioWorker) Work(ctx context.Context) {
+	txs, err := generateScenario(w.Gen, w.Scenario)
+	if err != nil {
+		printToLog(w.Log, "error generating scenario:", err)
+		w.Out.Write(w.Seq, "")
+		return
+	}
+	records := make([]any, len(txs))
+	for i, t := range txs {
+		records[i] = t
+	}
+	writeLines(w.Out, w.Seq, w.Log, records...)
+}
+
+// generateScenario generates the transactions of a single account
+// acting out the given scenario, in time order, within the last 24 hours.
+func generateScenario(gen *randomdata.Generator, name string) ([]*transaction.Labeled, error) {
+	fn, ok := scenarios[name]
+	if !ok {
+		return nil, errors.Errorf("unknown scenario %q", name)
+	}
+	steps := fn(gen)
+	span := steps[len(steps)-1].offset
+	start := gen.Now().Add(-24 * time.Hour).Add(gen.Duration(0, 24*time.Hour-span))
+	accountNumber := gen.AccountNumber()
+	txs := make([]*transaction.Labeled, len(steps))
+	for i, s := range steps {
+		txs[i] = &transaction.Labeled{
+			Transaction: transaction.Transaction{
+				TransactionID:     gen.TransactionID(),
+				AccountNumber:     accountNumber,
+				TransactionType:   withdrawal,
+				TransactionAmount: s.amount,
+				TransactionTime:   start.Add(s.offset),
+				Location:          s.location,
+			},
+			IsFraud:  s.isFraud,
+			Scenario: name,
+		}
+	}
+	return txs, nil
+}
+
+// velocityBurst is a burst of withdrawals within a few minutes.
+func velocityBurst(gen *randomdata.Generator) []step {
+	location := gen.Location()
+	n := 6 + gen.Intn(5)
+	steps := make([]step, n)
+	var offset time.Duration
+	for i := range steps {
+		steps[i] = step{offset: offset, amount: gen.TransactionAmount(500, 3000), location: location, isFraud: true}
+		offset += gen.Duration(10*time.Second, time.Minute)
+	}
+	return steps
+}
+
+// structuring is a series of withdrawals just below the 10000 reporting
+// threshold within the same day.
+func structuring(gen *randomdata.Generator) []step {
+	location := gen.Location()
+	n := 3 + gen.Intn(3)
+	steps := make([]step, n)
+	var offset time.Duration
+	for i := range steps {
+		steps[i] = step{offset: offset, amount: gen.TransactionAmount(9000, 9999.99), location: location, isFraud: true}
+		offset += gen.Duration(30*time.Minute, 2*time.Hour)
+	}
+	return steps
+}
+
+// impossibleTravel is a legitimate withdrawal followed, within the hour,
+// by one in a city too far away to have travelled to.
+func impossibleTravel(gen *randomdata.Generator) []step {
+	from, to := farApartLocations(gen)
+	return []step{
+		{amount: gen.TransactionAmount(100, 3000), location: from},
+		{offset: gen.Duration(5*time.Minute, time.Hour), amount: gen.TransactionAmount(100, 3000), location: to, isFraud: true},
+	}
+}
+
+// accountTakeover is a history of small withdrawals in the home city of
+// the account, followed by large withdrawals in a different one.
+func accountTakeover(gen *randomdata.Generator) []step {
+	home, other := farApartLocations(gen)
+	var (
+		steps  []step
+		offset time.Duration
+	)
+	for i := 5 + gen.Intn(4); i > 0; i-- {
+		steps = append(steps, step{offset: offset, amount: gen.TransactionAmount(100, 1000), location: home})
+		offset += gen.Duration(30*time.Minute, 90*time.Minute)
+	}
+	for i := 1 + gen.Intn(3); i > 0; i-- {
+		steps = append(steps, step{offset: offset, amount: gen.TransactionAmount(5000, 20000), location: other, isFraud: true})
+		offset += gen.Duration(time.Minute, 5*time.Minute)
+	}
+	return steps
+}
+
+// farApartLocations returns two locations at least minTravelDistanceKm apart.
+func farApartLocations(gen *randomdata.Generator) (string, string) {
+	for {
+		a, b := gen.Location(), gen.Location()
+		ca, okA := geo.Lookup(a)
+		cb, okB := geo.Lookup(b)
+		if okA && okB && geo.DistanceKm(ca, cb) >= minTravelDistanceKm {
+			return a, b
+		}
+	}
+}
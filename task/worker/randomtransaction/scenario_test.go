@@ -0,0 +1,120 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package randomtransaction
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tiagomelo/realtime-data-kafka/geo"
+	"github.com/tiagomelo/realtime-data-kafka/randomdata"
+	"github.com/tiagomelo/realtime-data-kafka/transaction"
+)
+
+func TestGenerateScenario(t *testing.T) {
+	testCases := []struct {
+		name  string
+		check func(t *testing.T, txs []*transaction.Labeled)
+	}{
+		{
+			name: VelocityBurstScenario,
+			check: func(t *testing.T, txs []*transaction.Labeled) {
+				require.GreaterOrEqual(t, len(txs), 6)
+				require.Less(t, txs[len(txs)-1].TransactionTime.Sub(txs[0].TransactionTime), 10*time.Minute)
+				for _, tx := range txs {
+					require.True(t, tx.IsFraud)
+				}
+			},
+		},
+		{
+			name: StructuringScenario,
+			check: func(t *testing.T, txs []*transaction.Labeled) {
+				require.GreaterOrEqual(t, len(txs), 3)
+				for _, tx := range txs {
+					require.True(t, tx.IsFraud)
+					require.GreaterOrEqual(t, tx.TransactionAmount, float32(9000))
+					require.Less(t, tx.TransactionAmount, float32(10000))
+				}
+			},
+		},
+		{
+			name: ImpossibleTravelScenario,
+			check: func(t *testing.T, txs []*transaction.Labeled) {
+				require.Len(t, txs, 2)
+				require.False(t, txs[0].IsFraud)
+				require.True(t, txs[1].IsFraud)
+				from, _ := geo.Lookup(txs[0].Location)
+				to, _ := geo.Lookup(txs[1].Location)
+				require.GreaterOrEqual(t, geo.DistanceKm(from, to), float64(minTravelDistanceKm))
+				require.LessOrEqual(t, txs[1].TransactionTime.Sub(txs[0].TransactionTime), time.Hour)
+			},
+		},
+		{
+			name: AccountTakeoverScenario,
+			check: func(t *testing.T, txs []*transaction.Labeled) {
+				require.False(t, txs[0].IsFraud)
+				last := txs[len(txs)-1]
+				require.True(t, last.IsFraud)
+				require.NotEqual(t, txs[0].Location, last.Location)
+				require.GreaterOrEqual(t, last.TransactionAmount, float32(5000))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+			txs, err := generateScenario(randomdata.NewGenerator(time.Now().UnixNano(), now), tc.name)
+			require.NoError(t, err)
+			for i, tx := range txs {
+				require.Equal(t, tc.name, tx.Scenario)
+				require.Equal(t, txs[0].AccountNumber, tx.AccountNumber)
+				require.True(t, tx.TransactionTime.After(now.Add(-24*time.Hour)))
+				require.True(t, tx.TransactionTime.Before(now))
+				if i > 0 {
+					require.False(t, tx.TransactionTime.Before(txs[i-1].TransactionTime))
+				}
+			}
+			tc.check(t, txs)
+		})
+	}
+	_, err := generateScenario(randomdata.NewGenerator(1, time.Time{}), "unknown")
+	require.EqualError(t, err, `unknown scenario "unknown"`)
+}
+
+func TestScenarioWork(t *testing.T) {
+	var written string
+	printToLog = func(log *log.Logger, v ...any) {
+		t.Fatalf("unexpected log: %v", v)
+	}
+	openFile = func(name string, flag int, perm fs.FileMode) (*os.File, error) {
+		return new(os.File), nil
+	}
+	jsonMarshal = json.Marshal
+	fileWriteString = func(file *os.File, s string) (n int, err error) {
+		written = s
+		return len(s), nil
+	}
+	out, err := NewWriter("filepath", nil)
+	require.NoError(t, err)
+	worker := &ScenarioWorker{Out: out, Gen: randomdata.NewGenerator(1, time.Time{}), Scenario: ImpossibleTravelScenario}
+	worker.Work(context.TODO())
+	lines := strings.Split(strings.TrimSuffix(written, "\n"), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		tx, err := transaction.NewLabeled(line)
+		require.NoError(t, err)
+		require.Equal(t, ImpossibleTravelScenario, tx.Scenario)
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	require.Equal(t, []string{AccountTakeoverScenario, ImpossibleTravelScenario, StructuringScenario, VelocityBurstScenario}, Scenarios())
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package randomtransaction
+
+import (
+	"log"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Writer writes the lines generated by concurrent workers to a file in
+// the order of their sequence numbers, no matter the order in which the
+// workers finish, so the same input always gives the same file.
+type Writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	log     *log.Logger
+	next    int
+	pending map[int]string
+}
+
+// NewWriter opens the file, creating it if needed or truncating it
+// otherwise, to write lines to it.
+func NewWriter(filePath string, log *log.Logger) (*Writer, error) {
+	file, err := openFile(filePath, os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "opening file")
+	}
+	return &Writer{file: file, log: log, pending: make(map[int]string)}, nil
+}
+
+// Write writes the lines of the given sequence number once the lines of
+// all the previous ones were written. Every sequence number, starting
+// from zero, must be written exactly once, even if with no lines.
+func (w *Writer) Write(seq int, lines string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[seq] = lines
+	for {
+		lines, ok := w.pending[w.next]
+		if !ok {
+			return
+		}
+		delete(w.pending, w.next)
+		w.next++
+		if lines == "" {
+			continue
+		}
+		if _, err := fileWriteString(w.file, lines); err != nil {
+			printToLog(w.log, "error writing to file:", err)
+		}
+	}
+}
+
+// Close closes the file. It fails if a sequence number was never written.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) > 0 {
+		w.file.Close()
+		return errors.Errorf("%d sequence numbers were not written, starting from %d", len(w.pending), w.next)
+	}
+	return w.file.Close()
+}
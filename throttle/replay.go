@@ -0,0 +1,43 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// Replayer spaces events by the time between them when they first
+// happened, sped up by a factor. It is not safe for concurrent use.
+type Replayer struct {
+	speed   float64
+	started bool
+	// start is when the first event was replayed, and first when it
+	// first happened.
+	start time.Time
+	first time.Time
+}
+
+// NewReplayer creates a new Replayer. With a speed of 10, events that
+// happened a minute apart are replayed six seconds apart.
+func NewReplayer(speed float64) *Replayer {
+	return &Replayer{speed: speed}
+}
+
+// Wait waits until the event that happened at t is due, relative to
+// the first event. Events that are out of order, once their time passed, are due
+// right away. It returns the context error if the context is done first.
+func (r *Replayer) Wait(ctx context.Context, t time.Time) error {
+	if !r.started {
+		r.started = true
+		r.start = now()
+		r.first = t
+		return nil
+	}
+	due := r.start.Add(time.Duration(float64(t.Sub(r.first)) / r.speed))
+	if d := due.Sub(now()); d > 0 {
+		return sleep(ctx, d)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package throttle
+
+import (
+	"context"
+	"time"
+)
+
+// For ease of unit testing.
+var (
+	now   = time.Now
+	sleep = func(ctx context.Context, d time.Duration) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+)
+
+// TokenBucket limits how many events happen per second. The bucket
+// holds up to burst tokens and is refilled at rate tokens per second;
+// every event takes a token, waiting for one if the bucket is empty.
+// It is not safe for concurrent use.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a new TokenBucket of rate events per second,
+// which starts full.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+	}
+}
+
+// Wait takes a token, waiting until there is one. It returns the
+// context error if the context is done first.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	t := now()
+	b.tokens += t.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = t
+	// The token is taken ahead, so the next events wait for it too.
+	b.tokens--
+	if b.tokens >= 0 {
+		return nil
+	}
+	if err := sleep(ctx, time.Duration(-b.tokens/b.rate*float64(time.Second))); err != nil {
+		b.tokens++
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock mocks the clock: sleeping moves it forward.
+func fakeClock() *[]time.Duration {
+	clock := time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	now = func() time.Time {
+		return clock
+	}
+	sleep = func(ctx context.Context, d time.Duration) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		waits = append(waits, d)
+		clock = clock.Add(d)
+		return nil
+	}
+	return &waits
+}
+
+func TestTokenBucket(t *testing.T) {
+	testCases := []struct {
+		name          string
+		rate          float64
+		burst         int
+		events        int
+		expectedWaits []time.Duration
+	}{
+		{
+			name:   "within the burst",
+			rate:   10,
+			burst:  3,
+			events: 3,
+		},
+		{
+			name:          "over the burst",
+			rate:          10,
+			burst:         2,
+			events:        5,
+			expectedWaits: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond, 100 * time.Millisecond},
+		},
+		{
+			name:          "fractional rate",
+			rate:          0.5,
+			burst:         1,
+			events:        3,
+			expectedWaits: []time.Duration{2 * time.Second, 2 * time.Second},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			waits := fakeClock()
+			b := NewTokenBucket(tc.rate, tc.burst)
+			for i := 0; i < tc.events; i++ {
+				require.NoError(t, b.Wait(context.TODO()))
+			}
+			require.Equal(t, tc.expectedWaits, *waits)
+		})
+	}
+}
+
+func TestTokenBucketRefill(t *testing.T) {
+	fakeClock()
+	clock := now()
+	now = func() time.Time {
+		return clock
+	}
+	b := NewTokenBucket(10, 2)
+	require.NoError(t, b.Wait(context.TODO()))
+	require.NoError(t, b.Wait(context.TODO()))
+	// A second refills the bucket, but no more than the burst.
+	clock = clock.Add(time.Second)
+	var waited bool
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waited = true
+		return nil
+	}
+	require.NoError(t, b.Wait(context.TODO()))
+	require.NoError(t, b.Wait(context.TODO()))
+	require.False(t, waited)
+	require.NoError(t, b.Wait(context.TODO()))
+	require.True(t, waited)
+}
+
+func TestTokenBucketCanceled(t *testing.T) {
+	fakeClock()
+	b := NewTokenBucket(10, 1)
+	require.NoError(t, b.Wait(context.TODO()))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, b.Wait(ctx), context.Canceled)
+	// The token was given back.
+	require.Equal(t, float64(0), b.tokens)
+}
+
+func TestReplayer(t *testing.T) {
+	start := time.Date(2023, 6, 4, 10, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name          string
+		speed         float64
+		times         []time.Time
+		expectedWaits []time.Duration
+	}{
+		{
+			name:          "real time",
+			speed:         1,
+			times:         []time.Time{start, start.Add(time.Second), start.Add(3 * time.Second)},
+			expectedWaits: []time.Duration{time.Second, 2 * time.Second},
+		},
+		{
+			name:          "ten times real time",
+			speed:         10,
+			times:         []time.Time{start, start.Add(time.Minute), start.Add(2 * time.Minute)},
+			expectedWaits: []time.Duration{6 * time.Second, 6 * time.Second},
+		},
+		{
+			name:          "out of order",
+			speed:         1,
+			times:         []time.Time{start, start.Add(2 * time.Second), start.Add(time.Second), start.Add(-time.Second)},
+			expectedWaits: []time.Duration{2 * time.Second},
+		},
+		{
+			name:  "same time",
+			speed: 1,
+			times: []time.Time{start, start, start},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			waits := fakeClock()
+			r := NewReplayer(tc.speed)
+			for _, tm := range tc.times {
+				require.NoError(t, r.Wait(context.TODO(), tm))
+			}
+			require.Equal(t, tc.expectedWaits, *waits)
+		})
+	}
+}
+
+func TestReplayerCanceled(t *testing.T) {
+	fakeClock()
+	r := NewReplayer(1)
+	start := time.Date(2023, 6, 4, 10, 0, 0, 0, time.UTC)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, r.Wait(ctx, start))
+	cancel()
+	require.ErrorIs(t, r.Wait(ctx, start.Add(time.Second)), context.Canceled)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package transaction
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// maxLineSize is the maximum size of a line of a transactions file.
+const maxLineSize = 1024 * 1024
+
+// ReadFiles reads the transactions of every file matching the given glob
+// patterns, in order. It returns the number of lines that could not be parsed.
+func ReadFiles(patterns []string) ([]*Labeled, int, error) {
+	var (
+		txs     []*Labeled
+		invalid int
+	)
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "expanding %s", pattern)
+		}
+		if len(files) == 0 {
+			return nil, 0, errors.Errorf("no files match %s", pattern)
+		}
+		for _, file := range files {
+			n, err := readFile(file, func(t *Labeled) {
+				txs = append(txs, t)
+			})
+			if err != nil {
+				return nil, 0, err
+			}
+			invalid += n
+		}
+	}
+	return txs, invalid, nil
+}
+
+// readFile calls fn with every transaction of the file and returns
+// the number of lines that could not be parsed.
+func readFile(path string, fn func(t *Labeled)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, errors.Wrapf(err, "opening file %s", path)
+	}
+	defer f.Close()
+	var invalid int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		t, err := NewLabeled(scanner.Text())
+		if err != nil {
+			invalid++
+			continue
+		}
+		fn(t)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Wrapf(err, "reading file %s", path)
+	}
+	return invalid, nil
+}
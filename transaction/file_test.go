@@ -0,0 +1,37 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package transaction
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"transaction_id":1}
+invalid
+
+{"transaction_id":2}
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.json"), []byte(`{"transaction_id":3}`), 0644))
+
+	txs, invalid, err := ReadFiles([]string{filepath.Join(dir, "*.json")})
+	require.NoError(t, err)
+	require.Equal(t, 1, invalid)
+	ids := make([]int, len(txs))
+	for i, tx := range txs {
+		ids[i] = tx.TransactionID
+	}
+	require.Equal(t, []int{1, 2, 3}, ids)
+
+	_, _, err = ReadFiles([]string{filepath.Join(dir, "*.txt")})
+	require.EqualError(t, err, "no files match "+filepath.Join(dir, "*.txt"))
+
+	_, _, err = ReadFiles([]string{"[invalid"})
+	require.EqualError(t, err, "expanding [invalid: syntax error in pattern")
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package transaction
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// NormalScenario is the scenario of transactions that are not part of a fraud.
+const NormalScenario = "normal"
+
+// Labeled represents a transaction along with its ground-truth label,
+// as written by jsongenerator to evaluate the detection.
+type Labeled struct {
+	Transaction
+	IsFraud  bool   `json:"is_fraud"`
+	Scenario string `json:"scenario"`
+}
+
+// NewLabeled creates a new Labeled from the raw JSON transaction data.
+// Unlabeled transactions have an empty Scenario.
+func NewLabeled(rawTransaction string) (*Labeled, error) {
+	l := new(Labeled)
+	if err := json.Unmarshal([]byte(rawTransaction), l); err != nil {
+		return nil, errors.Wrap(err, "unmarshalling transaction")
+	}
+	return l, nil
+}
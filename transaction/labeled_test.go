@@ -0,0 +1,85 @@
+// Copyright (c) 2023 Tiago Melo. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+package transaction
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLabeled(t *testing.T) {
+	timestamp := "2023-06-05T03:05:12.495058-03:00"
+	parsedTime, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name           string
+		input          string
+		expectedOutput *Labeled
+		expectedError  error
+	}{
+		{
+			name:  "labeled",
+			input: `{"transaction_id":5699757367,"account_number":215489034,"transaction_type":"withdrawal","transaction_amount":9500,"transaction_time":"2023-06-05T03:05:12.495058-03:00","location":"Fort Worth, TX","is_fraud":true,"scenario":"structuring"}`,
+			expectedOutput: &Labeled{
+				Transaction: Transaction{
+					TransactionID:     5699757367,
+					AccountNumber:     215489034,
+					TransactionType:   "withdrawal",
+					TransactionAmount: 9500,
+					TransactionTime:   parsedTime,
+					Location:          "Fort Worth, TX",
+				},
+				IsFraud:  true,
+				Scenario: "structuring",
+			},
+		},
+		{
+			name:  "unlabeled",
+			input: `{"transaction_id":5699757367,"transaction_amount":9500}`,
+			expectedOutput: &Labeled{
+				Transaction: Transaction{
+					TransactionID:     5699757367,
+					TransactionAmount: 9500,
+				},
+			},
+		},
+		{
+			name:          "error",
+			input:         `invalid input`,
+			expectedError: errors.New("unmarshalling transaction: invalid character 'i' looking for beginning of value"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output, err := NewLabeled(tc.input)
+			if err != nil {
+				if tc.expectedError == nil {
+					t.Fatalf(`expected no error, got "%v"`, err)
+				}
+				require.Equal(t, tc.expectedError.Error(), err.Error())
+			} else {
+				if tc.expectedError != nil {
+					t.Fatalf(`expected error "%v", got nil`, tc.expectedError)
+				}
+				require.Equal(t, tc.expectedOutput, output)
+			}
+		})
+	}
+}
+
+func TestLabeledMarshal(t *testing.T) {
+	l := &Labeled{
+		Transaction: Transaction{TransactionID: 1, TransactionTime: time.Date(2023, 6, 5, 0, 0, 0, 0, time.UTC)},
+		Scenario:    NormalScenario,
+	}
+	b, err := json.Marshal(l)
+	require.NoError(t, err)
+	require.Equal(t, `{"transaction_id":1,"account_number":0,"transaction_type":"","transaction_amount":0,"transaction_time":"2023-06-05T00:00:00Z","location":"","is_fraud":false,"scenario":"normal"}`, string(b))
+}